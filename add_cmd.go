@@ -6,16 +6,71 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/mmcdole/gofeed"
 	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/httpfetch"
 )
 
+// optionsFlag collects the per-feed options given via repeated -option
+// flags.  It implements the flag.Value interface.
+type optionsFlag []configfile.Option
+
+// String is part of the flag.Value interface.
+func (o *optionsFlag) String() string {
+	var out []string
+	for _, opt := range *o {
+		out = append(out, opt.Name+":"+opt.Value)
+	}
+	return strings.Join(out, ",")
+}
+
+// Set is part of the flag.Value interface, it parses a "key:value" pair.
+func (o *optionsFlag) Set(value string) error {
+
+	name, val, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("options must be given as 'key:value', not '%s'", value)
+	}
+
+	*o = append(*o, configfile.Option{Name: name, Value: strings.TrimSpace(val)})
+	return nil
+}
+
 // Structure for our options and state.
 type addCmd struct {
 
 	// Configuration file, used for testing
 	config *configfile.ConfigFile
+
+	// discover controls whether we look for the feeds advertised by
+	// the URLs we're given, rather than adding them as-is.
+	discover bool
+
+	// pick selects one of several discovered feeds, starting from one.
+	pick int
+
+	// all adds all of the discovered feeds.
+	all bool
+
+	// options holds the per-feed options to set.
+	options optionsFlag
+
+	// force adds the feeds without fetching them.
+	force bool
+
+	// group is the group to add the feeds to.
+	group string
+
+	// file is the file to add the feeds to.
+	file string
 }
 
 // Arguments handles argument-flags we might have.
@@ -24,6 +79,14 @@ type addCmd struct {
 // which allows testing.
 func (a *addCmd) Arguments(flags *flag.FlagSet) {
 	a.config = configfile.New()
+
+	flags.BoolVar(&a.discover, "discover", true, "Fetch each URL, and if it is a HTML page add the feed it advertises.")
+	flags.IntVar(&a.pick, "pick", 0, "If several feeds are discovered add the one with the given number.")
+	flags.BoolVar(&a.all, "all", false, "If several feeds are discovered add all of them.")
+	flags.Var(&a.options, "option", "Set a per-feed option, as 'key:value'.  May be repeated.")
+	flags.BoolVar(&a.force, "force", false, "Add the feeds as given, without checking they can be fetched and parsed.")
+	flags.StringVar(&a.group, "group", "", "Add the feeds to the named group, creating it if necessary.")
+	flags.StringVar(&a.file, "file", "", "Add the feeds to the given file, which must already be included.")
 }
 
 // Info is part of the subcommand-API
@@ -32,6 +95,28 @@ func (a *addCmd) Info() (string, string) {
 
 Add one or more specified URLs to the configuration file.
 
+Each URL is fetched, and if it is a HTML page, rather than a feed, we
+add the feed it advertises instead.  If the page doesn't advertise a
+feed we look in common locations, such as '/feed', and '/index.xml'.
+
+If several feeds are found they're shown, and you may choose which to
+add via the '-pick' flag, or add them all via the '-all' flag.  To add
+an URL without looking for the feeds it advertises, use '-discover=false'.
+
+Before a feed is added we fetch it, and show its title, the number of
+items it contains, and when the most recent was published.  Feeds which
+can't be fetched, or parsed, are not added unless you use '-force', in
+which case the URLs are added as-is without fetching them.
+
+Per-feed options may be set via the '-option' flag, which may be used
+more than once.  The available options are described in the help for
+the config sub-command.
+
+Feeds may be added to a group, with the '-group' flag, in which case
+they inherit the options of that group, and are added to the file in
+which the group is found.  Otherwise they're added to the main file,
+unless you choose one of the files it includes via the '-file' flag.
+
 To see details of the configuration file, including the location,
 please run:
 
@@ -40,9 +125,104 @@ please run:
 Example:
 
     $ rss2email add https://blog.steve.fi/index.rss
+    $ rss2email add https://blog.steve.fi/
+    $ rss2email add -pick 2 https://example.com/
+    $ rss2email add -option tag:news -option exclude-title:Sponsored https://example.com/
+    $ rss2email add -group security https://example.com/
 `
 }
 
+// feeds returns the feeds to add for the given URL, discovering them if
+// necessary.
+func (a *addCmd) feeds(uri string) ([]httpfetch.Candidate, error) {
+
+	if a.force || !a.discover {
+		return []httpfetch.Candidate{{URL: uri}}, nil
+	}
+
+	found, err := httpfetch.Discover(configfile.Feed{URL: uri, Options: a.options}, logger, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single feed?
+	if len(found) == 1 {
+		if found[0].URL != uri {
+			fmt.Fprintf(out, "Found feed %s at %s\n", found[0].URL, uri)
+		}
+		return found, nil
+	}
+
+	// Several, and we've been told which to add?
+	if a.all {
+		return found, nil
+	}
+	if a.pick > 0 && a.pick <= len(found) {
+		return found[a.pick-1 : a.pick], nil
+	}
+
+	fmt.Fprintf(out, "Found %d feeds at %s:\n", len(found), uri)
+	for i, f := range found {
+		fmt.Fprintf(out, "  %d. %s", i+1, f.URL)
+		if f.Title != "" {
+			fmt.Fprintf(out, " - %s", f.Title)
+		}
+		fmt.Fprintf(out, " (%s)\n", f.Type)
+	}
+
+	if a.pick > 0 {
+		return nil, fmt.Errorf("there is no feed %d at %s", a.pick, uri)
+	}
+	return nil, fmt.Errorf("several feeds were found at %s, choose one via '-pick N', or add them all via '-all'", uri)
+}
+
+// check makes a trial fetch of the given feed, unless it was already
+// fetched during discovery, and reports upon its contents.
+func (a *addCmd) check(entry configfile.Feed, feed *gofeed.Feed) error {
+
+	if feed == nil {
+		helper := httpfetch.New(entry, logger, version)
+		helper.DisableCache()
+
+		var err error
+		feed, err = helper.Fetch()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Find the most recent item.
+	var last *time.Time
+	for _, item := range feed.Items {
+		t := item.PublishedParsed
+		if t == nil {
+			t = item.UpdatedParsed
+		}
+		if t != nil && (last == nil || t.After(*last)) {
+			last = t
+		}
+	}
+
+	published := "unknown"
+	if last != nil {
+		published = last.Format("2006-01-02 15:04")
+	}
+
+	fmt.Fprintf(out, "%s\n", entry.URL)
+	fmt.Fprintf(out, "  Title: %s\n", feed.Title)
+	fmt.Fprintf(out, "  Items: %d\n", len(feed.Items))
+	fmt.Fprintf(out, "  Last published: %s\n", published)
+
+	return nil
+}
+
+// sameFile returns true if the given paths refer to the same file.
+func sameFile(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
 // Execute is invoked if the user specifies `add` as the subcommand.
 func (a *addCmd) Execute(args []string) int {
 
@@ -55,16 +235,60 @@ func (a *addCmd) Execute(args []string) int {
 		return 1
 	}
 
+	// Ensure the file is one of ours.
+	if a.file != "" && !slices.ContainsFunc(a.config.Files(), func(path string) bool { return sameFile(path, a.file) }) {
+		logger.Error("the file is not part of the configuration, you must include it first",
+			slog.String("file", a.file))
+		return 1
+	}
+
+	// Ensure the options are valid, before we add anything.
+	for _, opt := range a.options {
+		err = configfile.CheckOption(opt)
+		if err != nil {
+			logger.Error("invalid option, see 'rss2email help config' for the available options",
+				slog.String("error", err.Error()))
+			return 1
+		}
+	}
+
 	changed := false
+	failed := false
 
 	// For each argument add it to the list
 	for _, entry := range args {
 
-		// Add the entry
-		a.config.Add(entry)
+		// Find the feeds to add.
+		found, err := a.feeds(entry)
+		if err != nil {
+			logger.Error("failed to add feed, use -force to add it anyway",
+				slog.String("url", entry),
+				slog.String("error", err.Error()))
+			failed = true
+			continue
+		}
+
+		for _, candidate := range found {
+
+			feed := configfile.Feed{URL: candidate.URL, Options: a.options, Group: a.group, File: a.file}
+
+			// Ensure we can fetch and parse the feed.
+			if !a.force {
+				err = a.check(feed, candidate.Feed)
+				if err != nil {
+					logger.Error("failed to fetch feed, use -force to add it anyway",
+						slog.String("url", candidate.URL),
+						slog.String("error", err.Error()))
+					failed = true
+					continue
+				}
+			}
 
-		changed = true
+			// Add the entry
+			a.config.AddFeed(feed)
 
+			changed = true
+		}
 	}
 
 	// Save the list.
@@ -76,6 +300,10 @@ func (a *addCmd) Execute(args []string) int {
 		}
 	}
 
+	if failed {
+		return 1
+	}
+
 	// All done, with no errors.
 	return 0
 }
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/skx/rss2email/configfile"
@@ -31,10 +37,17 @@ https://example.net/
 	}
 
 	add := addCmd{}
-	add.Arguments(nil)
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	add.Arguments(flags)
 	config := configfile.NewWithPath(tmpfile.Name())
 	add.config = config
 
+	// Don't fetch the URL
+	err = flags.Parse([]string{"-force"})
+	if err != nil {
+		t.Fatalf("Error parsing flags")
+	}
+
 	// Add an entry
 	add.Execute([]string{"https://blog.steve.fi/index.rss"})
 
@@ -58,3 +71,221 @@ https://example.net/
 
 	os.Remove(tmpfile.Name())
 }
+
+// TestAddDiscover ensures we add the feeds advertised by a HTML page.
+func TestAddDiscover(t *testing.T) {
+
+	bak := out
+	out = &bytes.Buffer{}
+	defer func() { out = bak }()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/one.rss", "/two.rss":
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Feed</title></channel></rss>`)
+		case "/multiple/":
+			fmt.Fprint(w, `<html><head>
+<link rel="alternate" type="application/rss+xml" title="One" href="/one.rss">
+<link rel="alternate" type="application/rss+xml" title="Two" href="/two.rss">
+</head></html>`)
+		default:
+			fmt.Fprint(w, `<html><head>
+<link rel="alternate" type="application/rss+xml" href="/one.rss">
+</head></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	// run executes the command, with the given flags, and returns
+	// the feeds in the resulting configuration file.
+	run := func(args ...string) (int, []string) {
+
+		path := t.TempDir() + "/feeds.txt"
+		err := os.WriteFile(path, []byte("# Feeds\n"), 0644)
+		if err != nil {
+			t.Fatalf("Error writing config file")
+		}
+
+		add := addCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		add.Arguments(flags)
+		add.config = configfile.NewWithPath(path)
+
+		err = flags.Parse(args)
+		if err != nil {
+			t.Fatalf("Error parsing flags")
+		}
+
+		ret := add.Execute(flags.Args())
+
+		var urls []string
+		entries, _ := configfile.NewWithPath(path).Parse()
+		for _, entry := range entries {
+			urls = append(urls, entry.URL)
+		}
+		return ret, urls
+	}
+
+	// A single feed is added.
+	ret, urls := run(ts.URL + "/")
+	if ret != 0 || len(urls) != 1 || urls[0] != ts.URL+"/one.rss" {
+		t.Fatalf("unexpected result %d %v", ret, urls)
+	}
+
+	// Several feeds must be chosen between.
+	ret, urls = run(ts.URL + "/multiple/")
+	if ret == 0 || len(urls) != 0 {
+		t.Fatalf("unexpected result %d %v", ret, urls)
+	}
+	if !strings.Contains(out.(*bytes.Buffer).String(), "2. "+ts.URL+"/two.rss - Two") {
+		t.Fatalf("candidates were not shown: %s", out.(*bytes.Buffer).String())
+	}
+
+	ret, urls = run("-pick", "2", ts.URL+"/multiple/")
+	if ret != 0 || len(urls) != 1 || urls[0] != ts.URL+"/two.rss" {
+		t.Fatalf("unexpected result %d %v", ret, urls)
+	}
+
+	ret, urls = run("-all", ts.URL+"/multiple/")
+	if ret != 0 || len(urls) != 2 {
+		t.Fatalf("unexpected result %d %v", ret, urls)
+	}
+}
+
+// TestAddValidate ensures feeds are fetched before they're added, and that
+// options are saved.
+func TestAddValidate(t *testing.T) {
+
+	bak := out
+	out = &bytes.Buffer{}
+	defer func() { out = bak }()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.rss":
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Example Feed</title>
+<item><title>One</title><link>https://example.com/1</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+<item><title>Two</title><link>https://example.com/2</link><pubDate>Tue, 03 Jan 2006 10:00:00 GMT</pubDate></item>
+</channel></rss>`)
+		default:
+			fmt.Fprint(w, `This is not a feed`)
+		}
+	}))
+	defer ts.Close()
+
+	path := t.TempDir() + "/feeds.txt"
+	err := os.WriteFile(path, []byte("# Feeds\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing config file")
+	}
+
+	run := func(args ...string) int {
+		add := addCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		add.Arguments(flags)
+		add.config = configfile.NewWithPath(path)
+
+		err = flags.Parse(args)
+		if err != nil {
+			t.Fatalf("Error parsing flags: %s", err)
+		}
+		return add.Execute(flags.Args())
+	}
+
+	// A valid feed is reported upon, and added with its options.
+	ret := run("-discover=false", "-group", "news", "-option", "tag: news", "-option", "retry:1", ts.URL+"/feed.rss")
+	if ret != 0 {
+		t.Fatalf("failed to add a valid feed")
+	}
+
+	report := out.(*bytes.Buffer).String()
+	for _, expected := range []string{"Title: Example Feed", "Items: 2", "Last published: 2006-01-03 10:00"} {
+		if !strings.Contains(report, expected) {
+			t.Fatalf("report didn't contain '%s': %s", expected, report)
+		}
+	}
+
+	// Content which isn't a feed is refused.
+	ret = run("-discover=false", "-option", "retry:1", ts.URL+"/broken")
+	if ret == 0 {
+		t.Fatalf("expected an error adding an invalid feed")
+	}
+
+	// Unless we force it.
+	ret = run("-force", ts.URL+"/forced")
+	if ret != 0 {
+		t.Fatalf("failed to force the addition of a feed")
+	}
+
+	entries, err := configfile.NewWithPath(path).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing written file: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	// Feeds without a group are added before the groups.
+	if entries[0].URL != ts.URL+"/forced" || entries[1].URL != ts.URL+"/feed.rss" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if entries[0].Group != "" || entries[1].Group != "news" {
+		t.Fatalf("feeds weren't added to the right group %v", entries)
+	}
+	if len(entries[1].Options) != 2 || entries[1].Options[0].Name != "tag" || entries[1].Options[0].Value != "news" {
+		t.Fatalf("options weren't saved %v", entries[1].Options)
+	}
+
+	// Options must be key:value pairs.
+	var opts optionsFlag
+	if opts.Set("missing") == nil || opts.Set(":value") == nil {
+		t.Fatalf("expected an error with an invalid option")
+	}
+}
+
+// TestAddFile ensures feeds may be added to an included file.
+func TestAddFile(t *testing.T) {
+
+	dir := t.TempDir()
+	main := dir + "/feeds.txt"
+	other := dir + "/other.txt"
+
+	err := os.WriteFile(main, []byte("include other.txt\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing config file")
+	}
+	err = os.WriteFile(other, []byte("# Other feeds\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing config file")
+	}
+
+	run := func(args ...string) int {
+		add := addCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		add.Arguments(flags)
+		add.config = configfile.NewWithPath(main)
+
+		err = flags.Parse(args)
+		if err != nil {
+			t.Fatalf("Error parsing flags: %s", err)
+		}
+		return add.Execute(flags.Args())
+	}
+
+	if run("-force", "-file", dir+"/missing.txt", "https://example.com/") == 0 {
+		t.Fatalf("expected an error adding to a file which isn't included")
+	}
+	if run("-force", "-file", other, "https://example.com/") != 0 {
+		t.Fatalf("failed to add to an included file")
+	}
+
+	data, err := os.ReadFile(other)
+	if err != nil || string(data) != "# Other feeds\nhttps://example.com/\n" {
+		t.Fatalf("unexpected content %q", data)
+	}
+	data, err = os.ReadFile(main)
+	if err != nil || string(data) != "include other.txt\n" {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
@@ -7,8 +7,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/settings"
 )
 
 // Structure for our options and state.
@@ -16,6 +19,13 @@ type configCmd struct {
 
 	// Configuration file, used for testing
 	config *configfile.ConfigFile
+
+	// check validates the configuration file, rather than showing
+	// our documentation.
+	check bool
+
+	// show displays our settings, rather than our documentation.
+	show bool
 }
 
 // Arguments handles argument-flags we might have.
@@ -24,6 +34,9 @@ type configCmd struct {
 // which allows testing.
 func (c *configCmd) Arguments(flags *flag.FlagSet) {
 	c.config = configfile.New()
+
+	flags.BoolVar(&c.check, "check", false, "Check the configuration file for errors, rather than showing this documentation.")
+	flags.BoolVar(&c.show, "show", false, "Show the effective value of each global setting, and where it came from, rather than showing this documentation.")
 }
 
 // Info is part of the subcommand-API
@@ -72,6 +85,11 @@ Entries can be commented out via the '#' character, temporarily:
        https://blog.steve.fi/index.rss
        # http://floooh.github.io/feed.xml
 
+When the file is changed by the add, delete, import, set, or unset
+sub-commands your comments, blank lines, and layout are preserved.  Comments
+immediately above a feed are considered to belong to it, and are removed
+when it is deleted.
+
 In addition to containing a list of feed-locations the configuration file
 allows per-feed configuration options to be set.  The general form of this
 support looks like this:
@@ -92,29 +110,159 @@ times, if you desire.
 As configuration-items refer to feeds it is a fatal error for such a thing
 to appear before a URL.
 
+Groups and Defaults
+-------------------
+
+If many feeds share the same options you can avoid repeating them by using
+sections.  Options which follow a "[defaults]" line apply to every feed, and
+options which follow a "[group name]" line apply to all the feeds listed after
+it, until the next section begins:
+
+       [defaults]
+        - notify: steve@example.com
+
+       [group security]
+        - tag: security
+        - exclude-title: (?i)sponsored
+       https://example.com/feed
+       https://example.org/feed
+        - notify: security@example.com
+
+Feeds listed before any section, or after the defaults, belong to no group.
+
+A feed's own options take precedence over those of its group, which take
+precedence over the defaults.  When an option is set at one level it replaces
+all the values of that option set at the levels below it, so in the example
+above https://example.org/feed is sent only to security@example.com, while
+both feeds have the tag "security".  If you want to add to an inherited
+"exclude" option, for example, you must repeat it.
+
+New feeds may be added to a group via "rss2email add -group name ...".
+
+
+Multiple Files
+--------------
+
+The list of feeds may be split across several files, via "include" lines.
+These name a file, or a glob which may match several files, relative to the
+directory of the file which contains the line:
+
+       https://example.com/feed
+       include security.txt
+       include teams/*.txt
+
+Any files with a ".txt" suffix in the "feeds.d" directory, next to the main
+configuration file, are included automatically.
+
+Included files may include others, but a file may not include itself, either
+directly or indirectly.  Sections don't extend into the files which are
+included, although the options of the defaults, and of groups, apply to the
+feeds of every file.
+
+When feeds are deleted, or their options changed, the file in which they're
+listed is updated.  New feeds are added to the main file, or to the file which
+contains their group, and "rss2email add -file path ..." may be used to choose
+one of the included files.
+
+
+Structured Configuration
+------------------------
+
+Instead of the plain-text file you may use a structured configuration file,
+in YAML format, which is read from:
+
+     ` + configfile.YAMLPath() + `
+
+As well as the feeds, and their options, this file may contain the global
+settings which are otherwise read from environmental variables, such as
+SMTP_HOST, SLEEP, and LOG_LEVEL.  If a variable is set in the environment it
+takes precedence over the file:
+
+       settings:
+         smtp_host: smtp.example.com
+         smtp_port: 587
+         log_level: warn
+
+       defaults:
+         notify: steve@example.com
+
+       groups:
+         security:
+           tag: security
+           exclude-title:
+             - (?i)sponsored
+             - (?i)webinar
+
+       feeds:
+         - https://example.com/feed
+         - url: https://example.org/feed
+           group: security
+           options:
+             notify: security@example.com
+
+Feeds may be listed as an URL, or as a mapping containing the URL and,
+optionally, the group the feed belongs to and its options.  Options with
+several values are written as lists.  Options are inherited from the defaults
+and groups in the same way as in the plain-text file.
+
+Once the structured file lists feeds it is used instead of the plain-text
+file, otherwise only its settings are used.  Your existing list of feeds may
+be converted by running:
+
+      $ rss2email convert
+
+When the structured file is changed by the add, delete, set, or unset
+sub-commands the comments it contains are preserved.
+
+
+Global Settings
+---------------
+
+Settings which apply to everything, such as how email is delivered, may be
+set as environmental variables, in the settings section of the structured
+configuration file described above, or in a "[settings]" section of the
+plain-text file:
+
+       [settings]
+        - smtp_host: smtp.example.com
+        - smtp_port: 587
+        - sleep: 30
+
+Names are not case-sensitive, and "-" may be used in place of "_".  When a
+setting is given in more than one place the environment takes precedence,
+followed by the structured file, and then the plain-text file.  Feeds which
+follow the settings section belong to no group.
+
+` + settingTable() + `
+
+To see the value of each setting, and where it came from, run:
+
+      $ rss2email config -show
+
+Secrets, such as SMTP_PASSWORD, are not displayed, and neither are the files
+or commands from which they're read.
+
+Secrets don't need to be placed in the environment, or in the configuration
+files, where they might be seen by others.  They may be read from a file, by
+setting the "_FILE" form of the setting, such as SMTP_PASSWORD_FILE, or from
+the output of a command, run via /bin/sh, by setting the "_COMMAND" form:
+
+        [settings]
+         - smtp_password_command: pass show smtp
+
+If more than one form is set the value itself is used first, then the file,
+then the command.  Surrounding whitespace, such as a trailing newline, is
+removed from the secret.
+
+SMTP_AUTH chooses how we authenticate with the SMTP server.  With "xoauth2"
+the access token is either SMTP_PASSWORD, or it is fetched, and cached, via
+SMTP_OAUTH_TOKEN_URL and the OAuth2 client, and refresh token, settings.
+
+
 Per-Feed Configuration Options
 ------------------------------
 
-Key           | Purpose
---------------+--------------------------------------------------------------
-delay         | The amount of time to sleep before retrying a failed HTTP-fetch
-              | in seconds - "retry" configures the number of attempts to be made.
-exclude       | Exclude any item which matches the given regular-expression.
-exclude-title | Exclude any item with a title matching the given regular-expression.
-exclude-older | Exclude any items whose publication date is older than the
-              | specified number of days.
-frequency     | How frequently to poll this feed, in minutes.
-include       | Include only items which match the given regular-expression.
-include-title | Include only items with a title matching the given regular-expression.
-insecure      | Ignore TLS failures when fetching feeds over https.
-              | Disable the checks by setting this value to "true", or "yes".
-notify        | Comma-delimited list of emails to send notifications to (if set,
-              | replaces the emails specified in the cron/daemon command-line).
-retry         | The maximum number of times to retry a failing HTTP-fetch.
-sleep         | Sleep the specified number of seconds, before making the request.
-tag           | Setup a tag for this feed, which can be accessed in the template.
-template      | The path to a feed-specific email template to use.
-user-agent    | Configure a specific User-Agent when making HTTP requests.
+` + optionTable() + `
 
 
 Polling Frequency
@@ -134,6 +282,82 @@ Note that frequencies of less than 5 minutes will be ignored, as that is how
 the sleep between executions takes.
 
 
+Scheduled Digests
+-----------------
+
+Feeds which have a "digest-schedule" option set don't generate emails as new
+items are found, instead the items are queued in the state database.  The next
+time the cron or daemon commands run after the scheduled time has passed the
+queued items will be sent as a single digest email.
+
+Schedules may be "daily", or "weekly@day", optionally followed by a time of
+day, in the local timezone, such as "daily@08:00", or "weekly@mon@09:30".
+
+You may view the queued items, or send them immediately, via the 'queue'
+sub-command.
+
+
+Item Identity
+-------------
+
+By default we decide whether an item is new by looking at its link, which
+means that if a publisher changes their URLs, for example moving from http to
+https, or adding tracking parameters, all their items will be emailed again.
+
+The "identity" option allows you to change this:
+
+  link            - Use the link of the item, as-is.
+  guid            - Use the GUID of the item, falling back to the link.
+  normalized-link - Use the link, after canonicalizing it.  The scheme is
+                    treated as https, "www." prefixes, default ports,
+                    fragments, trailing slashes and tracking parameters
+                    (e.g. "utm_source") are removed, and query parameters
+                    are sorted.
+  hash            - Use a hash of the title and content of the item.
+
+When you change the identity of a feed the items we've already seen will be
+recognised, and updated to the new identity, the next time the feed is fetched.
+
+
+Updated Items
+-------------
+
+Normally we only send an email the first time we see an item, and any later
+changes to it are ignored.  If you set the "notify-updates" option on a feed
+then we record the text of each item, and if it changes we'll send an email
+with the subject prefixed by "Updated:", containing the changes which were made.
+
+Items which were seen before the option was enabled have their text recorded
+the next time the feed is fetched, and updates are reported from then on.
+Updates are always sent as individual emails, even for digest feeds.
+
+
+Pruning
+-------
+
+We remember the items we've seen in each feed, and forget them once they're
+no longer present in the feed.  As some feeds occasionally return a truncated
+list of items we wait until an item has been missing for a grace period before
+forgetting it, otherwise it would be emailed again when it reappeared.
+
+By default the grace period is one day, this may be changed globally via the
+PRUNE_GRACE environmental variable, or per-feed via the "prune-grace" option.
+Setting the value to "0" forgets missing items immediately.
+
+
+Checking The Configuration
+--------------------------
+
+Options which are unknown, or have invalid values, are reported as warnings
+when the feeds are processed, and otherwise ignored.  To check your file for
+such problems run:
+
+      $ rss2email config -check
+
+Each problem is shown along with its line number, and if an option name is
+misspelt the closest valid name is suggested.
+
+
 Regular Expression Tips
 -----------------------
 
@@ -151,9 +375,111 @@ word "cake" in their titles regardless of whether it is written as "cake",
 	return name, doc
 }
 
-// Execute is invoked if the user specifies `add` as the subcommand.
+// optionTable returns the table describing our per-feed options.
+func optionTable() string {
+
+	var sb strings.Builder
+	sb.WriteString("Key             | Purpose\n")
+	sb.WriteString("----------------+--------------------------------------------------------------\n")
+
+	for _, opt := range configfile.KnownOptions {
+		for i, line := range strings.Split(opt.Purpose, "\n") {
+			name := ""
+			if i == 0 {
+				name = opt.Name
+			}
+			fmt.Fprintf(&sb, "%-16s| %s\n", name, line)
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// checkConfig validates the configuration file, reporting any problems.
+func (c *configCmd) checkConfig() int {
+
+	entries, err := c.config.Parse()
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", err)
+		return 1
+	}
+
+	problems := c.config.Check()
+	for _, problem := range problems {
+		fmt.Fprintf(out, "%s\n", problem)
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+
+	fmt.Fprintf(out, "%s: %d feeds, no problems found\n", c.config.Path(), len(entries))
+	return 0
+}
+
+// settingTable returns the table describing our global settings.
+func settingTable() string {
+
+	all := configfile.AllSettings()
+
+	width := len("Name")
+	for _, s := range all {
+		width = max(width, len(s.Name))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-*s | Purpose\n", width, "Name")
+	fmt.Fprintf(&sb, "%s-+-%s\n", strings.Repeat("-", width), strings.Repeat("-", 55))
+
+	for _, s := range all {
+		fmt.Fprintf(&sb, "%-*s | %s\n", width, s.Name, s.Purpose)
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// showSettings displays the effective value of each setting, and where
+// it came from.
+func (c *configCmd) showSettings() int {
+
+	err := settings.Load(c.config)
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Setting\tValue\tSource\n")
+
+	infos := configfile.AllSettings()
+	for i, v := range settings.All() {
+		value := v.Value
+		if infos[i].Secret && value != "" {
+			value = "********"
+		}
+
+		source := v.Source
+		if source == "" {
+			source = "unset"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", v.Name, value, source)
+	}
+
+	w.Flush()
+	return 0
+}
+
+// Execute is invoked if the user specifies `config` as the subcommand.
 func (c *configCmd) Execute(args []string) int {
 
+	if c.check {
+		return c.checkConfig()
+	}
+	if c.show {
+		return c.showSettings()
+	}
+
 	_, help := c.Info()
 	fmt.Fprintf(out, "%s", help)
 
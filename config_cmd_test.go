@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/settings"
 )
 
 func TestConfig(t *testing.T) {
@@ -85,3 +86,109 @@ func TestMissingConfig(t *testing.T) {
 		}
 	}
 }
+
+// TestConfigCheck ensures that problems in the configuration file are
+// reported.
+func TestConfigCheck(t *testing.T) {
+
+	bak := out
+	defer func() { out = bak }()
+
+	for _, test := range []struct {
+		content  string
+		ret      int
+		expected string
+	}{
+		{"https://example.com/\n - retry: 3\n", 0, "1 feeds, no problems found"},
+		{"https://example.com/\n - retry: 3\n - exlude: foo\n", 1, ":3: unknown option 'exlude', did you mean 'exclude'?"},
+		{" - retry: 3\n", 1, ":1: option outside a URL"},
+		{"https://example.com/\n - digest-schedule: hourly\n", 1, ":2: invalid value for option 'digest-schedule'"},
+	} {
+
+		out = &bytes.Buffer{}
+
+		path := t.TempDir() + "/feeds.txt"
+		err := os.WriteFile(path, []byte(test.content), 0644)
+		if err != nil {
+			t.Fatalf("Error writing config file")
+		}
+
+		c := configCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		c.Arguments(flags)
+		c.config = configfile.NewWithPath(path)
+
+		err = flags.Parse([]string{"-check"})
+		if err != nil {
+			t.Fatalf("Error parsing flags")
+		}
+
+		ret := c.Execute(flags.Args())
+		if ret != test.ret {
+			t.Fatalf("unexpected return %d for %q", ret, test.content)
+		}
+		if !strings.Contains(out.(*bytes.Buffer).String(), test.expected) {
+			t.Fatalf("expected '%s', got %s", test.expected, out.(*bytes.Buffer).String())
+		}
+	}
+}
+
+// TestConfigShow ensures the settings are shown, along with their sources.
+func TestConfigShow(t *testing.T) {
+
+	bak := out
+	out = &bytes.Buffer{}
+	defer func() { out = bak }()
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("SMTP_PASSWORD_FILE", "/run/secrets/smtp")
+
+	path := t.TempDir() + "/feeds.txt"
+	err := os.WriteFile(path, []byte("[settings]\n - smtp_host: smtp.example.com\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing config file")
+	}
+
+	c := configCmd{}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.Arguments(flags)
+	c.config = configfile.NewWithPath(path)
+	defer settings.Load(configfile.NewWithPath(t.TempDir() + "/missing.txt"))
+
+	err = flags.Parse([]string{"-show"})
+	if err != nil {
+		t.Fatalf("Error parsing flags")
+	}
+
+	if c.Execute(flags.Args()) != 0 {
+		t.Fatalf("failed to show settings")
+	}
+
+	// Compare the fields of each line, as the widths of the columns
+	// depend upon the settings we know about.
+	output := out.(*bytes.Buffer).String()
+	lines := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			lines[fields[0]] = strings.Join(fields, " ")
+		}
+	}
+	for _, expected := range []string{
+		"SMTP_HOST smtp.example.com " + path + ":2",
+		"SMTP_PASSWORD ******** environment",
+		"SMTP_PASSWORD_FILE ******** environment",
+		"SMTP_PORT 587 default",
+		"SMTP_USERNAME unset",
+	} {
+		name, _, _ := strings.Cut(expected, " ")
+		if lines[name] != expected {
+			t.Fatalf("expected %q, got %s", expected, output)
+		}
+	}
+	if strings.Contains(output, "secret") {
+		t.Fatalf("the password was shown: %s", output)
+	}
+}
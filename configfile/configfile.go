@@ -12,14 +12,82 @@
 //
 // It is assumed lines contain URLs, but anything prefixed with a "-"
 // is taken to be a parameter using a colon-deliminator.
+//
+// Options may be shared by several feeds via sections.  The options
+// which follow a "[defaults]" line apply to every feed, and those which
+// follow a "[group name]" line apply to the feeds listed after it, until
+// the next section begins:
+//
+//	[defaults]
+//	 - notify: steve@example.com
+//
+//	[group security]
+//	 - tag: security
+//	https://example.com/
+//	 - notify: security@example.com
+//
+// The options which follow a "[settings]" line are global settings, such
+// as "smtp_host", rather than options of any feed.
+//
+// A feed's own options take precedence over those of its group, which take
+// precedence over the defaults.  An option set at one level replaces all
+// the values of that option inherited from the levels below it.
+//
+// The feed list may be split across several files, via "include" lines
+// which name a file, or a glob, relative to the including file:
+//
+//	include security.txt
+//	include teams/*.txt
+//
+// Files with a ".txt" suffix in a "feeds.d" directory, next to the main
+// file, are included automatically.  Sections don't extend into the files
+// which are included, though the options of the defaults, and of groups,
+// apply to feeds in every file.
+//
+// When the files are changed, and saved, the comments, blank lines, and
+// layout of the lines which weren't changed are preserved.
+//
+// A structured configuration file, in YAML format, may be used instead of
+// the plain-text list of feeds.  It contains the global settings, which
+// would otherwise be taken from the environment, as well as the feeds and
+// their options:
+//
+//	settings:
+//	  smtp_host: smtp.example.com
+//	  smtp_port: 587
+//	  log_level: warn
+//
+//	defaults:
+//	  notify: steve@example.com
+//
+//	groups:
+//	  security:
+//	    tag: security
+//	    exclude-title:
+//	      - (?i)sponsored
+//	      - (?i)webinar
+//
+//	feeds:
+//	  - https://example.com/feed
+//	  - url: https://example.org/feed
+//	    group: security
+//	    options:
+//	      notify: security@example.com
+//
+// An option with several values is written as a list.  Options are
+// inherited from the defaults, and groups, exactly as they are in the
+// plain-text format.  The structured file is used instead of the plain-text
+// file if it exists, and lists feeds.
 package configfile
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/skx/rss2email/state"
@@ -47,8 +115,90 @@ type Feed struct {
 	URL string
 
 	// Options contains a collection of any optional parameters
-	// which have been read after an URL
+	// which have been read after an URL, along with those inherited
+	// from the defaults, and the group to which the feed belongs.
 	Options []Option
+
+	// Group is the name of the group to which the feed belongs, if any.
+	Group string
+
+	// File is the path to the file in which the feed is listed.
+	File string
+}
+
+// LineError is an error found upon a specific line of a configuration file.
+type LineError struct {
+
+	// Path is the path to the file containing the error.
+	Path string
+
+	// Line is the number of the line, starting from one.
+	Line int
+
+	// Err describes the problem.
+	Err error
+}
+
+// Error is part of the error interface.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// line is a single line of the configuration file.
+//
+// We keep every line we read, including comments and blank lines, so
+// that when the file is saved only the lines which were changed differ.
+type line struct {
+
+	// text is the line as it appears in the file.
+	text string
+
+	// url is set if the line contains the URL of a feed.
+	url string
+
+	// option is set if the line contains a per-feed option.
+	option *Option
+
+	// header is set if the line begins a section.
+	header bool
+
+	// group holds the name of the group which the line begins, it is
+	// empty for the defaults, and settings, sections.
+	group string
+
+	// settings is set if the line begins the settings section.
+	settings bool
+
+	// includes holds the files included by an include line.
+	includes []*source
+}
+
+// isComment returns true if the line is a comment.
+func (l line) isComment() bool {
+	return strings.HasPrefix(strings.TrimSpace(l.text), "#")
+}
+
+// isBlank returns true if the line is empty, or contains only whitespace.
+func (l line) isBlank() bool {
+	return strings.TrimSpace(l.text) == ""
+}
+
+// source is one of the files which make up our configuration.
+type source struct {
+
+	// path is the path to the file.
+	path string
+
+	// lines holds the lines of the file.
+	lines []line
+
+	// dirty is set when the lines have been changed.
+	dirty bool
 }
 
 // ConfigFile contains our state.
@@ -57,17 +207,37 @@ type ConfigFile struct {
 	// Path contains the path to our config file
 	path string
 
+	// main is the main configuration file.
+	main *source
+
+	// dropins are the files read from the feeds.d directory.
+	dropins []*source
+
+	// sources holds all the files we've read, in the order we read them.
+	sources []*source
+
+	// yaml is set if we're using a structured configuration file.
+	yaml *yamlFile
+
 	// The entries we found.
 	entries []Feed
 
 	// Key:value regular expression
 	re *regexp.Regexp
+
+	// Section-header regular expression
+	section *regexp.Regexp
+
+	// root, if set, is the directory outside which files may not be
+	// included.  This is used when fuzzing the parser.
+	root string
 }
 
 // New creates a new configuration-file reader.
 func New() *ConfigFile {
 	return &ConfigFile{
-		re: regexp.MustCompile(`^([^:]+):(.*)$`),
+		re:      regexp.MustCompile(`^([^:]+):(.*)$`),
+		section: regexp.MustCompile(`^\[\s*(defaults|settings|group\s+([^\]]*?))\s*\]$`),
 	}
 }
 
@@ -85,32 +255,125 @@ func NewWithPath(file string) *ConfigFile {
 }
 
 // Path returns the path to the configuration-file.
+//
+// This is the structured configuration file, if it exists and lists feeds,
+// otherwise it is the plain-text list of feeds.
 func (c *ConfigFile) Path() string {
 
 	// If we've not calculated the path then do so now.
 	if c.path == "" {
 		c.path = filepath.Join(state.Directory(), "feeds.txt")
+		if hasFeeds(YAMLPath()) {
+			c.path = YAMLPath()
+		}
 	}
 
 	return c.path
 }
 
-// Parse returns the entries from the config-file
+// Files returns the paths of all the files which make up the
+// configuration, starting with the main file.
+//
+// You must call `Parse` before calling this method.
+func (c *ConfigFile) Files() []string {
+
+	if c.yaml != nil {
+		return []string{c.yaml.path}
+	}
+
+	var paths []string
+	for _, src := range c.sources {
+		paths = append(paths, src.path)
+	}
+	return paths
+}
+
+// Parse returns the entries from the config-file, and any files it
+// includes.
 func (c *ConfigFile) Parse() ([]Feed, error) {
 
 	// Remove all existing entries
 	c.entries = []Feed{}
+	c.main = nil
+	c.dropins = nil
+	c.sources = nil
+	c.yaml = nil
 
-	// Open the file
-	file, err := os.Open(c.Path())
+	if isYAML(c.Path()) {
+		return c.parseYAML()
+	}
+
+	c.main = &source{path: c.Path()}
+	c.sources = []*source{c.main}
+
+	err := c.parseFile(c.main, []string{absPath(c.main.path)})
 	if err != nil {
+		c.rebuild()
 		return c.entries, err
 	}
+
+	// Read the files in the feeds.d directory, if present.
+	pattern := filepath.Join(filepath.Dir(c.main.path), "feeds.d", "*.txt")
+	matches, _ := filepath.Glob(pattern)
+	sort.Strings(matches)
+
+	for _, path := range matches {
+		if c.parsed(path) {
+			continue
+		}
+
+		src := &source{path: path}
+		c.sources = append(c.sources, src)
+		c.dropins = append(c.dropins, src)
+
+		err = c.parseFile(src, []string{absPath(c.main.path), absPath(path)})
+		if err != nil {
+			c.rebuild()
+			return c.entries, err
+		}
+	}
+
+	c.rebuild()
+	return c.entries, nil
+}
+
+// absPath returns the absolute form of the given path, if possible, for
+// comparisons.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// parsed returns true if we've already read the given file.
+func (c *ConfigFile) parsed(path string) bool {
+	for _, src := range c.sources {
+		if absPath(src.path) == absPath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFile reads the lines of the given file, and those of the files it
+// includes.  The stack holds the files which are being read, and is used
+// to detect include-loops.
+func (c *ConfigFile) parseFile(src *source, stack []string) error {
+
+	// Open the file
+	file, err := os.Open(src.path)
+	if err != nil {
+		return err
+	}
 	defer file.Close()
 
-	// Temporary entry
-	var tmp Feed
-	tmp.Options = []Option{}
+	// The URL of the feed to which options refer.
+	url := ""
+
+	// Whether options refer to the section which began most recently.
+	inHeader := false
 
 	// Create a scanner to process the file.
 	scanner := bufio.NewScanner(file)
@@ -118,68 +381,503 @@ func (c *ConfigFile) Parse() ([]Feed, error) {
 	// Scan line by line
 	for scanner.Scan() {
 
+		l := line{text: scanner.Text()}
+
 		// Get the line, and strip leading/trailing space
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
+		text := strings.TrimSpace(l.text)
 
-		// skip comments
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
+		switch {
+
+		// comments are kept, but otherwise ignored
+		case l.isComment():
+
+		// other files may be included
+		case strings.HasPrefix(text, "include "):
+
+			l.includes, err = c.include(src, len(src.lines), strings.TrimSpace(strings.TrimPrefix(text, "include ")), stack)
+			if err != nil {
+				return err
+			}
+			url = ""
+			inHeader = false
+
+		// sections contain options shared by several feeds
+		case strings.HasPrefix(text, "["):
+
+			fields := c.section.FindStringSubmatch(text)
+			if fields == nil {
+				return lineError(src, len(src.lines), fmt.Errorf("unknown section '%s', expected [defaults], [settings], or [group name]", text))
+			}
+			if fields[1] != "defaults" && fields[1] != "settings" && fields[2] == "" {
+				return lineError(src, len(src.lines), fmt.Errorf("group without a name: %s", text))
+			}
+
+			l.header = true
+			l.group = fields[2]
+			l.settings = fields[1] == "settings"
+			url = ""
+			inHeader = true
 
 		// optional params have "-" prefix
-		if strings.HasPrefix(line, "-") {
+		case strings.HasPrefix(text, "-"):
 
-			// options go AFTER the URL to which they refer
-			if tmp.URL == "" {
-				return c.entries, fmt.Errorf("error: option outside a URL: %s", scanner.Text())
+			// options go AFTER the URL, or section, to which they refer
+			if url == "" && !inHeader {
+				return lineError(src, len(src.lines), fmt.Errorf("option outside a URL: %s", l.text))
 			}
 
 			// Remove the prefix and split by ":"
-			line = strings.TrimPrefix(line, "-")
+			text = strings.TrimPrefix(text, "-")
 
 			// Look for "foo:bar"
-			fields := c.re.FindStringSubmatch(line)
+			fields := c.re.FindStringSubmatch(text)
 
 			// If we got key/val then save them away
-			if len(fields) == 3 {
-				key := strings.TrimSpace(fields[1])
-				val := strings.TrimSpace(fields[2])
-				tmp.Options = append(tmp.Options, Option{Name: key, Value: val})
+			if len(fields) != 3 {
+				owner := url
+				if owner == "" {
+					owner = "the section header"
+				}
+				return lineError(src, len(src.lines), fmt.Errorf("options should be of the form 'key:value', bogus entry found '%s', beneath %s", text, owner))
+			}
+
+			key := strings.TrimSpace(fields[1])
+			val := strings.TrimSpace(fields[2])
+			l.option = &Option{Name: key, Value: val}
+
+		// Otherwise we have an URL, or a blank line which ends the
+		// options of the previous one.
+		default:
+			url = text
+			l.url = text
+			inHeader = false
+		}
+
+		src.lines = append(src.lines, l)
+	}
+
+	// Look for scanner-errors
+	return scanner.Err()
+}
+
+// include reads the files named by the include line with the given index.
+//
+// Paths are relative to the including file, and may be globs.  A glob
+// which matches nothing is not an error, but a missing file is.
+func (c *ConfigFile) include(src *source, i int, pattern string, stack []string) ([]*source, error) {
+
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(src.path), pattern)
+	}
+
+	if c.root != "" && !strings.HasPrefix(absPath(pattern), absPath(c.root)+string(filepath.Separator)) {
+		return nil, lineError(src, i, fmt.Errorf("failed to include %s: it is outside %s", pattern, c.root))
+	}
+
+	paths := []string{pattern}
+	if strings.ContainsAny(pattern, "*?[") {
+		var err error
+		paths, err = filepath.Glob(pattern)
+		if err != nil {
+			return nil, lineError(src, i, fmt.Errorf("invalid include pattern '%s': %s", pattern, err))
+		}
+		sort.Strings(paths)
+	} else {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, lineError(src, i, fmt.Errorf("failed to include %s: %s", pattern, err))
+		}
+		if info.IsDir() {
+			return nil, lineError(src, i, fmt.Errorf("failed to include %s: it is a directory, use '%s/*.txt' to include its files", pattern, pattern))
+		}
+	}
+
+	var included []*source
+
+	for _, path := range paths {
+
+		// Globs might match directories.
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			continue
+		}
+
+		// Are we already reading this file?
+		for _, parent := range stack {
+			if parent == absPath(path) {
+				return nil, lineError(src, i, fmt.Errorf("include loop, %s includes itself", path))
+			}
+		}
+
+		// Files which were included elsewhere aren't read twice.
+		if c.parsed(path) {
+			continue
+		}
+
+		inc := &source{path: path}
+		c.sources = append(c.sources, inc)
+		included = append(included, inc)
+
+		err = c.parseFile(inc, append(stack, absPath(path)))
+		if err != nil {
+			var lineErr *LineError
+			if errors.As(err, &lineErr) {
+				return nil, err
+			}
+			return nil, lineError(src, i, fmt.Errorf("failed to include %s: %s", path, err))
+		}
+	}
+
+	return included, nil
+}
+
+// lineError returns an error relating to the line, of the given file, with
+// the given index.
+func lineError(src *source, i int, err error) error {
+	return &LineError{Path: src.path, Line: i + 1, Err: err}
+}
+
+// Check validates the options of each feed, returning an error for each
+// option which is unknown, or has an invalid value.
+//
+// You must call `Parse` before calling this method.
+func (c *ConfigFile) Check() []error {
+
+	if c.yaml != nil {
+		return c.yaml.check()
+	}
+
+	var errs []error
+
+	for _, src := range c.sources {
+
+		// Whether options belong to the settings section.
+		inSettings := false
+
+		for i, l := range src.lines {
+			switch {
+			case l.header:
+				inSettings = l.settings
+			case l.url != "":
+				inSettings = false
+			}
+			if l.option == nil {
+				continue
+			}
+
+			var err error
+			if inSettings {
+				err = CheckSetting(settingName(l.option.Name))
 			} else {
-				// If we have an URL show it, to help identify the section which is broken
-				if tmp.URL != "" {
-					return c.entries, fmt.Errorf("options should be of the form 'key:value', bogus entry found '%s', beneath feed %s", line, tmp.URL)
+				err = CheckOption(*l.option)
+			}
+			if err != nil {
+				errs = append(errs, lineError(src, i, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+// layout describes the feeds, and the sections, of the files as they're
+// written, before any options are inherited.
+type layout struct {
+
+	// defaults holds the options of the defaults.
+	defaults []Option
+
+	// groups holds the options of each group.
+	groups map[string][]Option
+
+	// names holds the names of the groups, in the order they appear.
+	names []string
+
+	// feeds holds the feeds, with only the options they set themselves.
+	feeds []Feed
+
+	// comments holds the comments immediately preceding each feed.
+	comments [][]string
+
+	// settings holds the global settings.
+	settings []Setting
+}
+
+// layout returns the feeds, and the sections, of the files we've read.
+func (c *ConfigFile) layout() layout {
+
+	out := layout{groups: make(map[string][]Option), feeds: []Feed{}}
+
+	// walk adds the feeds of the given file, and those it includes.
+	var walk func(src *source)
+	walk = func(src *source) {
+
+		// The group of the section we're in, whether options
+		// belong to that section, and the feed they belong to
+		// otherwise.
+		group := ""
+		inHeader := false
+		inSettings := false
+		feed := -1
+
+		// The comments which precede the current line.
+		var comments []string
+
+		for i, l := range src.lines {
+			switch {
+			case l.isComment():
+				comments = append(comments, strings.TrimSpace(l.text))
+				continue
+			case l.header:
+				group = l.group
+				inHeader = true
+				inSettings = l.settings
+				if _, ok := out.groups[group]; !ok && group != "" {
+					out.groups[group] = []Option{}
+					out.names = append(out.names, group)
 				}
-				return c.entries, fmt.Errorf("options should be of the form 'key:value', bogus entry found '%s'", line)
+			case l.option != nil && inHeader && inSettings:
+				out.settings = append(out.settings, Setting{
+					Name:  settingName(l.option.Name),
+					Value: l.option.Value,
+					Path:  src.path,
+					Line:  i + 1,
+				})
+			case l.url != "":
+				out.feeds = append(out.feeds, Feed{URL: l.url, Options: []Option{}, Group: group, File: src.path})
+				out.comments = append(out.comments, comments)
+				feed = len(out.feeds) - 1
+				inHeader = false
+			case l.option != nil && inHeader:
+				if group == "" {
+					out.defaults = append(out.defaults, *l.option)
+				} else {
+					out.groups[group] = append(out.groups[group], *l.option)
+				}
+			case l.option != nil && feed >= 0:
+				out.feeds[feed].Options = append(out.feeds[feed].Options, *l.option)
+			}
+			comments = nil
 
+			for _, inc := range l.includes {
+				walk(inc)
 			}
-		} else {
+		}
+	}
+
+	if c.main != nil {
+		walk(c.main)
+	}
+	for _, src := range c.dropins {
+		walk(src)
+	}
+
+	return out
+}
+
+// rebuild updates our list of entries from the lines of the files.
+func (c *ConfigFile) rebuild() {
+
+	if c.yaml != nil {
+		c.entries, _ = c.yaml.feeds()
+		return
+	}
+
+	l := c.layout()
+
+	// Each feed inherits the options it doesn't override.
+	c.entries = l.feeds
+	for i := range c.entries {
+		opts := inherit(l.defaults, l.groups[c.entries[i].Group])
+		c.entries[i].Options = inherit(opts, c.entries[i].Options)
+	}
+}
 
-			// If we already have a URL stored then append
-			// it and reset our temporary structure
-			if tmp.URL != "" {
-				// store it, and reset our map
-				c.entries = append(c.entries, tmp)
-				tmp.Options = []Option{}
+// inherit returns the options which result from applying the given options
+// on top of those inherited, replacing any inherited values of the options
+// which are set.
+func inherit(inherited []Option, opts []Option) []Option {
+
+	set := make(map[string]bool)
+	for _, opt := range opts {
+		set[opt.Name] = true
+	}
+
+	out := []Option{}
+	for _, opt := range inherited {
+		if !set[opt.Name] {
+			out = append(out, opt)
+		}
+	}
+	return append(out, opts...)
+}
+
+// ensureMain creates an empty main file, if we've not parsed one, so that
+// feeds may be added to it.
+func (c *ConfigFile) ensureMain() {
+	if c.main == nil {
+		c.main = &source{path: c.Path()}
+		c.sources = []*source{c.main}
+	}
+}
+
+// find returns the file, and index of the line, containing the given URL,
+// or nil if it is not present.
+func (c *ConfigFile) find(url string) (*source, int) {
+
+	for _, src := range c.sources {
+		for i, l := range src.lines {
+			if l.url == url {
+				return src, i
 			}
+		}
+	}
+	return nil, -1
+}
+
+// span returns the range of lines which belong to the feed whose URL is on
+// the given line.
+//
+// This includes the comments which immediately precede the URL, and the
+// options, along with any comments between them, which follow it.
+func (src *source) span(i int) (int, int) {
 
-			// set the url
-			tmp.URL = line
+	start := i
+	for start > 0 && src.lines[start-1].isComment() {
+		start--
+	}
+
+	end := i + 1
+	for j := i + 1; j < len(src.lines); j++ {
+		if src.lines[j].option != nil {
+			end = j + 1
+			continue
+		}
+		if !src.lines[j].isComment() {
+			break
 		}
 	}
 
-	// Ensure we don't forget about the last item in the file.
-	if tmp.URL != "" {
-		c.entries = append(c.entries, tmp)
+	return start, end
+}
+
+// insert adds the given lines at the given position.
+func (src *source) insert(at int, lines ...line) {
+	src.lines = append(src.lines[:at], append(lines, src.lines[at:]...)...)
+	src.dirty = true
+}
+
+// remove removes the lines in the given range.
+func (src *source) remove(start int, end int) {
+	src.lines = append(src.lines[:start], src.lines[end:]...)
+	src.dirty = true
+}
+
+// optionLine returns a line containing the given option, laid out in the
+// same way as the given option line, if any.
+func optionLine(like *line, opt Option) line {
+
+	text := " - " + opt.Name + ":" + opt.Value
+
+	if like != nil && like.option != nil {
+
+		// Find the prefix before the name, and the separator
+		// between the name and the value.
+		orig := like.text
+		dash := strings.Index(orig, "-")
+		rest := orig[dash+1:]
+		nameStart := dash + 1 + len(rest) - len(strings.TrimLeft(rest, " \t"))
+		colon := nameStart + strings.Index(orig[nameStart:], ":")
+		nameEnd := nameStart + len(strings.TrimRight(orig[nameStart:colon], " \t"))
+		after := orig[colon+1:]
+		valueStart := colon + 1 + len(after) - len(strings.TrimLeft(after, " \t"))
+
+		text = orig[:nameStart] + opt.Name + orig[nameEnd:valueStart] + opt.Value
 	}
 
-	// Look for scanner-errors
-	if err := scanner.Err(); err != nil {
-		return c.entries, err
+	return line{text: text, option: &Option{Name: opt.Name, Value: opt.Value}}
+}
+
+// style returns an option line to use as a model for new options added to
+// the feed whose URL is on the given line of the given file.
+//
+// We prefer the options of the feed itself, then those of the same file,
+// then those of any file.
+func (c *ConfigFile) style(src *source, i int) *line {
+
+	if src != nil && i >= 0 {
+		_, end := src.span(i)
+		if src.lines[end-1].option != nil {
+			return &src.lines[end-1]
+		}
 	}
 
-	return c.entries, nil
+	sources := c.sources
+	if src != nil {
+		sources = append([]*source{src}, sources...)
+	}
+	for _, s := range sources {
+		for j := range s.lines {
+			if s.lines[j].option != nil {
+				return &s.lines[j]
+			}
+		}
+	}
+	return nil
+}
+
+// insertionPoint returns the file, and the index of the line, at which a
+// new feed in the given group should be added, and false if there is no
+// such group.
+//
+// Feeds which don't belong to a group are added to the main file, after
+// the defaults, or before the first section, otherwise they'd inherit the
+// options of the last group in the file.
+func (c *ConfigFile) insertionPoint(group string) (*source, int, bool) {
+
+	c.ensureMain()
+
+	// Find the section the feed belongs in; if a group appears
+	// more than once we use the last.  Feeds without a group may
+	// follow the defaults, or come before any section.
+	src := c.main
+	start := -1
+	for _, s := range c.sources {
+		if group == "" && s != c.main {
+			continue
+		}
+		for i, l := range s.lines {
+			if l.header && l.group == group {
+				src = s
+				start = i
+			}
+		}
+	}
+	if start < 0 && group != "" {
+		return c.main, len(c.main.lines), false
+	}
+
+	// Find the section which follows it.
+	end := len(src.lines)
+	for i := start + 1; i < len(src.lines); i++ {
+		if src.lines[i].header {
+			end = i
+			break
+		}
+	}
+	if end == len(src.lines) {
+		return src, end, true
+	}
+
+	// Don't separate the next section from the comments, and blank
+	// lines, which precede it.
+	for end > 0 && src.lines[end-1].isComment() {
+		end--
+	}
+	for end > 0 && src.lines[end-1].isBlank() {
+		end--
+	}
+	return src, end, true
 }
 
 // Add appends the given URIs to the config-file
@@ -187,60 +885,280 @@ func (c *ConfigFile) Parse() ([]Feed, error) {
 // You must call `Save` if you wish this removal to be persisted.
 func (c *ConfigFile) Add(uris ...string) {
 
+	if y := c.structured(); y != nil {
+		for _, uri := range uris {
+			if y.find(uri) < 0 {
+				y.add(Feed{URL: uri})
+			}
+		}
+		c.rebuild()
+		return
+	}
+
 	for _, uri := range uris {
 
-		// Look to see if it is already-present.
-		found := false
-		for _, ent := range c.entries {
-			if ent.URL == uri {
-				found = true
+		// Not found?  Then we can add it.
+		if src, _ := c.find(uri); src == nil {
+			src, at, _ := c.insertionPoint("")
+			src.insert(at, line{text: uri, url: uri})
+		}
+	}
+
+	c.rebuild()
+}
+
+// AddFeed adds a new entry to our list of feeds, along with its options.
+//
+// If the feed is already present the options are appended to those it
+// already has, in the file where it is listed.  Otherwise it is added to
+// the file it names, if that is one of ours, or to the group it names,
+// which is created if necessary.  You must call `Save` if you wish this
+// addition to be persisted.
+func (c *ConfigFile) AddFeed(feed Feed) {
+
+	if y := c.structured(); y != nil {
+		y.add(feed)
+		c.rebuild()
+		return
+	}
+
+	src, i := c.find(feed.URL)
+	like := c.style(src, i)
+
+	lines := []line{}
+	if src == nil {
+		lines = append(lines, line{text: feed.URL, url: feed.URL})
+	}
+	for _, opt := range feed.Options {
+		lines = append(lines, optionLine(like, opt))
+	}
+
+	// Already present?
+	if src != nil {
+		_, end := src.span(i)
+		src.insert(end, lines...)
+		c.rebuild()
+		return
+	}
+
+	src, at, found := c.insertionPoint(feed.Group)
+
+	// Has a file been chosen?
+	if feed.File != "" && feed.Group == "" {
+		for _, s := range c.sources {
+			if absPath(s.path) == absPath(feed.File) {
+				src = s
+				at = len(s.lines)
 			}
 		}
+	}
 
-		// Not found?  Then we can add it.
+	if !found {
+		if len(src.lines) > 0 && !src.lines[len(src.lines)-1].isBlank() {
+			src.lines = append(src.lines, line{})
+		}
+		header := "[group " + feed.Group + "]"
+		src.lines = append(src.lines, line{text: header, header: true, group: feed.Group})
+		at = len(src.lines)
+	}
+	src.insert(at, lines...)
+
+	c.rebuild()
+}
+
+// SetOption sets the value of the named option on the given feed, replacing
+// any values it already has.  It returns false if the feed is not present.
+//
+// You must call `Save` if you wish this change to be persisted.
+func (c *ConfigFile) SetOption(url string, name string, value string) bool {
+
+	if y := c.structured(); y != nil {
+		i := y.find(url)
+		if i < 0 {
+			return false
+		}
+		y.set(i, Option{Name: name, Value: value})
+		c.rebuild()
+		return true
+	}
+
+	src, i := c.find(url)
+	if src == nil {
+		return false
+	}
+
+	opt := Option{Name: name, Value: value}
+
+	// Replace the first value, in place, and remove the others.
+	found := false
+	_, end := src.span(i)
+	for j := i + 1; j < end; j++ {
+		if src.lines[j].option == nil || src.lines[j].option.Name != name {
+			continue
+		}
 		if !found {
-			f := Feed{URL: uri}
-			c.entries = append(c.entries, f)
+			src.lines[j] = optionLine(&src.lines[j], opt)
+			src.dirty = true
+			found = true
+			continue
 		}
+		src.remove(j, j+1)
+		j--
+		end--
+	}
+
+	if !found {
+		src.insert(end, optionLine(c.style(src, i), opt))
 	}
+
+	c.rebuild()
+	return true
 }
 
-// Delete removes an entry from our list of feeds.
+// AppendOption adds another value for the named option to the given feed.
+// It returns false if the feed is not present.
+//
+// You must call `Save` if you wish this change to be persisted.
+func (c *ConfigFile) AppendOption(url string, name string, value string) bool {
+
+	if y := c.structured(); y != nil {
+		i := y.find(url)
+		if i < 0 {
+			return false
+		}
+		y.append(i, Option{Name: name, Value: value})
+		c.rebuild()
+		return true
+	}
+
+	src, i := c.find(url)
+	if src == nil {
+		return false
+	}
+
+	_, end := src.span(i)
+	src.insert(end, optionLine(c.style(src, i), Option{Name: name, Value: value}))
+
+	c.rebuild()
+	return true
+}
+
+// UnsetOption removes the named option from the given feed.  If value is
+// not empty only the option with that value is removed, otherwise all of
+// them are.
+//
+// It returns the number of options which were removed.  You must call
+// `Save` if you wish this change to be persisted.
+func (c *ConfigFile) UnsetOption(url string, name string, value string) int {
+
+	removed := 0
+
+	if y := c.structured(); y != nil {
+		for i := range y.feedNodes().Content {
+			if u, _, _, err := y.feed(y.feedNodes().Content[i]); err == nil && u == url {
+				removed += y.unset(i, name, value)
+			}
+		}
+		c.rebuild()
+		return removed
+	}
+
+	for _, src := range c.sources {
+		for i := 0; i < len(src.lines); i++ {
+			if src.lines[i].url != url {
+				continue
+			}
+
+			_, end := src.span(i)
+			for j := i + 1; j < end; j++ {
+				opt := src.lines[j].option
+				if opt != nil && opt.Name == name && (value == "" || opt.Value == value) {
+					src.remove(j, j+1)
+					j--
+					end--
+					removed++
+				}
+			}
+		}
+	}
+
+	c.rebuild()
+	return removed
+}
+
+// Delete removes an entry from our list of feeds, along with its options
+// and the comments which immediately precede it, from whichever file it
+// is listed in.
 //
 // You must call `Save` if you wish this removal to be persisted.
 func (c *ConfigFile) Delete(url string) {
 
-	var keep []Feed
+	if y := c.structured(); y != nil {
+		for i := y.find(url); i >= 0; i = y.find(url) {
+			y.remove(i)
+		}
+		c.rebuild()
+		return
+	}
+
+	for src, i := c.find(url); src != nil; src, i = c.find(url) {
+
+		start, end := src.span(i)
+		src.remove(start, end)
 
-	for _, ent := range c.entries {
-		if ent.URL != url {
-			keep = append(keep, ent)
+		// Avoid leaving a pair of blank lines behind.
+		if start < len(src.lines) && src.lines[start].isBlank() &&
+			(start == 0 || src.lines[start-1].isBlank()) {
+			src.remove(start, start+1)
 		}
 	}
 
-	c.entries = keep
+	c.rebuild()
 }
 
 // Save persists our list of feeds/options to disk.
+//
+// The main file is always written, the files it includes are written only
+// if they were changed.
 func (c *ConfigFile) Save() error {
 
-	// Open the file
-	file, err := os.Create(c.Path())
-	if err != nil {
-		return err
+	if y := c.structured(); y != nil {
+		return y.save()
 	}
 
-	// For each entry do the necessary
-	for _, entry := range c.entries {
+	c.ensureMain()
 
-		fmt.Fprintf(file, "%s\n", entry.URL)
+	for _, src := range c.sources {
+		if src != c.main && !src.dirty {
+			continue
+		}
 
-		for _, opt := range entry.Options {
-			fmt.Fprintf(file, " - %s:%s\n", opt.Name, opt.Value)
+		err := src.save()
+		if err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
+
+// save writes the lines of the file to disk.
+func (src *source) save() error {
+
+	// Open the file
+	file, err := os.Create(src.path)
+	if err != nil {
+		return err
+	}
 
+	// Write each line, as we read it, or as it was changed.
+	for _, l := range src.lines {
+		fmt.Fprintf(file, "%s\n", l.text)
 	}
 
 	err = file.Close()
+	if err == nil {
+		src.dirty = false
+	}
 	return err
 }
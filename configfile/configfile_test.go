@@ -247,6 +247,194 @@ func TestAdd(t *testing.T) {
 	os.Remove(c.path)
 }
 
+// TestAddFeed tests adding feeds with options
+func TestAddFeed(t *testing.T) {
+
+	c := ParserHelper(t, `
+http://example.com/
+ - foo:bar
+`)
+
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	// A new feed, and an option for an existing one.
+	c.AddFeed(Feed{URL: "https://example.net/", Options: []Option{{Name: "tag", Value: "news"}}})
+	c.AddFeed(Feed{URL: "http://example.com/", Options: []Option{{Name: "retry", Value: "3"}}})
+
+	err = c.Save()
+	if err != nil {
+		t.Fatalf("Error saving file")
+	}
+
+	out, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	if len(out) != 2 {
+		t.Fatalf("parsed wrong number of entries, got %d\n%v", len(out), out)
+	}
+	if len(out[0].Options) != 2 || out[0].Options[1].Name != "retry" {
+		t.Fatalf("options were not appended %v", out[0].Options)
+	}
+	if len(out[1].Options) != 1 || out[1].Options[0].Value != "news" {
+		t.Fatalf("options were not added %v", out[1].Options)
+	}
+
+	os.Remove(c.path)
+}
+
+// TestChangeOptions tests setting, appending, and removing options.
+func TestChangeOptions(t *testing.T) {
+
+	c := ParserHelper(t, `
+http://example.com/
+ - exclude:foo
+ - retry: 7
+ - exclude:bar
+https://example.net/
+`)
+
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	if c.SetOption("https://missing.example.com/", "retry", "1") {
+		t.Fatalf("set an option on a missing feed")
+	}
+	if !c.SetOption("http://example.com/", "exclude", "baz") {
+		t.Fatalf("failed to set an option")
+	}
+	if !c.SetOption("https://example.net/", "tag", "news") {
+		t.Fatalf("failed to set an option")
+	}
+	if !c.AppendOption("https://example.net/", "tag", "blogs") {
+		t.Fatalf("failed to append an option")
+	}
+	if n := c.UnsetOption("http://example.com/", "retry", "8"); n != 0 {
+		t.Fatalf("removed an option with a different value")
+	}
+	if n := c.UnsetOption("http://example.com/", "retry", ""); n != 1 {
+		t.Fatalf("failed to remove an option, removed %d", n)
+	}
+
+	err = c.Save()
+	if err != nil {
+		t.Fatalf("Error saving file")
+	}
+
+	out, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	if len(out[0].Options) != 1 || out[0].Options[0] != (Option{Name: "exclude", Value: "baz"}) {
+		t.Fatalf("unexpected options %v", out[0].Options)
+	}
+	if len(out[1].Options) != 2 || out[1].Options[1] != (Option{Name: "tag", Value: "blogs"}) {
+		t.Fatalf("unexpected options %v", out[1].Options)
+	}
+
+	os.Remove(c.path)
+}
+
+// TestRoundTrip ensures that comments, blank lines, and the layout of the
+// file are preserved when it is changed.
+func TestRoundTrip(t *testing.T) {
+
+	content := `# My feeds
+#
+# News
+https://example.com/
+  -   retry :  7
+  # - exclude: foo
+  -   tag :  news
+
+# Blogs
+https://example.org/
+	- tag:blogs
+
+# https://example.net/ is broken
+https://example.edu/
+`
+
+	c := ParserHelper(t, content)
+	defer os.Remove(c.path)
+
+	check := func(expected string) {
+		t.Helper()
+
+		err := c.Save()
+		if err != nil {
+			t.Fatalf("Error saving file: %s", err)
+		}
+
+		data, err := os.ReadFile(c.path)
+		if err != nil {
+			t.Fatalf("Error reading file: %s", err)
+		}
+		if string(data) != expected {
+			t.Fatalf("unexpected content, got:\n%s\nexpected:\n%s", data, expected)
+		}
+	}
+
+	out, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+	if len(out) != 3 || len(out[0].Options) != 2 || out[0].Options[1].Value != "news" {
+		t.Fatalf("unexpected entries %v", out)
+	}
+
+	// Saving without changes writes the same content.
+	check(content)
+
+	// Changes only affect the lines concerned, and new options follow
+	// the layout of the existing ones.
+	c.SetOption("https://example.com/", "retry", "3")
+	c.AppendOption("https://example.org/", "exclude", "foo")
+	c.AddFeed(Feed{URL: "https://example.edu/", Options: []Option{{Name: "frequency", Value: "60"}}})
+	c.Add("https://example.info/")
+	check(`# My feeds
+#
+# News
+https://example.com/
+  -   retry :  3
+  # - exclude: foo
+  -   tag :  news
+
+# Blogs
+https://example.org/
+	- tag:blogs
+	- exclude:foo
+
+# https://example.net/ is broken
+https://example.edu/
+  -   frequency :  60
+https://example.info/
+`)
+
+	// Deleting a feed removes the comments attached to it.
+	c.Delete("https://example.org/")
+	c.UnsetOption("https://example.com/", "tag", "")
+	check(`# My feeds
+#
+# News
+https://example.com/
+  -   retry :  3
+  # - exclude: foo
+
+# https://example.net/ is broken
+https://example.edu/
+  -   frequency :  60
+https://example.info/
+`)
+}
+
 // TestAddProperties tests adding to a file with properties doesn't fail
 func TestAddProperties(t *testing.T) {
 
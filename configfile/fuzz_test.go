@@ -4,8 +4,8 @@
 package configfile
 
 import (
+	"errors"
 	"os"
-	"strings"
 	"testing"
 )
 
@@ -14,6 +14,7 @@ func FuzzParser(f *testing.F) {
 	f.Add([]byte("https://example.com"))
 	f.Add([]byte("https://example.com\r"))
 	f.Add([]byte("https://example.com\r\n"))
+	f.Add([]byte("include *.txt\ninclude /etc/passwd\ninclude ../feeds.txt"))
 	f.Add([]byte(`
 https://example.com
   - foo:bar
@@ -23,11 +24,11 @@ https://example.com
   - bar:baz`))
 
 	f.Fuzz(func(t *testing.T, input []byte) {
-		// Create a temporary file
-		tmpfile, _ := os.CreateTemp("", "example")
 
-		// Cleanup when we're done
-		defer os.Remove(tmpfile.Name())
+		// Create a temporary file, in a directory of its own which
+		// any include lines are confined to.
+		dir := t.TempDir()
+		tmpfile, _ := os.CreateTemp(dir, "example")
 
 		// Write it out
 		_, err := tmpfile.Write(input)
@@ -39,13 +40,16 @@ https://example.com
 
 		// Create a new config-reader
 		c := NewWithPath(tmpfile.Name())
+		c.root = dir
 
 		// Parse, looking for errors
 		_, err = c.Parse()
 		if err != nil {
 
-			// This is a known error, we expect to get
-			if !strings.Contains(err.Error(), "option outside a URL") {
+			// Syntax errors are expected, and must report
+			// their location.
+			var lineErr *LineError
+			if !errors.As(err, &lineErr) {
 				t.Errorf("Input gave bad error: %s %s\n", input, err)
 			}
 
@@ -0,0 +1,178 @@
+package configfile
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestGroups tests that feeds inherit the options of the defaults, and of
+// their group.
+func TestGroups(t *testing.T) {
+
+	c := ParserHelper(t, `https://example.com/
+ - retry: 1
+
+[defaults]
+ - notify: steve@example.com
+ - exclude: sponsored
+ - retry: 3
+
+# Security feeds
+[group security]
+ - tag: security
+ - exclude: advert
+https://example.org/
+https://example.net/
+ - notify: security@example.com
+ - tag: cve
+
+[ group  news ]
+https://example.info/
+`)
+	defer os.Remove(c.path)
+
+	out, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	expected := []Feed{
+		{URL: "https://example.com/", Options: []Option{
+			{"notify", "steve@example.com"},
+			{"exclude", "sponsored"},
+			{"retry", "1"}}},
+		{URL: "https://example.org/", Group: "security", Options: []Option{
+			{"notify", "steve@example.com"},
+			{"retry", "3"},
+			{"tag", "security"},
+			{"exclude", "advert"}}},
+		{URL: "https://example.net/", Group: "security", Options: []Option{
+			{"retry", "3"},
+			{"exclude", "advert"},
+			{"notify", "security@example.com"},
+			{"tag", "cve"}}},
+		{URL: "https://example.info/", Group: "news", Options: []Option{
+			{"notify", "steve@example.com"},
+			{"exclude", "sponsored"},
+			{"retry", "3"}}},
+	}
+
+	if len(out) != len(expected) {
+		t.Fatalf("unexpected entries %v", out)
+	}
+	for i := range expected {
+		if out[i].URL != expected[i].URL || out[i].Group != expected[i].Group {
+			t.Fatalf("unexpected entry %v, expected %v", out[i], expected[i])
+		}
+		if len(out[i].Options) != len(expected[i].Options) {
+			t.Fatalf("unexpected options for %s: %v", out[i].URL, out[i].Options)
+		}
+		for j := range expected[i].Options {
+			if out[i].Options[j] != expected[i].Options[j] {
+				t.Fatalf("unexpected options for %s: %v", out[i].URL, out[i].Options)
+			}
+		}
+	}
+}
+
+// TestGroupAdd tests that new feeds are added to the right section.
+func TestGroupAdd(t *testing.T) {
+
+	c := ParserHelper(t, `# Feeds
+https://example.com/
+
+# Security feeds
+[group security]
+ - tag: security
+https://example.org/
+
+[group news]
+https://example.net/
+`)
+	defer os.Remove(c.path)
+
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	c.Add("https://one.example.com/")
+	c.AddFeed(Feed{URL: "https://two.example.com/", Group: "security"})
+	c.AddFeed(Feed{URL: "https://three.example.com/", Group: "blogs", Options: []Option{{"retry", "2"}}})
+
+	err = c.Save()
+	if err != nil {
+		t.Fatalf("Error saving file")
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		t.Fatalf("Error reading file")
+	}
+
+	expected := `# Feeds
+https://example.com/
+https://one.example.com/
+
+# Security feeds
+[group security]
+ - tag: security
+https://example.org/
+https://two.example.com/
+
+[group news]
+https://example.net/
+
+[group blogs]
+https://three.example.com/
+ - retry: 2
+`
+	if string(data) != expected {
+		t.Fatalf("unexpected content:\n%s", data)
+	}
+
+	// The defaults are used for feeds without a group, if present.
+	c = ParserHelper(t, `[defaults]
+ - retry: 2
+https://example.com/
+
+[group news]
+https://example.net/
+`)
+	defer os.Remove(c.path)
+
+	_, err = c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+	c.Add("https://one.example.com/")
+	if c.Save() != nil {
+		t.Fatalf("Error saving file")
+	}
+	data, _ = os.ReadFile(c.path)
+	if !strings.HasPrefix(string(data), "[defaults]\n - retry: 2\nhttps://example.com/\nhttps://one.example.com/\n\n[group news]") {
+		t.Fatalf("unexpected content:\n%s", data)
+	}
+}
+
+// TestBrokenSections tests errors in section headers.
+func TestBrokenSections(t *testing.T) {
+
+	for _, content := range []string{
+		"[feeds]\n",
+		"[group]\n",
+		"[group news]\n\n - tag: news\n",
+	} {
+		c := ParserHelper(t, content)
+		_, err := c.Parse()
+		os.Remove(c.path)
+
+		if err == nil {
+			t.Fatalf("expected an error parsing %q", content)
+		}
+		if !strings.HasPrefix(err.Error(), c.path+":") {
+			t.Fatalf("error doesn't contain the location %s", err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the given files, relative to a temporary directory,
+// and returns the path of that directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("failed to create directory: %s", err)
+		}
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("failed to write %s: %s", path, err)
+		}
+	}
+	return dir
+}
+
+// TestInclude tests that included files, and those in feeds.d, are read.
+func TestInclude(t *testing.T) {
+
+	dir := writeFiles(t, map[string]string{
+		"feeds.txt": `https://one.example.com/
+include security.txt
+include teams/*.txt
+include missing/*.txt
+https://two.example.com/
+`,
+		"security.txt": `[group security]
+ - tag: security
+https://security.example.com/
+include nested/more.txt
+`,
+		"nested/more.txt": `https://nested.example.com/
+ - retry: 2
+`,
+		"teams/b.txt":    "https://b.example.com/\n",
+		"teams/a.txt":    "https://a.example.com/\n",
+		"feeds.d/x.txt":  "https://dropin.example.com/\n",
+		"feeds.d/y.conf": "https://ignored.example.com/\n",
+	})
+
+	c := NewWithPath(filepath.Join(dir, "feeds.txt"))
+	out, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	expected := []struct {
+		url   string
+		file  string
+		group string
+	}{
+		{"https://one.example.com/", "feeds.txt", ""},
+		{"https://security.example.com/", "security.txt", "security"},
+		{"https://nested.example.com/", "nested/more.txt", ""},
+		{"https://a.example.com/", "teams/a.txt", ""},
+		{"https://b.example.com/", "teams/b.txt", ""},
+		{"https://two.example.com/", "feeds.txt", ""},
+		{"https://dropin.example.com/", "feeds.d/x.txt", ""},
+	}
+
+	if len(out) != len(expected) {
+		t.Fatalf("unexpected entries %v", out)
+	}
+	for i, e := range expected {
+		if out[i].URL != e.url || out[i].File != filepath.Join(dir, e.file) || out[i].Group != e.group {
+			t.Fatalf("unexpected entry %v, expected %v", out[i], e)
+		}
+	}
+
+	// Sections don't extend beyond the file they're in.
+	if len(out[2].Options) != 1 || out[2].Options[0].Name != "retry" {
+		t.Fatalf("unexpected options %v", out[2].Options)
+	}
+
+	if len(c.Files()) != 6 {
+		t.Fatalf("unexpected files %v", c.Files())
+	}
+}
+
+// TestIncludeChanges tests that changes are made to the file in which a
+// feed is listed.
+func TestIncludeChanges(t *testing.T) {
+
+	dir := writeFiles(t, map[string]string{
+		"feeds.txt": `# Main
+https://one.example.com/
+include other.txt
+`,
+		"other.txt": `# Other
+https://two.example.com/
+ - retry: 2
+https://three.example.com/
+`,
+		"unchanged.txt": "https://four.example.com/\n",
+	})
+
+	c := NewWithPath(filepath.Join(dir, "feeds.txt"))
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	c.Delete("https://three.example.com/")
+	c.SetOption("https://two.example.com/", "retry", "5")
+	c.Add("https://five.example.com/")
+
+	err = c.Save()
+	if err != nil {
+		t.Fatalf("Error saving: %s", err)
+	}
+
+	for name, expected := range map[string]string{
+		"feeds.txt":     "# Main\nhttps://one.example.com/\ninclude other.txt\nhttps://five.example.com/\n",
+		"other.txt":     "# Other\nhttps://two.example.com/\n - retry: 5\n",
+		"unchanged.txt": "https://four.example.com/\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", name, err)
+		}
+		if string(data) != expected {
+			t.Fatalf("unexpected content in %s:\n%s", name, data)
+		}
+	}
+}
+
+// TestIncludeErrors tests errors are reported with the file and line at
+// which they occur.
+func TestIncludeErrors(t *testing.T) {
+
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{
+				"feeds.txt": "https://example.com/\ninclude missing.txt\n",
+			},
+			"feeds.txt:2: failed to include",
+		},
+		{
+			map[string]string{
+				"feeds.txt": "include a.txt\n",
+				"a.txt":     "# A\ninclude b.txt\n",
+				"b.txt":     "https://example.com/\ninclude a.txt\n",
+			},
+			"b.txt:2: include loop",
+		},
+		{
+			map[string]string{
+				"feeds.txt": "include self.txt\n",
+				"self.txt":  "include self.txt\n",
+			},
+			"self.txt:1: include loop",
+		},
+		{
+			map[string]string{
+				"feeds.txt": "include a.txt\n",
+				"a.txt":     "https://example.com/\n\n - retry: 2\n",
+			},
+			"a.txt:3: option outside a URL",
+		},
+	}
+
+	for _, test := range tests {
+		dir := writeFiles(t, test.files)
+
+		c := NewWithPath(filepath.Join(dir, "feeds.txt"))
+		_, err := c.Parse()
+		if err == nil {
+			t.Fatalf("expected an error with %v", test.files)
+		}
+		if !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("expected '%s', got %s", test.expected, err)
+		}
+	}
+
+	// Problems found when checking report the file too.
+	dir := writeFiles(t, map[string]string{
+		"feeds.txt": "include a.txt\n",
+		"a.txt":     "https://example.com/\n - frequncy: 5\n",
+	})
+	c := NewWithPath(filepath.Join(dir, "feeds.txt"))
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+	errs := c.Check()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "a.txt:2: unknown option") {
+		t.Fatalf("unexpected problems %v", errs)
+	}
+}
+
+// TestIncludeRoot ensures files outside our root directory can't be
+// included, if one is set.
+func TestIncludeRoot(t *testing.T) {
+
+	dir := writeFiles(t, map[string]string{
+		"feeds.txt": "include a.txt\n",
+		"a.txt":     "https://example.com/\n",
+	})
+
+	c := NewWithPath(filepath.Join(dir, "feeds.txt"))
+	c.root = dir
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	for _, include := range []string{"../feeds.txt", "/etc/*"} {
+		err = os.WriteFile(filepath.Join(dir, "feeds.txt"), []byte("include "+include+"\n"), 0644)
+		if err != nil {
+			t.Fatalf("Error writing file: %v", err)
+		}
+
+		_, err = c.Parse()
+		if err == nil || !strings.Contains(err.Error(), "feeds.txt:1: failed to include") {
+			t.Fatalf("expected an error including %s, got %v", include, err)
+		}
+	}
+}
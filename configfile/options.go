@@ -0,0 +1,267 @@
+package configfile
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/skx/rss2email/state"
+	"github.com/skx/rss2email/withstate"
+)
+
+// OptionInfo describes one of the per-feed options we support.
+type OptionInfo struct {
+
+	// Name is the name of the option.
+	Name string
+
+	// Purpose describes the option, it may contain several lines.
+	Purpose string
+
+	// Check validates a value of the option, if it is not nil.
+	Check func(value string) error
+}
+
+// KnownOptions contains the per-feed options we support, sorted by name.
+//
+// This is the source of the documentation shown by the config
+// sub-command, so keep the descriptions brief.
+var KnownOptions = []OptionInfo{
+	{"bcc", `Comma-delimited list of emails to send hidden copies to, this implies
+"delivery: single".`, checkEmails},
+	{"cc", `Comma-delimited list of emails to send copies to, this implies
+"delivery: single".`, checkEmails},
+	{"delay", `The amount of time to sleep before retrying a failed HTTP-fetch
+in seconds - "retry" configures the number of attempts to be made.`, checkInt},
+	{"delivery", `"separate" (the default) sends a message to each recipient, and
+"single" sends one message, addressed to all of them.`, checkDelivery},
+	{"digest", `Send a single email containing all new items found in the feed,
+rather than an email per item.  Enable by setting to "true", or "yes".`, checkBool},
+	{"digest-schedule", `Queue new items, and send them as a single digest on a schedule.
+e.g. "daily@08:00", "weekly@mon", or "weekly@fri@17:30".`, checkSchedule},
+	{"exclude", `Exclude any item which matches the given regular-expression.`, checkRegexp},
+	{"exclude-title", `Exclude any item with a title matching the given regular-expression.`, checkRegexp},
+	{"exclude-older", `Exclude any items whose publication date is older than the
+specified number of days.`, checkNumber},
+	{"from", `The address from which emails are sent, by default the recipient.`, checkEmail},
+	{"frequency", `How frequently to poll this feed, in minutes.`, checkInt},
+	{"identity", `How to recognise items we've seen before: "link" (the default),
+"guid", "normalized-link", or "hash" (of the title and content).`, checkIdentity},
+	{"include", `Include only items which match the given regular-expression.`, checkRegexp},
+	{"include-title", `Include only items with a title matching the given regular-expression.`, checkRegexp},
+	{"insecure", `Ignore TLS failures when fetching feeds over https.
+Disable the checks by setting this value to "true", or "yes".`, checkBool},
+	{"notify", `Comma-delimited list of emails to send notifications to (if set,
+replaces the emails specified in the cron/daemon command-line).`, checkEmails},
+	{"notify-updates", `Send an email, showing the changes, when an item is updated after
+we first saw it.  Enable by setting to "true", or "yes".`, checkBool},
+	{"prune-grace", `How long an item must be missing from the feed before we forget
+it, as a number of fetches ("3"), or a time ("12h", "7d").`, checkGrace},
+	{"reply-to", `The address to which replies to emails should be sent.`, checkEmails},
+	{"retry", `The maximum number of times to retry a failing HTTP-fetch.`, checkInt},
+	{"sender", `The envelope sender of emails, by default the "from" address.`, checkEmail},
+	{"sleep", `Sleep the specified number of seconds, before making the request.`, checkInt},
+	{"tag", `Setup a tag for this feed, which can be accessed in the template.`, nil},
+	{"template", `The path to a feed-specific email template to use.`, checkTemplate},
+	{"user-agent", `Configure a specific User-Agent when making HTTP requests.`, nil},
+}
+
+// checkInt ensures the value is a non-negative integer.
+func checkInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("'%s' is not a number", value)
+	}
+	return nil
+}
+
+// checkNumber ensures the value is a non-negative number, which may be
+// fractional.
+func checkNumber(value string) error {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("'%s' is not a number", value)
+	}
+	return nil
+}
+
+// checkBool ensures the value is one of those we treat as a boolean.
+func checkBool(value string) error {
+	switch strings.ToLower(value) {
+	case "true", "yes", "false", "no":
+		return nil
+	}
+	return fmt.Errorf("'%s' is not one of \"true\", \"yes\", \"false\", or \"no\"", value)
+}
+
+// checkRegexp ensures the value is a valid regular expression.
+func checkRegexp(value string) error {
+	_, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression: %s", err)
+	}
+	return nil
+}
+
+// checkEmails ensures the value is a comma-separated list of email
+// addresses.
+func checkEmails(value string) error {
+	for _, addr := range strings.Split(value, ",") {
+		_, err := mail.ParseAddress(strings.TrimSpace(addr))
+		if err != nil {
+			return fmt.Errorf("invalid email address '%s'", strings.TrimSpace(addr))
+		}
+	}
+	return nil
+}
+
+// checkEmail ensures the value is a single email address.
+func checkEmail(value string) error {
+	_, err := mail.ParseAddress(value)
+	if err != nil {
+		return fmt.Errorf("invalid email address '%s'", value)
+	}
+	return nil
+}
+
+// checkDelivery ensures the value is one of our delivery modes.
+func checkDelivery(value string) error {
+	switch strings.ToLower(value) {
+	case "separate", "single":
+		return nil
+	}
+	return fmt.Errorf("'%s' is not one of \"separate\", or \"single\"", value)
+}
+
+// checkTemplate ensures the value names a template within our state
+// directory.
+func checkTemplate(value string) error {
+	path := filepath.Join(state.Directory(), value)
+	_, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("template %s is not readable: %s", path, err)
+	}
+	return nil
+}
+
+// checkSchedule ensures the value is a digest schedule.
+func checkSchedule(value string) error {
+	_, err := ParseSchedule(value)
+	return err
+}
+
+// checkGrace ensures the value is a grace period.
+func checkGrace(value string) error {
+	_, err := ParseGrace(value)
+	return err
+}
+
+// checkIdentity ensures the value is one of the strategies used to
+// identify feed items.
+func checkIdentity(value string) error {
+	if !slices.Contains(withstate.Identities, value) {
+		return fmt.Errorf("unknown identity '%s', valid choices are %v", value, withstate.Identities)
+	}
+	return nil
+}
+
+// lookupOption returns the details of the named option, or nil if it is
+// not one we support.
+func lookupOption(name string) *OptionInfo {
+
+	for i := range KnownOptions {
+		if KnownOptions[i].Name == name {
+			return &KnownOptions[i]
+		}
+	}
+	return nil
+}
+
+// CheckOption ensures the given option is one we support, and that its
+// value is valid.  If the name is unknown we suggest the closest known
+// name, to help with typos.
+func CheckOption(opt Option) error {
+
+	info := lookupOption(opt.Name)
+	if info == nil {
+		if suggestion := closest(opt.Name, optionNames()); suggestion != "" {
+			return fmt.Errorf("unknown option '%s', did you mean '%s'?", opt.Name, suggestion)
+		}
+		return fmt.Errorf("unknown option '%s'", opt.Name)
+	}
+
+	if info.Check != nil {
+		err := info.Check(opt.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for option '%s': %s", info.Name, err)
+		}
+	}
+	return nil
+}
+
+// optionNames returns the names of the known options.
+func optionNames() []string {
+	var names []string
+	for _, opt := range KnownOptions {
+		names = append(names, opt.Name)
+	}
+	return names
+}
+
+// closest returns the one of the given names which is closest to the
+// given name, if it is close enough to be a likely typo.
+func closest(name string, names []string) string {
+
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	best := ""
+	bestDistance := 0
+	for _, candidate := range names {
+		d := distance(name, strings.ToLower(candidate))
+		if best == "" || d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+
+	// Allow roughly one mistake in every three characters.
+	if bestDistance > 2 && bestDistance > len(name)/3 {
+		return ""
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between the given strings.
+func distance(a string, b string) int {
+
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// IsKnownOption returns true if the given name is that of a per-feed
+// option we support.
+func IsKnownOption(name string) bool {
+	return lookupOption(name) != nil
+}
@@ -0,0 +1,123 @@
+package configfile
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCheckOption tests the validation of individual options.
+func TestCheckOption(t *testing.T) {
+
+	valid := []Option{
+		{"retry", "3"},
+		{"exclude-older", "1.5"},
+		{"insecure", "Yes"},
+		{"exclude", "(?i)cake"},
+		{"notify", "steve@example.com, Bob <bob@example.com>"},
+		{"tag", "anything"},
+		{"digest-schedule", "weekly@mon@09:30"},
+		{"identity", "guid"},
+		{"prune-grace", "7d"},
+	}
+	for _, opt := range valid {
+		err := CheckOption(opt)
+		if err != nil {
+			t.Fatalf("unexpected error with %v: %s", opt, err)
+		}
+	}
+
+	invalid := map[Option]string{
+		{"retry", "three"}:            "not a number",
+		{"frequency", "-5"}:           "not a number",
+		{"digest", "maybe"}:           "is not one of",
+		{"exclude-title", "(cake"}:    "invalid regular expression",
+		{"notify", "steve"}:           "invalid email address 'steve'",
+		{"template", "missing.tmpl"}:  "not readable",
+		{"frequncy", "60"}:            "did you mean 'frequency'?",
+		{"exlude-title", "cake"}:      "did you mean 'exclude-title'?",
+		{"colour", "blue"}:            "unknown option 'colour'",
+		{"Tag", "anything"}:           "did you mean 'tag'?",
+		{"Exclude-Title", "cake"}:     "did you mean 'exclude-title'?",
+		{"digest-schedule", "daily@"}: "invalid time",
+		{"identity", "title"}:         "unknown identity 'title'",
+		{"prune-grace", "soon"}:       "invalid grace period",
+	}
+	for opt, expected := range invalid {
+		err := CheckOption(opt)
+		if err == nil {
+			t.Fatalf("expected an error with %v", opt)
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected '%s' in error for %v, got %s", expected, opt, err)
+		}
+	}
+
+	// Nothing should be suggested for something completely different.
+	if strings.Contains(CheckOption(Option{"colour", "blue"}).Error(), "did you mean") {
+		t.Fatalf("unexpected suggestion")
+	}
+}
+
+// TestCheck tests that problems are reported with their line numbers.
+func TestCheck(t *testing.T) {
+
+	c := ParserHelper(t, `# Comment
+https://example.com/
+ - retry: 3
+ - frequncy: 60
+
+https://example.org/
+ - exclude: (broken
+`)
+	defer os.Remove(c.path)
+
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Error parsing file: %v", err)
+	}
+
+	errs := c.Check()
+	if len(errs) != 2 {
+		t.Fatalf("expected two problems, got %v", errs)
+	}
+	if !strings.HasPrefix(errs[0].Error(), c.path+":4: unknown option 'frequncy'") {
+		t.Fatalf("unexpected error %s", errs[0])
+	}
+	if !strings.HasPrefix(errs[1].Error(), c.path+":7: invalid value for option 'exclude'") {
+		t.Fatalf("unexpected error %s", errs[1])
+	}
+
+	// Syntax errors have line numbers too.
+	c = ParserHelper(t, `https://example.com/
+ - retry: 3
+
+ - frequency: 60
+`)
+	defer os.Remove(c.path)
+
+	_, err = c.Parse()
+	if err == nil || !strings.HasPrefix(err.Error(), c.path+":4: option outside a URL") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestDistance tests our edit-distance function.
+func TestDistance(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		d    int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"retry", "retry", 0},
+		{"frequncy", "frequency", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, test := range tests {
+		if d := distance(test.a, test.b); d != test.d {
+			t.Fatalf("distance(%s, %s) = %d, expected %d", test.a, test.b, d, test.d)
+		}
+	}
+}
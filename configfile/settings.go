@@ -0,0 +1,126 @@
+package configfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Setting is a global setting, read from a configuration file.
+type Setting struct {
+
+	// Name is the name of the setting, which is the same as the name
+	// of the environmental variable which may be used instead.
+	Name string
+
+	// Value holds the value of the setting.
+	Value string
+
+	// Path is the path to the file in which the setting was found.
+	Path string
+
+	// Line is the line of the file on which the setting was found.
+	Line int
+}
+
+// SettingInfo describes a global setting.
+type SettingInfo struct {
+
+	// Name is the name of the setting, which is also the name of the
+	// environmental variable which may be used to set it.
+	Name string
+
+	// Purpose describes the setting.
+	Purpose string
+
+	// Default describes the value used if the setting isn't set.
+	Default string
+
+	// Secret is set if the value shouldn't be shown.  Secrets may also
+	// be read from a file, or the output of a command, via the settings
+	// of the same name with a "_FILE", or "_COMMAND", suffix.  Those
+	// aren't shown either, as commands often contain tokens.
+	Secret bool
+}
+
+// KnownSettings holds the global settings we support, sorted by name.
+var KnownSettings = []SettingInfo{
+	{"FROM", "The From address of emails, by default the recipient.", "", false},
+	{"LOG_ALL", "Legacy, show all log messages, as LOG_LEVEL=debug.", "", false},
+	{"LOG_FILE_DISABLE", "Don't write log messages to a file.", "", false},
+	{"LOG_FILE_PATH", "The file to which log messages are written.", "rss2email.log", false},
+	{"LOG_JSON", "Write log messages in JSON format.", "", false},
+	{"LOG_LEVEL", "The level of log messages to show: debug, warn, or error.", "warn", false},
+	{"PRUNE_GRACE", "How long missing items are remembered.", "24h", false},
+	{"SENDER", "The envelope sender of emails, by default the From address.", "", false},
+	{"SENDMAIL_COMMAND", "The command which delivers email, if SMTP isn't used.", "/usr/sbin/sendmail -i -f {{.Sender}} {{.Recipients}}", false},
+	{"SENDMAIL_TIMEOUT", "The longest we wait for the sendmail command.", "60s", false},
+	{"SLEEP", "Minutes the daemon waits between polling the feeds.", "15", false},
+	{"SMTP_AUTH", "SMTP authentication: plain, login, cram-md5, or xoauth2.", "plain", false},
+	{"SMTP_CA_FILE", "A file of CA certificates, to verify the SMTP server.", "", false},
+	{"SMTP_CLIENT_CERT", "A client certificate to present to the SMTP server.", "", false},
+	{"SMTP_CLIENT_KEY", "The key of the SMTP client certificate.", "", false},
+	{"SMTP_HOST", "The SMTP server through which email is sent.", "", false},
+	{"SMTP_INSECURE", "Don't verify the certificate of the SMTP server.", "", false},
+	{"SMTP_MAX_MESSAGES", "Messages sent over one SMTP connection, 0 for no limit.", "100", false},
+	{"SMTP_OAUTH_CLIENT_ID", "The OAuth2 client ID, used to refresh XOAUTH2 tokens.", "", false},
+	{"SMTP_OAUTH_CLIENT_SECRET", "The OAuth2 client secret, used to refresh XOAUTH2 tokens.", "", true},
+	{"SMTP_OAUTH_REFRESH_TOKEN", "The OAuth2 refresh token, used to fetch XOAUTH2 tokens.", "", true},
+	{"SMTP_OAUTH_TOKEN_URL", "The OAuth2 endpoint from which XOAUTH2 tokens come.", "", false},
+	{"SMTP_PASSWORD", "The password for the SMTP server.", "", true},
+	{"SMTP_PORT", "The port of the SMTP server, 465 for implicit TLS.", "587", false},
+	{"SMTP_TLS", "How to secure SMTP: implicit, starttls, or none.", "", false},
+	{"SMTP_USERNAME", "The username for the SMTP server.", "", false},
+}
+
+// AllSettings returns the global settings we support, including the
+// "_FILE" and "_COMMAND" forms of each secret, which are secret too.
+func AllSettings() []SettingInfo {
+
+	var out []SettingInfo
+	for _, s := range KnownSettings {
+		out = append(out, s)
+		if s.Secret {
+			out = append(out,
+				SettingInfo{Name: s.Name + "_COMMAND", Purpose: "A command whose output is used as " + s.Name + ".", Secret: true},
+				SettingInfo{Name: s.Name + "_FILE", Purpose: "A file whose content is used as " + s.Name + ".", Secret: true})
+		}
+	}
+	return out
+}
+
+// settingName converts the name of a setting to the form of the
+// environmental variable it replaces, so "smtp_host", "smtp-host", and
+// "SMTP_HOST" are equivalent.
+func settingName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), "-", "_"))
+}
+
+// CheckSetting returns an error if the given setting is unknown.
+func CheckSetting(name string) error {
+
+	var names []string
+	for _, s := range AllSettings() {
+		if s.Name == name {
+			return nil
+		}
+		names = append(names, s.Name)
+	}
+
+	if suggestion := closest(name, names); suggestion != "" {
+		return fmt.Errorf("unknown setting '%s', did you mean '%s'?", name, suggestion)
+	}
+	return fmt.Errorf("unknown setting '%s'", name)
+}
+
+// Settings returns the global settings from the configuration file, which
+// are found in the settings section of a structured file, or in the
+// "[settings]" sections of the plain-text files.
+//
+// You must call `Parse` before calling this method.
+func (c *ConfigFile) Settings() ([]Setting, error) {
+
+	if c.yaml != nil {
+		return c.yaml.settings()
+	}
+	return c.layout().settings, nil
+}
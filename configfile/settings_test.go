@@ -0,0 +1,102 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSettings ensures settings are read from the plain-text format, and
+// don't affect the feeds.
+func TestSettings(t *testing.T) {
+
+	c := ParserHelper(t, `[settings]
+ - smtp-host: smtp.example.com
+ - Sleep: 30
+https://example.com/
+ - retry: 3
+
+[defaults]
+ - tag: all
+`)
+	defer os.Remove(c.path)
+
+	entries, err := c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(entries) != 1 || entries[0].Group != "" || len(entries[0].Options) != 2 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	settings, err := c.Settings()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(settings) != 2 ||
+		settings[0] != (Setting{Name: "SMTP_HOST", Value: "smtp.example.com", Path: c.path, Line: 2}) ||
+		settings[1] != (Setting{Name: "SLEEP", Value: "30", Path: c.path, Line: 3}) {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+
+	if len(c.Check()) != 0 {
+		t.Fatalf("unexpected problems %v", c.Check())
+	}
+}
+
+// TestCheckSetting ensures unknown settings are reported, and the closest
+// known setting suggested.
+func TestCheckSetting(t *testing.T) {
+
+	c := ParserHelper(t, `[settings]
+ - smtp_hots: smtp.example.com
+ - colour: blue
+https://example.com/
+ - smtp_host: not a setting
+`)
+	defer os.Remove(c.path)
+
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	problems := c.Check()
+	if len(problems) != 3 ||
+		!strings.HasSuffix(problems[0].Error(), ":2: unknown setting 'SMTP_HOTS', did you mean 'SMTP_HOST'?") ||
+		!strings.HasSuffix(problems[1].Error(), ":3: unknown setting 'COLOUR'") ||
+		!strings.HasSuffix(problems[2].Error(), ":5: unknown option 'smtp_host'") {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+}
+
+// TestConvertSettings ensures settings are converted to the structured
+// format, without replacing those already present.
+func TestConvertSettings(t *testing.T) {
+
+	dir := writeFiles(t, map[string]string{
+		"feeds.txt":   "[settings]\n - sleep: 5\n - smtp_host: smtp.example.com\n",
+		"config.yaml": "settings:\n  sleep: 30\n",
+	})
+
+	c := NewWithPath(filepath.Join(dir, "feeds.txt"))
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = c.WriteYAML(filepath.Join(dir, "config.yaml"), false)
+	if err != nil {
+		t.Fatalf("failed to convert: %s", err)
+	}
+
+	settings, err := ReadSettings(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(settings) != 2 || settings[0].Value != "30" || settings[1].Name != "SMTP_HOST" {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+}
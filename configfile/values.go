@@ -0,0 +1,144 @@
+package configfile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is the value of a "digest-schedule" option, which describes
+// when a scheduled digest should be sent.
+//
+// The supported forms are:
+//
+//	daily            - Every day, at midnight.
+//	daily@08:00      - Every day, at the given time.
+//	weekly@mon       - Every week, on the given day at midnight.
+//	weekly@mon@08:00 - Every week, on the given day and time.
+type Schedule struct {
+
+	// Weekly is true if the digest is sent once a week.
+	Weekly bool
+
+	// Day is the day of the week, for weekly schedules.
+	Day time.Weekday
+
+	// Hour and Minute of the day at which the digest is sent.
+	Hour   int
+	Minute int
+}
+
+// days maps the (abbreviated) names of days to their values.
+var days = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseSchedule parses the value of a "digest-schedule" option.
+func ParseSchedule(value string) (Schedule, error) {
+
+	fields := strings.Split(strings.ToLower(strings.TrimSpace(value)), "@")
+
+	s := Schedule{}
+
+	// The time, if any, is the last field.
+	clock := ""
+	timed := false
+
+	switch fields[0] {
+	case "daily":
+		if len(fields) > 2 {
+			return s, fmt.Errorf("invalid daily schedule '%s'", value)
+		}
+		if len(fields) == 2 {
+			clock = fields[1]
+			timed = true
+		}
+	case "weekly":
+		if len(fields) < 2 || len(fields) > 3 {
+			return s, fmt.Errorf("invalid weekly schedule '%s', expected weekly@day", value)
+		}
+
+		// Allow "monday" as well as "mon".
+		name := fields[1]
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		day, ok := days[name]
+		if !ok {
+			return s, fmt.Errorf("invalid day '%s' in schedule '%s'", fields[1], value)
+		}
+		s.Weekly = true
+		s.Day = day
+
+		if len(fields) == 3 {
+			clock = fields[2]
+			timed = true
+		}
+	default:
+		return s, fmt.Errorf("invalid schedule '%s', expected daily@HH:MM or weekly@day", value)
+	}
+
+	if timed {
+		t, err := time.Parse("15:04", clock)
+		if err != nil {
+			return s, fmt.Errorf("invalid time '%s' in schedule '%s'", clock, value)
+		}
+		s.Hour = t.Hour()
+		s.Minute = t.Minute()
+	}
+
+	return s, nil
+}
+
+// Grace is the value of a "prune-grace" option, which describes how long
+// an item must be missing from its feed before it is forgotten.
+type Grace struct {
+
+	// Fetches is the number of consecutive fetches from which the item
+	// must be missing.
+	Fetches int
+
+	// Period is the length of time for which the item must be missing.
+	Period time.Duration
+}
+
+// ParseGrace parses a grace period, which is either a number of fetches,
+// such as "3", or a length of time such as "12h" or "7d".
+//
+// A value of "0" disables the grace period entirely.
+func ParseGrace(value string) (Grace, error) {
+
+	value = strings.TrimSpace(value)
+
+	// A number of fetches.
+	n, err := strconv.Atoi(value)
+	if err == nil {
+		if n < 0 {
+			return Grace{}, fmt.Errorf("invalid grace period '%s'", value)
+		}
+		return Grace{Fetches: n}, nil
+	}
+
+	// A number of days.
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil || days < 0 {
+			return Grace{}, fmt.Errorf("invalid grace period '%s'", value)
+		}
+		return Grace{Period: time.Duration(days * float64(24*time.Hour))}, nil
+	}
+
+	// Otherwise a duration.
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return Grace{}, fmt.Errorf("invalid grace period '%s'", value)
+	}
+	return Grace{Period: d}, nil
+}
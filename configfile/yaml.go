@@ -0,0 +1,644 @@
+package configfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skx/rss2email/state"
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLPath returns the path to the structured configuration file.
+func YAMLPath() string {
+	return filepath.Join(state.Directory(), "config.yaml")
+}
+
+// isYAML returns true if the given path is a structured configuration
+// file, rather than a plain-text list of feeds.
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// hasFeeds returns true if the given structured configuration file exists
+// and lists feeds, in which case it is used instead of the plain-text file.
+func hasFeeds(path string) bool {
+	y, err := readYAML(path)
+	return err == nil && lookup(y.root(), "feeds") != nil
+}
+
+// yamlFile is a structured configuration file.
+//
+// We keep the document as a tree of nodes, rather than decoding it into
+// a structure, so that the comments, and the order of the keys, are
+// preserved when the file is changed.
+type yamlFile struct {
+
+	// path is the path to the file.
+	path string
+
+	// doc is the document we read.
+	doc yaml.Node
+}
+
+// readYAML reads the given structured configuration file.
+func readYAML(path string) (*yamlFile, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	y := &yamlFile{path: path}
+	err = yaml.Unmarshal(data, &y.doc)
+	if err != nil {
+		line, msg := yamlError(err)
+		return nil, &LineError{Path: path, Line: line, Err: errors.New(msg)}
+	}
+
+	return y, nil
+}
+
+// yamlError returns the line number reported by a YAML syntax error, or
+// zero if there isn't one, and the description of the problem.
+func yamlError(err error) (int, string) {
+
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+
+	n := 0
+	_, scanErr := fmt.Sscanf(msg, "line %d:", &n)
+	if scanErr == nil {
+		_, msg, _ = strings.Cut(msg, ": ")
+	}
+	return n, msg
+}
+
+// root returns the mapping at the top of the document, creating it if the
+// document is empty.
+func (y *yamlFile) root() *yaml.Node {
+	if y.doc.Kind != yaml.DocumentNode || len(y.doc.Content) == 0 {
+		y.doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	return y.doc.Content[0]
+}
+
+// errorAt returns an error relating to the given node.
+func (y *yamlFile) errorAt(n *yaml.Node, format string, args ...any) error {
+	return &LineError{Path: y.path, Line: n.Line, Err: fmt.Errorf(format, args...)}
+}
+
+// lookup returns the value of the given key of a mapping, or nil if it
+// isn't present.
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// store sets the value of the given key of a mapping, replacing any value
+// it already has.
+func store(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, scalar(key), value)
+}
+
+// discard removes the given key from a mapping.
+func discard(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// scalar returns a node holding the given string.
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// optionsNode returns a mapping holding the given options, an option with
+// several values is stored as a list.
+func optionsNode(opts []Option) *yaml.Node {
+
+	m := &yaml.Node{Kind: yaml.MappingNode}
+	for _, opt := range opts {
+		value := lookup(m, opt.Name)
+		switch {
+		case value == nil:
+			store(m, opt.Name, scalar(opt.Value))
+		case value.Kind == yaml.SequenceNode:
+			value.Content = append(value.Content, scalar(opt.Value))
+		default:
+			store(m, opt.Name, &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{value, scalar(opt.Value)}})
+		}
+	}
+	return m
+}
+
+// options returns the options held in the given mapping, and the node
+// holding each value.
+func (y *yamlFile) options(m *yaml.Node) ([]Option, []*yaml.Node, error) {
+
+	opts := []Option{}
+	var nodes []*yaml.Node
+
+	if m == nil || m.Tag == "!!null" {
+		return opts, nodes, nil
+	}
+	if m.Kind != yaml.MappingNode {
+		return nil, nil, y.errorAt(m, "options should be a mapping of names to values")
+	}
+
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		name := m.Content[i].Value
+
+		values := []*yaml.Node{m.Content[i+1]}
+		if m.Content[i+1].Kind == yaml.SequenceNode {
+			values = m.Content[i+1].Content
+		}
+
+		for _, v := range values {
+			if v.Kind != yaml.ScalarNode {
+				return nil, nil, y.errorAt(v, "the value of option '%s' should be a string, or a list of strings", name)
+			}
+			opts = append(opts, Option{Name: name, Value: v.Value})
+			nodes = append(nodes, v)
+		}
+	}
+
+	return opts, nodes, nil
+}
+
+// feedNodes returns the list of feeds, which is created if necessary.
+func (y *yamlFile) feedNodes() *yaml.Node {
+
+	root := y.root()
+	list := lookup(root, "feeds")
+	if list == nil || list.Kind != yaml.SequenceNode {
+		list = &yaml.Node{Kind: yaml.SequenceNode}
+		store(root, "feeds", list)
+	}
+	return list
+}
+
+// feed returns the URL, group, and options, of the given entry in the list
+// of feeds.  An entry may be a mapping, or just the URL.
+func (y *yamlFile) feed(n *yaml.Node) (string, string, *yaml.Node, error) {
+
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, "", nil, nil
+	}
+	if n.Kind != yaml.MappingNode {
+		return "", "", nil, y.errorAt(n, "feeds should be URLs, or mappings containing an 'url'")
+	}
+
+	url := lookup(n, "url")
+	if url == nil || url.Kind != yaml.ScalarNode || url.Value == "" {
+		return "", "", nil, y.errorAt(n, "feed without an 'url'")
+	}
+
+	group := ""
+	if g := lookup(n, "group"); g != nil {
+		group = g.Value
+	}
+
+	return url.Value, group, lookup(n, "options"), nil
+}
+
+// feeds returns the feeds listed in the file, along with the options they
+// inherit.
+func (y *yamlFile) feeds() ([]Feed, error) {
+
+	entries := []Feed{}
+
+	root := y.root()
+	if root.Kind != yaml.MappingNode {
+		return entries, y.errorAt(root, "the configuration should be a mapping, containing 'settings', 'defaults', 'groups', and 'feeds'")
+	}
+
+	defaults, _, err := y.options(lookup(root, "defaults"))
+	if err != nil {
+		return entries, err
+	}
+
+	groups := make(map[string][]Option)
+	if g := lookup(root, "groups"); g != nil && g.Tag != "!!null" {
+		if g.Kind != yaml.MappingNode {
+			return entries, y.errorAt(g, "groups should be a mapping of names to options")
+		}
+		for i := 0; i+1 < len(g.Content); i += 2 {
+			groups[g.Content[i].Value], _, err = y.options(g.Content[i+1])
+			if err != nil {
+				return entries, err
+			}
+		}
+	}
+
+	list := lookup(root, "feeds")
+	if list == nil || list.Tag == "!!null" {
+		return entries, nil
+	}
+	if list.Kind != yaml.SequenceNode {
+		return entries, y.errorAt(list, "feeds should be a list")
+	}
+
+	for _, n := range list.Content {
+		url, group, optNode, err := y.feed(n)
+		if err != nil {
+			return entries, err
+		}
+
+		opts, _, err := y.options(optNode)
+		if err != nil {
+			return entries, err
+		}
+
+		entries = append(entries, Feed{
+			URL:     url,
+			Options: inherit(inherit(defaults, groups[group]), opts),
+			Group:   group,
+			File:    y.path,
+		})
+	}
+
+	return entries, nil
+}
+
+// check validates each of the options, returning an error for each one
+// which is unknown, or has an invalid value.
+func (y *yamlFile) check() []error {
+
+	var errs []error
+
+	test := func(m *yaml.Node) {
+		opts, nodes, err := y.options(m)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		for i, opt := range opts {
+			err = CheckOption(opt)
+			if err != nil {
+				errs = append(errs, &LineError{Path: y.path, Line: nodes[i].Line, Err: err})
+			}
+		}
+	}
+
+	settings, err := y.settings()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, s := range settings {
+		err = CheckSetting(s.Name)
+		if err != nil {
+			errs = append(errs, &LineError{Path: y.path, Line: s.Line, Err: err})
+		}
+	}
+
+	root := y.root()
+	test(lookup(root, "defaults"))
+
+	if g := lookup(root, "groups"); g != nil && g.Kind == yaml.MappingNode {
+		for i := 1; i < len(g.Content); i += 2 {
+			test(g.Content[i])
+		}
+	}
+
+	if list := lookup(root, "feeds"); list != nil && list.Kind == yaml.SequenceNode {
+		for _, n := range list.Content {
+			_, _, opts, err := y.feed(n)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			test(opts)
+		}
+	}
+
+	return errs
+}
+
+// find returns the index of the given feed in the list, or -1.
+func (y *yamlFile) find(url string) int {
+
+	for i, n := range y.feedNodes().Content {
+		u, _, _, err := y.feed(n)
+		if err == nil && u == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// feedOptions returns the options of the feed with the given index, which
+// is converted from a plain URL to a mapping if necessary.
+func (y *yamlFile) feedOptions(i int) *yaml.Node {
+
+	list := y.feedNodes()
+	n := list.Content[i]
+
+	if n.Kind == yaml.ScalarNode {
+		list.Content[i] = &yaml.Node{
+			Kind:        yaml.MappingNode,
+			HeadComment: n.HeadComment,
+			LineComment: n.LineComment,
+			Content:     []*yaml.Node{scalar("url"), scalar(n.Value)},
+		}
+		n.HeadComment = ""
+		n.LineComment = ""
+		n = list.Content[i]
+	}
+
+	opts := lookup(n, "options")
+	if opts == nil || opts.Kind != yaml.MappingNode {
+		opts = &yaml.Node{Kind: yaml.MappingNode}
+		store(n, "options", opts)
+	}
+	return opts
+}
+
+// add appends the given feed to the list, or its options to the feed if
+// it is already present.
+func (y *yamlFile) add(feed Feed) {
+
+	i := y.find(feed.URL)
+	if i >= 0 {
+		for _, opt := range feed.Options {
+			y.append(i, opt)
+		}
+		return
+	}
+
+	if feed.Group == "" && len(feed.Options) == 0 {
+		list := y.feedNodes()
+		list.Content = append(list.Content, scalar(feed.URL))
+		return
+	}
+
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	store(n, "url", scalar(feed.URL))
+	if feed.Group != "" {
+		store(n, "group", scalar(feed.Group))
+	}
+	if len(feed.Options) > 0 {
+		store(n, "options", optionsNode(feed.Options))
+	}
+
+	list := y.feedNodes()
+	list.Content = append(list.Content, n)
+}
+
+// append adds a value for the named option, of the feed with the given
+// index.
+func (y *yamlFile) append(i int, opt Option) {
+
+	opts := y.feedOptions(i)
+	value := lookup(opts, opt.Name)
+
+	switch {
+	case value == nil:
+		store(opts, opt.Name, scalar(opt.Value))
+	case value.Kind == yaml.SequenceNode:
+		value.Content = append(value.Content, scalar(opt.Value))
+	default:
+		store(opts, opt.Name, &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{value, scalar(opt.Value)}})
+	}
+}
+
+// set replaces the values of the named option, of the feed with the given
+// index.
+func (y *yamlFile) set(i int, opt Option) {
+	store(y.feedOptions(i), opt.Name, scalar(opt.Value))
+}
+
+// unset removes the named option, or just the given value of it, from the
+// feed with the given index.  It returns the number of values removed.
+func (y *yamlFile) unset(i int, name string, value string) int {
+
+	n := y.feedNodes().Content[i]
+	_, _, opts, err := y.feed(n)
+	if err != nil || opts == nil || opts.Kind != yaml.MappingNode {
+		return 0
+	}
+
+	current := lookup(opts, name)
+	if current == nil {
+		return 0
+	}
+
+	values := []*yaml.Node{current}
+	if current.Kind == yaml.SequenceNode {
+		values = current.Content
+	}
+
+	var keep []*yaml.Node
+	for _, v := range values {
+		if value != "" && v.Value != value {
+			keep = append(keep, v)
+		}
+	}
+
+	switch {
+	case len(keep) == 0:
+		discard(opts, name)
+	case current.Kind == yaml.SequenceNode:
+		current.Content = keep
+	}
+
+	// Don't leave an empty set of options behind.
+	if len(opts.Content) == 0 {
+		discard(n, "options")
+	}
+
+	return len(values) - len(keep)
+}
+
+// remove deletes the feed with the given index.
+func (y *yamlFile) remove(i int) {
+	list := y.feedNodes()
+	list.Content = append(list.Content[:i], list.Content[i+1:]...)
+}
+
+// save writes the document to disk.
+func (y *yamlFile) save() error {
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	y.root()
+	err := enc.Encode(&y.doc)
+	if err != nil {
+		return err
+	}
+	err = enc.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(y.path, buf.Bytes(), 0644)
+}
+
+// structured returns our structured configuration file, creating an empty
+// one if necessary, or nil if we're using the plain-text format.
+func (c *ConfigFile) structured() *yamlFile {
+
+	if !isYAML(c.Path()) {
+		return nil
+	}
+	if c.yaml == nil {
+		c.yaml = &yamlFile{path: c.Path()}
+	}
+	return c.yaml
+}
+
+// parseYAML reads our structured configuration file.
+func (c *ConfigFile) parseYAML() ([]Feed, error) {
+
+	y, err := readYAML(c.Path())
+	if err != nil {
+		return c.entries, err
+	}
+
+	c.yaml = y
+	c.entries, err = y.feeds()
+	return c.entries, err
+}
+
+// ReadSettings returns the global settings from the given structured
+// configuration file.  If the file doesn't exist no settings are returned.
+func ReadSettings(path string) ([]Setting, error) {
+
+	y, err := readYAML(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return y.settings()
+}
+
+// settings returns the global settings held in the file.
+func (y *yamlFile) settings() ([]Setting, error) {
+
+	m := lookup(y.root(), "settings")
+	if m == nil || m.Tag == "!!null" {
+		return nil, nil
+	}
+	if m.Kind != yaml.MappingNode {
+		return nil, y.errorAt(m, "settings should be a mapping of names to values")
+	}
+
+	var settings []Setting
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, value := m.Content[i], m.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			return nil, y.errorAt(value, "the value of setting '%s' should be a string", key.Value)
+		}
+
+		settings = append(settings, Setting{Name: settingName(key.Value), Value: value.Value, Path: y.path, Line: key.Line})
+	}
+
+	return settings, nil
+}
+
+// WriteYAML writes the feeds we've read, along with the options of the
+// defaults and groups, and the settings, to the given structured
+// configuration file.
+//
+// If the file already exists its settings take precedence, but if it already
+// lists feeds it is only replaced if force is set.  You must call `Parse`
+// before calling this method.
+func (c *ConfigFile) WriteYAML(path string, force bool) error {
+
+	if c.yaml != nil {
+		return fmt.Errorf("%s is already a structured configuration file", c.Path())
+	}
+
+	y, err := readYAML(path)
+	if errors.Is(err, os.ErrNotExist) {
+		y, err = &yamlFile{path: path}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	root := y.root()
+	if root.Kind != yaml.MappingNode {
+		return y.errorAt(root, "the configuration should be a mapping")
+	}
+	if lookup(root, "feeds") != nil && !force {
+		return fmt.Errorf("%s already lists feeds", path)
+	}
+
+	l := c.layout()
+
+	// Settings which aren't already present are added.
+	if len(l.settings) > 0 {
+		existing, err := y.settings()
+		if err != nil {
+			return err
+		}
+
+		m := lookup(root, "settings")
+		if m == nil || m.Kind != yaml.MappingNode {
+			m = &yaml.Node{Kind: yaml.MappingNode}
+			store(root, "settings", m)
+		}
+
+		for _, setting := range l.settings {
+			found := false
+			for _, e := range existing {
+				found = found || e.Name == setting.Name
+			}
+			if !found {
+				store(m, strings.ToLower(setting.Name), scalar(setting.Value))
+			}
+		}
+	}
+
+	discard(root, "defaults")
+	discard(root, "groups")
+	discard(root, "feeds")
+
+	if len(l.defaults) > 0 {
+		store(root, "defaults", optionsNode(l.defaults))
+	}
+
+	if len(l.names) > 0 {
+		groups := &yaml.Node{Kind: yaml.MappingNode}
+		for _, name := range l.names {
+			store(groups, name, optionsNode(l.groups[name]))
+		}
+		store(root, "groups", groups)
+	}
+
+	y.feedNodes()
+	for i, feed := range l.feeds {
+		y.add(Feed{URL: feed.URL, Group: feed.Group, Options: feed.Options})
+
+		list := y.feedNodes()
+		list.Content[len(list.Content)-1].HeadComment = strings.Join(l.comments[i], "\n")
+	}
+
+	return y.save()
+}
@@ -0,0 +1,356 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// yamlHelper writes the given content to a structured configuration file,
+// and returns the path to it.
+func yamlHelper(t *testing.T, content string) string {
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+	return path
+}
+
+// TestYAML ensures feeds, and their inherited options, are read from a
+// structured configuration file.
+func TestYAML(t *testing.T) {
+
+	path := yamlHelper(t, `
+settings:
+  smtp_host: smtp.example.com
+  smtp-port: 587
+
+defaults:
+  notify: steve@example.com
+  tag: all
+
+groups:
+  security:
+    tag: security
+    exclude-title:
+      - one
+      - two
+
+feeds:
+  - https://example.com/
+  - url: https://example.org/
+    group: security
+    options:
+      notify: security@example.com
+      retry: 3
+`)
+
+	c := NewWithPath(path)
+	entries, err := c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	if entries[0].URL != "https://example.com/" || entries[0].File != path {
+		t.Fatalf("unexpected entry %v", entries[0])
+	}
+	if opts := entries[0].Options; len(opts) != 2 || opts[0].Value != "steve@example.com" || opts[1].Value != "all" {
+		t.Fatalf("unexpected options %v", opts)
+	}
+
+	expected := "tag:security,exclude-title:one,exclude-title:two,notify:security@example.com,retry:3"
+	var got []string
+	for _, opt := range entries[1].Options {
+		got = append(got, opt.Name+":"+opt.Value)
+	}
+	if strings.Join(got, ",") != expected || entries[1].Group != "security" {
+		t.Fatalf("unexpected options %v", got)
+	}
+
+	if len(c.Check()) != 0 {
+		t.Fatalf("unexpected problems %v", c.Check())
+	}
+
+	settings, err := ReadSettings(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(settings) != 2 || settings[0].Name != "SMTP_HOST" || settings[1].Name != "SMTP_PORT" || settings[1].Value != "587" || settings[1].Line != 4 {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+
+	// A missing file has no settings.
+	settings, err = ReadSettings(path + ".missing")
+	if err != nil || len(settings) != 0 {
+		t.Fatalf("unexpected settings %v %s", settings, err)
+	}
+}
+
+// TestYAMLErrors ensures problems are reported with their location.
+func TestYAMLErrors(t *testing.T) {
+
+	tests := []struct {
+		content string
+		line    int
+		err     string
+	}{
+		{"feeds: [\n", 1, "did not find expected node content"},
+		{"- one\n- two\n", 1, "should be a mapping"},
+		{"feeds: https://example.com/\n", 1, "feeds should be a list"},
+		{"feeds:\n  - group: one\n", 2, "feed without an 'url'"},
+		{"feeds:\n  - url: https://example.com/\n    options: [one]\n", 3, "options should be a mapping"},
+		{"defaults:\n  tag:\n    one: two\n", 3, "should be a string, or a list of strings"},
+	}
+
+	for _, test := range tests {
+		path := yamlHelper(t, test.content)
+
+		_, err := NewWithPath(path).Parse()
+		if err == nil {
+			t.Fatalf("expected an error parsing %q", test.content)
+		}
+
+		lineErr, ok := err.(*LineError)
+		if !ok || lineErr.Line != test.line || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("unexpected error parsing %q: %s", test.content, err)
+		}
+	}
+
+	// Unknown options, and settings, are found by Check.
+	path := yamlHelper(t, `settings:
+  smtp_hots: example.com
+feeds:
+  - url: https://example.com/
+    options:
+      retyr: 3
+`)
+	c := NewWithPath(path)
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	problems := c.Check()
+	if len(problems) != 2 ||
+		problems[0].Error() != path+":2: unknown setting 'SMTP_HOTS', did you mean 'SMTP_HOST'?" ||
+		problems[1].Error() != path+":6: unknown option 'retyr', did you mean 'retry'?" {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+}
+
+// TestYAMLChanges ensures changes are saved, along with the comments.
+func TestYAMLChanges(t *testing.T) {
+
+	path := yamlHelper(t, `# Our feeds
+feeds:
+  # A comment
+  - https://example.com/
+  - url: https://example.org/
+    options:
+      exclude: one
+`)
+
+	c := NewWithPath(path)
+	_, err := c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.Add("https://example.net/", "https://example.com/")
+	c.AddFeed(Feed{URL: "https://example.edu/", Group: "news", Options: []Option{{Name: "tag", Value: "news"}}})
+	if !c.SetOption("https://example.com/", "retry", "3") {
+		t.Fatalf("failed to set an option")
+	}
+	if !c.AppendOption("https://example.org/", "exclude", "two") {
+		t.Fatalf("failed to append an option")
+	}
+	if c.SetOption("https://missing.example.com/", "retry", "3") {
+		t.Fatalf("set an option of a missing feed")
+	}
+	if c.UnsetOption("https://example.edu/", "tag", "") != 1 {
+		t.Fatalf("failed to unset an option")
+	}
+	c.Delete("https://example.net/")
+
+	err = c.Save()
+	if err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+
+	expected := `# Our feeds
+feeds:
+  # A comment
+  - url: https://example.com/
+    options:
+      retry: "3"
+  - url: https://example.org/
+    options:
+      exclude:
+        - one
+        - two
+  - url: https://example.edu/
+    group: news
+`
+	if string(data) != expected {
+		t.Fatalf("unexpected content:\n%s", data)
+	}
+
+	// Removing one of several values.
+	c = NewWithPath(path)
+	_, err = c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.UnsetOption("https://example.org/", "exclude", "one") != 1 {
+		t.Fatalf("failed to unset an option")
+	}
+	if entries := c.entries; len(entries[1].Options) != 1 || entries[1].Options[0].Value != "two" {
+		t.Fatalf("unexpected options %v", entries[1].Options)
+	}
+}
+
+// TestWriteYAML ensures the plain-text format is converted.
+func TestWriteYAML(t *testing.T) {
+
+	dir := writeFiles(t, map[string]string{
+		"feeds.txt": `# First
+https://example.com/
+ - retry: 3
+
+[defaults]
+ - notify: steve@example.com
+
+[group security]
+ - tag: security
+https://example.org/
+ - exclude: one
+ - exclude: two
+include other.txt
+`,
+		"other.txt":   "https://example.net/\n",
+		"config.yaml": "settings:\n  sleep: 30\n",
+	})
+
+	c := NewWithPath(filepath.Join(dir, "feeds.txt"))
+	before, err := c.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	out := filepath.Join(dir, "config.yaml")
+	err = c.WriteYAML(out, false)
+	if err != nil {
+		t.Fatalf("failed to convert: %s", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+
+	expected := `settings:
+  sleep: 30
+defaults:
+  notify: steve@example.com
+groups:
+  security:
+    tag: security
+feeds:
+  # First
+  - url: https://example.com/
+    options:
+      retry: "3"
+  - url: https://example.org/
+    group: security
+    options:
+      exclude:
+        - one
+        - two
+  - https://example.net/
+`
+	if string(data) != expected {
+		t.Fatalf("unexpected content:\n%s", data)
+	}
+
+	// The result is the same.
+	after, err := NewWithPath(out).Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(before) != len(after) {
+		t.Fatalf("different feeds %v %v", before, after)
+	}
+	for i := range before {
+		if before[i].URL != after[i].URL || before[i].Group != after[i].Group || len(before[i].Options) != len(after[i].Options) {
+			t.Fatalf("different feeds %v %v", before[i], after[i])
+		}
+		for j := range before[i].Options {
+			if before[i].Options[j] != after[i].Options[j] {
+				t.Fatalf("different options %v %v", before[i].Options, after[i].Options)
+			}
+		}
+	}
+
+	// We don't replace existing feeds, unless forced.
+	if c.WriteYAML(out, false) == nil {
+		t.Fatalf("expected an error replacing existing feeds")
+	}
+	if c.WriteYAML(out, true) != nil {
+		t.Fatalf("failed to replace existing feeds")
+	}
+
+	// The structured file can't be converted.
+	y := NewWithPath(out)
+	_, err = y.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if y.WriteYAML(filepath.Join(dir, "other.yaml"), false) == nil {
+		t.Fatalf("expected an error converting a structured file")
+	}
+}
+
+// TestYAMLDefault ensures the structured file is used, by default, once it
+// lists feeds.
+func TestYAMLDefault(t *testing.T) {
+
+	t.Setenv("HOME", t.TempDir())
+
+	if NewWithPath("").Path() != filepath.Join(os.Getenv("HOME"), ".rss2email", "feeds.txt") {
+		t.Fatalf("unexpected default path %s", New().Path())
+	}
+
+	err := os.MkdirAll(filepath.Dir(YAMLPath()), 0755)
+	if err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+
+	// Settings alone don't replace the feed list.
+	err = os.WriteFile(YAMLPath(), []byte("settings:\n  sleep: 5\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if New().Path() != filepath.Join(os.Getenv("HOME"), ".rss2email", "feeds.txt") {
+		t.Fatalf("unexpected path %s", New().Path())
+	}
+
+	err = os.WriteFile(YAMLPath(), []byte("feeds:\n  - https://example.com/\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if New().Path() != YAMLPath() {
+		t.Fatalf("unexpected path %s", New().Path())
+	}
+}
@@ -0,0 +1,96 @@
+//
+// Convert our feed-list to a structured configuration file.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// Structure for our options and state.
+type convertCmd struct {
+
+	// Configuration file, used for testing
+	config *configfile.ConfigFile
+
+	// output is the structured configuration file to write.
+	output string
+
+	// force replaces the feeds of an existing structured configuration
+	// file.
+	force bool
+}
+
+// Arguments handles argument-flags we might have.
+//
+// In our case we use this as a hook to setup our configuration-file,
+// which allows testing.
+func (c *convertCmd) Arguments(flags *flag.FlagSet) {
+	c.config = configfile.New()
+
+	flags.StringVar(&c.output, "output", configfile.YAMLPath(), "The structured configuration file to write.")
+	flags.BoolVar(&c.force, "force", false, "Replace the feeds of the output file, if it already lists some.")
+}
+
+// Info is part of the subcommand-API
+func (c *convertCmd) Info() (string, string) {
+	return "convert", `Convert our feed-list to a structured configuration file.
+
+Our list of feeds, along with the files it includes, is written to a
+structured configuration file, in YAML format, which may also contain
+the global settings which are otherwise read from the environment.
+
+The defaults, groups, and the options of each feed are converted, along
+with the comments which precede each feed.  If the structured file already
+exists its settings are kept, but it will only be replaced if it doesn't
+already list feeds, unless you use '-force'.
+
+Once the structured file lists feeds it is used instead of the plain-text
+file, which may be removed.
+
+To see details of the configuration file, including the location,
+please run:
+
+   $ rss2email help config
+
+Example:
+
+    $ rss2email convert
+    $ rss2email convert -output /tmp/config.yaml
+`
+}
+
+// Execute is invoked if the user specifies `convert` as the subcommand.
+func (c *convertCmd) Execute(args []string) int {
+
+	// Parse the existing file
+	entries, err := c.config.Parse()
+	if err != nil {
+		logger.Error("failed to parse configuration file",
+			slog.String("configfile", c.config.Path()),
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	err = c.config.WriteYAML(c.output, c.force)
+	if err != nil {
+		logger.Error("failed to convert the configuration file",
+			slog.String("configfile", c.config.Path()),
+			slog.String("output", c.output),
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	fmt.Fprintf(out, "Converted %d feeds from %s to %s\n", len(entries), c.config.Path(), c.output)
+	if c.output == configfile.YAMLPath() {
+		fmt.Fprintf(out, "%s is no longer used, and may be removed\n", c.config.Path())
+	}
+
+	// All done, with no errors.
+	return 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// TestConvert ensures the feed list is converted to a structured file.
+func TestConvert(t *testing.T) {
+
+	bak := out
+	out = &bytes.Buffer{}
+	defer func() { out = bak }()
+
+	t.Setenv("HOME", t.TempDir())
+
+	dir := filepath.Dir(configfile.YAMLPath())
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "feeds.txt"), []byte("https://example.com/\n - retry: 3\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+	err = os.WriteFile(configfile.YAMLPath(), []byte("settings:\n  sleep: 30\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+
+	run := func(args ...string) int {
+		c := convertCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		c.Arguments(flags)
+
+		err = flags.Parse(args)
+		if err != nil {
+			t.Fatalf("Error parsing flags: %s", err)
+		}
+		return c.Execute(flags.Args())
+	}
+
+	if run() != 0 {
+		t.Fatalf("failed to convert")
+	}
+	if !strings.Contains(out.(*bytes.Buffer).String(), "Converted 1 feeds") {
+		t.Fatalf("unexpected output %s", out.(*bytes.Buffer).String())
+	}
+
+	// The structured file is now used.
+	config := configfile.New()
+	entries, err := config.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if config.Path() != configfile.YAMLPath() || len(entries) != 1 || entries[0].Options[0].Value != "3" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	// So it can't be converted again.
+	if run() == 0 {
+		t.Fatalf("expected an error converting a structured file")
+	}
+}
@@ -19,6 +19,12 @@ type cronCmd struct {
 	// Should we be verbose in operation?
 	verbose bool
 
+	// How many feeds should we fetch concurrently?
+	workers int
+
+	// Should we send a single digest, rather than an email per item?
+	digest bool
+
 	// Should we send emails?
 	send bool
 }
@@ -41,6 +47,23 @@ Example:
     $ rss2email cron user1@example.com user2@example.com
 
 
+Concurrency:
+
+Feeds are fetched in parallel, by default four at a time, this may be
+changed via the '-workers' flag.  Regardless of that setting we never
+make more than one request to the same remote host at a time, and we
+pause for a few seconds between consecutive requests to the same host.
+
+
+Digests:
+
+By default an email is sent for each new item.  If you'd prefer to
+receive a single email containing all the new items found in a run you
+may add the '-digest' flag.  You can also choose to receive a digest for
+a specific feed, via the per-feed 'digest' option; see 'rss2email help
+config' for details.
+
+
 Email Sending:
 
 By default we pipe outgoing messages through '/usr/sbin/sendmail' for delivery,
@@ -52,6 +75,12 @@ wish to use SMTP you need to configure the following environmental variables:
     SMTP_USERNAME   (e.g. "user@domain.com")
     SMTP_PASSWORD   (e.g. "secret!word#here")
 
+A different sendmail command, such as msmtp, may be used via the
+SENDMAIL_COMMAND setting; see 'rss2email help config' for details.
+
+If sending an email fails the message is saved, and delivery will be
+retried on subsequent runs.  See 'rss2email help outbox' for details.
+
 
 Email Template:
 
@@ -59,12 +88,18 @@ An embedded template is used to generate the emails which are sent, you
 may create a local override for this, for more details see :
 
     $ rss2email help list-default-template
+
+Digest emails use their own template, which you can see by running:
+
+    $ rss2email list-default-template -digest
 `
 }
 
 // Arguments handles our flag-setup.
 func (c *cronCmd) Arguments(f *flag.FlagSet) {
 	f.BoolVar(&c.verbose, "verbose", false, "Should we be extra verbose?")
+	f.IntVar(&c.workers, "workers", processor.DefaultWorkers, "The number of feeds to fetch concurrently.")
+	f.BoolVar(&c.digest, "digest", false, "Send a single digest email containing all new items, rather than one email per item?")
 	f.BoolVar(&c.send, "send", true, "Should we send emails, or just pretend to?")
 }
 
@@ -110,6 +145,8 @@ func (c *cronCmd) Execute(args []string) int {
 	// Setup the state
 	p.SetSendEmail(c.send)
 	p.SetLogger(logger)
+	p.SetWorkers(c.workers)
+	p.SetDigest(c.digest)
 
 	errors := p.ProcessFeeds(recipients)
 
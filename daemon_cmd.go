@@ -12,7 +12,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/skx/rss2email/configfile"
 	"github.com/skx/rss2email/processor"
+	"github.com/skx/rss2email/settings"
 )
 
 // Structure for our options and state.
@@ -20,6 +22,12 @@ type daemonCmd struct {
 
 	// Should we be verbose in operation?
 	verbose bool
+
+	// How many feeds should we fetch concurrently?
+	workers int
+
+	// Should we send a single digest, rather than an email per item?
+	digest bool
 }
 
 // Info is part of the subcommand-API.
@@ -39,6 +47,10 @@ In terms of implementation this command follows everything documented
 in the 'cron' sub-command.  The only difference is this one never
 terminates - even if email-generation fails.
 
+The settings are read again before the feeds are polled, so changes to
+them take effect without a restart.  The exception is the settings which
+control logging, which are only read when the daemon starts.
+
 
 Example:
 
@@ -49,6 +61,8 @@ Example:
 // Arguments handles our flag-setup.
 func (d *daemonCmd) Arguments(f *flag.FlagSet) {
 	f.BoolVar(&d.verbose, "verbose", false, "Should we be extra verbose?")
+	f.IntVar(&d.workers, "workers", processor.DefaultWorkers, "The number of feeds to fetch concurrently.")
+	f.BoolVar(&d.digest, "digest", false, "Send a single digest email containing all new items, rather than one email per item?")
 }
 
 // Entry-point
@@ -81,6 +95,13 @@ func (d *daemonCmd) Execute(args []string) int {
 
 	for {
 
+		// Read the settings again, in case they've changed.
+		err := settings.Load(configfile.New())
+		if err != nil {
+			logger.Warn("failed to read settings",
+				slog.String("error", err.Error()))
+		}
+
 		// Create the helper
 		p, err := processor.New()
 
@@ -96,6 +117,8 @@ func (d *daemonCmd) Execute(args []string) int {
 		// Setup the state - note we ALWAYS send emails in this mode.
 		p.SetSendEmail(true)
 		p.SetLogger(logger)
+		p.SetWorkers(d.workers)
+		p.SetDigest(d.digest)
 
 		// Process all the feeds
 		errors := p.ProcessFeeds(recipients)
@@ -0,0 +1,209 @@
+package httpfetch
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/configfile"
+)
+
+// feedTypes holds the MIME types which are used to advertise feeds, via
+// <link rel="alternate" ..> elements.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// commonPaths holds the paths at which sites commonly publish feeds, they
+// are tried if a page doesn't advertise any.
+var commonPaths = []string{
+	"feed",
+	"index.xml",
+	"feed.xml",
+	"rss",
+	"rss.xml",
+	"atom.xml",
+	"feed.json",
+}
+
+// Candidate is a feed found by Discover.
+type Candidate struct {
+
+	// URL is the location of the feed.
+	URL string
+
+	// Title is the title of the feed, if known.
+	Title string
+
+	// Type is the type of the feed, as advertised by the page which
+	// linked to it, or as detected when parsing it.
+	Type string
+
+	// Feed contains the parsed feed, if it was fetched during discovery.
+	Feed *gofeed.Feed
+}
+
+// Discover finds the feeds which are available at the given URL.
+//
+// If the URL is a feed then it is the only candidate returned, otherwise
+// if it is a HTML page we look for the feeds it advertises via <link>
+// elements, and failing that we look for feeds at common locations.
+//
+// Our cache is not used, or updated, when discovering feeds.
+func Discover(entry configfile.Feed, log *slog.Logger, version string) ([]Candidate, error) {
+
+	h := New(entry, log, version)
+	h.DisableCache()
+
+	// Is it a feed?
+	feed, err := h.Fetch()
+	if err == nil {
+		return []Candidate{{URL: entry.URL, Title: feed.Title, Type: feed.FeedType, Feed: feed}}, nil
+	}
+
+	// If we didn't get any content then we can't go further.
+	if h.content == "" {
+		return nil, err
+	}
+
+	base := h.finalURL
+	if base == "" {
+		base = entry.URL
+	}
+
+	if !isHTML(h.content) {
+		return nil, fmt.Errorf("%s is neither a feed nor a HTML page: %s", entry.URL, err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(h.content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML from %s: %s", entry.URL, err)
+	}
+
+	// Look for advertised feeds.
+	candidates := advertised(doc, base)
+	if len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	log.Debug("page doesn't advertise any feeds, trying common locations",
+		slog.String("url", entry.URL))
+
+	// Try the common locations.
+	for _, link := range commonLocations(base) {
+
+		probe := New(configfile.Feed{URL: link, Options: entry.Options}, log, version)
+		probe.DisableCache()
+		probe.maxRetries = 1
+
+		feed, err := probe.Fetch()
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, Candidate{URL: link, Title: feed.Title, Type: feed.FeedType, Feed: feed})
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no feeds found at %s", entry.URL)
+	}
+
+	return candidates, nil
+}
+
+// isHTML returns true if the given content looks like a HTML page.
+func isHTML(content string) bool {
+
+	start := strings.ToLower(content)
+	if len(start) > 4096 {
+		start = start[:4096]
+	}
+
+	for _, marker := range []string{"<!doctype html", "<html", "<head"} {
+		if strings.Contains(start, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// advertised returns the feeds linked to from the given HTML document.
+func advertised(doc *goquery.Document, base string) []Candidate {
+
+	var candidates []Candidate
+	seen := make(map[string]bool)
+
+	// The document might specify its own base.
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		base = resolve(base, href)
+	}
+
+	doc.Find("link[href]").Each(func(i int, s *goquery.Selection) {
+
+		rel := strings.Fields(strings.ToLower(s.AttrOr("rel", "")))
+		alternate := false
+		for _, r := range rel {
+			if r == "alternate" {
+				alternate = true
+			}
+		}
+
+		typ := strings.ToLower(strings.TrimSpace(s.AttrOr("type", "")))
+		if !alternate || !feedTypes[typ] {
+			return
+		}
+
+		link := resolve(base, s.AttrOr("href", ""))
+		if link == "" || seen[link] {
+			return
+		}
+		seen[link] = true
+
+		candidates = append(candidates, Candidate{
+			URL:   link,
+			Title: strings.TrimSpace(s.AttrOr("title", "")),
+			Type:  typ,
+		})
+	})
+
+	return candidates
+}
+
+// commonLocations returns the common feed locations for the given page,
+// relative to the page itself and to the root of the site.
+func commonLocations(base string) []string {
+
+	var out []string
+	seen := make(map[string]bool)
+
+	for _, dir := range []string{"./", "/"} {
+		for _, path := range commonPaths {
+			link := resolve(base, dir+path)
+			if link != "" && !seen[link] && link != base {
+				seen[link] = true
+				out = append(out, link)
+			}
+		}
+	}
+
+	return out
+}
+
+// resolve resolves the given reference against the base URL.
+func resolve(base string, ref string) string {
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	return b.ResolveReference(r).String()
+}
@@ -0,0 +1,138 @@
+package httpfetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// discoverFeed is a minimal feed, served by our test servers.
+const discoverFeed = `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+<title>Example Feed</title>
+<link>https://example.com/</link>
+<item><title>One</title><link>https://example.com/one</link></item>
+</channel>
+</rss>
+`
+
+// TestDiscoverFeed ensures a feed is returned as-is.
+func TestDiscoverFeed(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, discoverFeed)
+	}))
+	defer ts.Close()
+
+	found, err := Discover(configfile.Feed{URL: ts.URL + "/index.rss"}, logger, "unversioned")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(found) != 1 || found[0].URL != ts.URL+"/index.rss" || found[0].Title != "Example Feed" || found[0].Feed == nil {
+		t.Fatalf("unexpected candidates %v", found)
+	}
+
+	// Discovery must not update our cache.
+	cacheMutex.Lock()
+	_, ok := cache[ts.URL+"/index.rss"]
+	cacheMutex.Unlock()
+	if ok {
+		t.Fatalf("discovery updated our cache")
+	}
+}
+
+// TestDiscoverLinks ensures advertised feeds are found.
+func TestDiscoverLinks(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<!DOCTYPE html>
+<html><head>
+<title>Blog</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="RSS" href="/index.rss">
+<link rel="alternate" type="application/atom+xml" title="Atom" href="atom.xml">
+<link rel="alternate" type="application/feed+json" href="https://feeds.example.com/feed.json">
+<link rel="alternate" type="text/html" hreflang="fr" href="/fr/">
+</head><body></body></html>`)
+	}))
+	defer ts.Close()
+
+	found, err := Discover(configfile.Feed{URL: ts.URL + "/blog/"}, logger, "unversioned")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	expected := []Candidate{
+		{URL: ts.URL + "/index.rss", Title: "RSS", Type: "application/rss+xml"},
+		{URL: ts.URL + "/blog/atom.xml", Title: "Atom", Type: "application/atom+xml"},
+		{URL: "https://feeds.example.com/feed.json", Type: "application/feed+json"},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("unexpected candidates %v", found)
+	}
+	for i := range expected {
+		if found[i].URL != expected[i].URL || found[i].Title != expected[i].Title || found[i].Type != expected[i].Type {
+			t.Fatalf("unexpected candidate %v, expected %v", found[i], expected[i])
+		}
+	}
+}
+
+// TestDiscoverCommon ensures feeds at common locations are found.
+func TestDiscoverCommon(t *testing.T) {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<html><body>Not found</body></html>`)
+	})
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Home</title></head><body>Hello</body></html>`)
+	})
+	mux.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, discoverFeed)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	found, err := Discover(configfile.Feed{URL: ts.URL + "/"}, logger, "unversioned")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(found) != 1 || found[0].URL != ts.URL+"/index.xml" || found[0].Title != "Example Feed" {
+		t.Fatalf("unexpected candidates %v", found)
+	}
+}
+
+// TestDiscoverNothing ensures we report pages without feeds.
+func TestDiscoverNothing(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><body>Hello</body></html>`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	_, err := Discover(configfile.Feed{URL: ts.URL + "/"}, logger, "unversioned")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	// Not HTML, or a feed.
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "just some text")
+	}))
+	defer ts2.Close()
+
+	_, err = Discover(configfile.Feed{URL: ts2.URL + "/"}, logger, "unversioned")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -16,10 +16,13 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mmcdole/gofeed"
 	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/jsonfeed"
+	"github.com/skx/rss2email/settings"
 	statePath "github.com/skx/rss2email/state"
 )
 
@@ -27,6 +30,10 @@ var (
 	// cache contains the values we can use to be cache-friendly.
 	cache map[string]CacheHelper
 
+	// cacheMutex protects the cache, and the on-disk copy of it, as
+	// feeds may be fetched concurrently.
+	cacheMutex sync.Mutex
+
 	// ErrUnchanged is returned by our HTTP-fetcher if the content was previously
 	// fetched and has not changed since then.
 	ErrUnchanged = errors.New("UNCHANGED")
@@ -84,6 +91,14 @@ type HTTPFetch struct {
 	// The User-Agent header to send when making our HTTP fetch
 	userAgent string
 
+	// noCache disables the use of our cache, so that the remote URL
+	// is always fetched and future fetches are not affected.
+	noCache bool
+
+	// finalURL is the URL from which the content was fetched, after
+	// following any redirections.
+	finalURL string
+
 	// logger contains the logging handle to use, if any
 	logger *slog.Logger
 }
@@ -100,6 +115,8 @@ func New(entry configfile.Feed, log *slog.Logger, version string) *HTTPFetch {
 
 	// Path to the cache file, which we read from-disk if we can.
 	fileName := filepath.Join(statePath.Directory(), "httpcache.json")
+
+	cacheMutex.Lock()
 	data, err := os.ReadFile(fileName)
 
 	// If we got an error, and it wasn't a not-found log it
@@ -116,10 +133,11 @@ func New(entry configfile.Feed, log *slog.Logger, version string) *HTTPFetch {
 				slog.String("error", err.Error()))
 		}
 	}
+	cacheMutex.Unlock()
 
 	// Get the user's sleep period - if overridden this will become the
 	// default frequency for each feed item.
-	sleep := os.Getenv("SLEEP")
+	sleep := settings.Get("SLEEP")
 	if sleep == "" {
 		state.frequency = 15 * time.Minute
 	} else {
@@ -233,6 +251,21 @@ func (h *HTTPFetch) Fetch() (*gofeed.Feed, error) {
 		return feed, err
 	}
 
+	// JSON Feeds are parsed natively, as gofeed drops some fields.
+	if jsonfeed.IsJSONFeed([]byte(h.content)) {
+
+		jf, err2 := jsonfeed.Parse([]byte(h.content))
+		if err2 != nil {
+
+			h.logger.Warn("failed to parse content",
+				slog.String("error", err2.Error()))
+
+			return nil, fmt.Errorf("error parsing %s contents: %s", h.url, err2.Error())
+		}
+
+		return jf.Translate(), nil
+	}
+
 	// Parse it
 	fp := gofeed.NewParser()
 	feed, err2 := fp.ParseString(h.content)
@@ -247,11 +280,25 @@ func (h *HTTPFetch) Fetch() (*gofeed.Feed, error) {
 	return feed, nil
 }
 
+// DisableCache ensures that the remote URL is fetched without making a
+// conditional request, and that our cache is not updated.
+//
+// This is used when we're examining a feed which hasn't yet been added,
+// to avoid the first real fetch of the feed being skipped.
+func (h *HTTPFetch) DisableCache() {
+	h.noCache = true
+}
+
 // fetch fetches the text from the remote URL.
 func (h *HTTPFetch) fetch() error {
 
 	// Do we have a cache-entry?
+	cacheMutex.Lock()
 	prevCache, okCache := cache[h.url]
+	cacheMutex.Unlock()
+	if h.noCache {
+		okCache = false
+	}
 	if okCache {
 		h.logger.Debug("we have cached headers saved from a previous request",
 			slog.String("etag", prevCache.Etag),
@@ -325,20 +372,28 @@ func (h *HTTPFetch) fetch() error {
 		LastModified: resp.Header.Get("Last-Modified"),
 		Updated:      time.Now(),
 	}
-	cache[h.url] = x
-
-	// Save cache.
-	encoded, errEncoding := json.Marshal(cache)
-	if errEncoding == nil {
-		fileName := filepath.Join(statePath.Directory(), "httpcache.json")
-		errWrite := os.WriteFile(fileName, encoded, 0644)
-		if errWrite != nil {
-			h.logger.Debug("failed to write cache to json",
-				slog.String("path", fileName),
-				slog.String("error", errWrite.Error()))
+
+	if !h.noCache {
+		cacheMutex.Lock()
+		cache[h.url] = x
+
+		// Save cache.
+		encoded, errEncoding := json.Marshal(cache)
+		if errEncoding == nil {
+			fileName := filepath.Join(statePath.Directory(), "httpcache.json")
+			errWrite := os.WriteFile(fileName, encoded, 0644)
+			if errWrite != nil {
+				h.logger.Debug("failed to write cache to json",
+					slog.String("path", fileName),
+					slog.String("error", errWrite.Error()))
+			}
 		}
+		cacheMutex.Unlock()
 	}
 
+	// Record where we ended up.
+	h.finalURL = resp.Request.URL.String()
+
 	//
 	// Did the remote page not change?
 	//
@@ -300,3 +300,29 @@ func TestHTTPFetchValid(t *testing.T) {
 		t.Fatalf("wrong feed count")
 	}
 }
+
+// TestJSONFeed confirms JSON Feeds are parsed natively.
+func TestJSONFeed(t *testing.T) {
+
+	data, err := os.ReadFile("../jsonfeed/testdata/feed-1.1.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture %s", err)
+	}
+
+	x := New(configfile.Feed{URL: "https://example.org/feed.json"}, logger, "unversioned")
+	x.content = string(data)
+
+	out, err := x.Fetch()
+	if err != nil {
+		t.Fatalf("We didn't expect an error, but found %s", err.Error())
+	}
+
+	if len(out.Items) != 2 {
+		t.Fatalf("Expected two entries, but got %d", len(out.Items))
+	}
+
+	item := withstate.FeedItem{Item: out.Items[0]}
+	if len(item.Attachments()) != 1 || item.Attachments()[0].Title != "Full advisory" {
+		t.Fatalf("attachments were not available %v", item.Attachments())
+	}
+}
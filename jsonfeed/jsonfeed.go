@@ -0,0 +1,326 @@
+// Package jsonfeed parses feeds in the JSON Feed format, versions 1.0
+// and 1.1, as described at https://jsonfeed.org/
+//
+// The gofeed library can parse these too, but it drops several fields we
+// wish to make available to our email templates - such as the titles and
+// durations of attachments, multiple authors, and extensions - so we parse
+// them ourselves, and translate the result into a gofeed.Feed.
+package jsonfeed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// versionPrefix is the prefix of the version field of all JSON Feeds.
+const versionPrefix = "https://jsonfeed.org/version/"
+
+// Feed is the top-level object of a JSON Feed.
+type Feed struct {
+
+	// Version is the URL of the version of the format the feed uses.
+	Version string `json:"version"`
+
+	// Title is the name of the feed.
+	Title string `json:"title"`
+
+	// HomePageURL is the URL of the resource the feed describes.
+	HomePageURL string `json:"home_page_url,omitempty"`
+
+	// FeedURL is the URL of the feed itself.
+	FeedURL string `json:"feed_url,omitempty"`
+
+	// Description describes the feed.
+	Description string `json:"description,omitempty"`
+
+	// UserComment is a description of the purpose of the feed.
+	UserComment string `json:"user_comment,omitempty"`
+
+	// NextURL is the URL of the next page of items, for paged feeds.
+	NextURL string `json:"next_url,omitempty"`
+
+	// Icon is the URL of an image for the feed, suitable for timelines.
+	Icon string `json:"icon,omitempty"`
+
+	// Favicon is the URL of an image for the feed, suitable for lists.
+	Favicon string `json:"favicon,omitempty"`
+
+	// Author is the author of the feed.  It is deprecated in version
+	// 1.1, in favour of Authors.
+	Author *Author `json:"author,omitempty"`
+
+	// Authors are the authors of the feed.
+	Authors []Author `json:"authors,omitempty"`
+
+	// Language is the primary language of the feed.
+	Language string `json:"language,omitempty"`
+
+	// Expired is true if the feed will never be updated again.
+	Expired bool `json:"expired,omitempty"`
+
+	// Items holds the items within the feed.
+	Items []Item `json:"items"`
+
+	// Extensions holds the custom fields of the feed, those whose
+	// names begin with an underscore, keyed by that name.
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+// Item is a single entry within a JSON Feed.
+type Item struct {
+
+	// ID is the unique identifier of the item.
+	//
+	// Some feeds use numbers, rather than strings, so this is
+	// converted upon parsing.
+	ID string `json:"id"`
+
+	// URL is the URL of the item.
+	URL string `json:"url,omitempty"`
+
+	// ExternalURL is the URL of a page elsewhere, which the item is about.
+	ExternalURL string `json:"external_url,omitempty"`
+
+	// Title is the title of the item.
+	Title string `json:"title,omitempty"`
+
+	// ContentHTML is the HTML content of the item.
+	ContentHTML string `json:"content_html,omitempty"`
+
+	// ContentText is the plain-text content of the item.
+	ContentText string `json:"content_text,omitempty"`
+
+	// Summary is a plain-text summary of the item.
+	Summary string `json:"summary,omitempty"`
+
+	// Image is the URL of the main image for the item.
+	Image string `json:"image,omitempty"`
+
+	// BannerImage is the URL of an image to show at the top of the item.
+	BannerImage string `json:"banner_image,omitempty"`
+
+	// DatePublished is the date the item was published, in RFC 3339 format.
+	DatePublished string `json:"date_published,omitempty"`
+
+	// DateModified is the date the item was modified, in RFC 3339 format.
+	DateModified string `json:"date_modified,omitempty"`
+
+	// Author is the author of the item.  It is deprecated in version
+	// 1.1, in favour of Authors.
+	Author *Author `json:"author,omitempty"`
+
+	// Authors are the authors of the item.
+	Authors []Author `json:"authors,omitempty"`
+
+	// Tags are the tags of the item.
+	Tags []string `json:"tags,omitempty"`
+
+	// Language is the language of the item.
+	Language string `json:"language,omitempty"`
+
+	// Attachments are the related resources of the item, such as
+	// podcast episodes.
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Extensions holds the custom fields of the item, those whose
+	// names begin with an underscore, keyed by that name.
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+// Attachment is a resource related to an item.
+type Attachment struct {
+
+	// URL is the location of the attachment.
+	URL string `json:"url"`
+
+	// MimeType is the type of the attachment.
+	MimeType string `json:"mime_type"`
+
+	// Title is the name of the attachment.
+	Title string `json:"title,omitempty"`
+
+	// SizeInBytes is the size of the attachment.
+	SizeInBytes int64 `json:"size_in_bytes,omitempty"`
+
+	// DurationInSeconds is the length of the attachment, for audio
+	// and video.
+	DurationInSeconds float64 `json:"duration_in_seconds,omitempty"`
+}
+
+// Author describes the author of a feed, or item.
+type Author struct {
+
+	// Name is the name of the author.
+	Name string `json:"name,omitempty"`
+
+	// URL is the website of the author.
+	URL string `json:"url,omitempty"`
+
+	// Avatar is the URL of an image of the author.
+	Avatar string `json:"avatar,omitempty"`
+}
+
+// extensions returns the fields of the given object whose names begin
+// with an underscore.
+func extensions(data []byte) (map[string]json.RawMessage, error) {
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var ext map[string]json.RawMessage
+	for name, value := range fields {
+		if strings.HasPrefix(name, "_") {
+			if ext == nil {
+				ext = make(map[string]json.RawMessage)
+			}
+			ext[name] = value
+		}
+	}
+	return ext, nil
+}
+
+// UnmarshalJSON is part of the json.Unmarshaler interface, it collects
+// the extensions of the feed.
+func (f *Feed) UnmarshalJSON(data []byte) error {
+
+	// Avoid recursion by using a type without our methods.
+	type plain Feed
+	err := json.Unmarshal(data, (*plain)(f))
+	if err != nil {
+		return err
+	}
+
+	f.Extensions, err = extensions(data)
+	return err
+}
+
+// MarshalJSON is part of the json.Marshaler interface, it includes the
+// extensions of the feed.
+func (f Feed) MarshalJSON() ([]byte, error) {
+	type plain Feed
+	return withExtensions(plain(f), f.Extensions)
+}
+
+// UnmarshalJSON is part of the json.Unmarshaler interface, it converts
+// numeric IDs to strings, and collects the extensions of the item.
+func (i *Item) UnmarshalJSON(data []byte) error {
+
+	// Avoid recursion by using a type without our methods, and
+	// decode the ID separately as it might not be a string.
+	type plain Item
+	var tmp struct {
+		*plain
+		ID json.RawMessage `json:"id"`
+	}
+	tmp.plain = (*plain)(i)
+
+	err := json.Unmarshal(data, &tmp)
+	if err != nil {
+		return err
+	}
+
+	i.ID = ""
+	if len(tmp.ID) > 0 && !bytes.Equal(tmp.ID, []byte("null")) {
+		var id any
+		err = json.Unmarshal(tmp.ID, &id)
+		if err != nil {
+			return err
+		}
+		switch v := id.(type) {
+		case string:
+			i.ID = v
+		case float64:
+			i.ID = string(tmp.ID)
+		default:
+			return fmt.Errorf("invalid item id %s", tmp.ID)
+		}
+	}
+
+	i.Extensions, err = extensions(data)
+	return err
+}
+
+// MarshalJSON is part of the json.Marshaler interface, it includes the
+// extensions of the item.
+func (i Item) MarshalJSON() ([]byte, error) {
+	type plain Item
+	return withExtensions(plain(i), i.Extensions)
+}
+
+// withExtensions encodes the given value, adding the given extensions to
+// the resulting object.
+func withExtensions(v any, ext map[string]json.RawMessage) ([]byte, error) {
+
+	data, err := json.Marshal(v)
+	if err != nil || len(ext) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range ext {
+		fields[name] = value
+	}
+	return json.Marshal(fields)
+}
+
+// IsJSONFeed returns true if the given content looks like a JSON Feed.
+func IsJSONFeed(content []byte) bool {
+
+	content = bytes.TrimSpace(content)
+	if !bytes.HasPrefix(content, []byte("{")) {
+		return false
+	}
+
+	var tmp struct {
+		Version string `json:"version"`
+	}
+	if json.Unmarshal(content, &tmp) != nil {
+		return false
+	}
+	return strings.HasPrefix(tmp.Version, versionPrefix)
+}
+
+// Parse parses the given JSON Feed.
+func Parse(content []byte) (*Feed, error) {
+
+	var feed Feed
+	err := json.Unmarshal(content, &feed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON Feed: %s", err)
+	}
+
+	if !strings.HasPrefix(feed.Version, versionPrefix) {
+		return nil, fmt.Errorf("unknown JSON Feed version '%s'", feed.Version)
+	}
+
+	return &feed, nil
+}
+
+// AllAuthors returns the authors of the feed, including the single author
+// which version 1.0 feeds use.
+func (f *Feed) AllAuthors() []Author {
+	return allAuthors(f.Author, f.Authors)
+}
+
+// AllAuthors returns the authors of the item, including the single author
+// which version 1.0 feeds use.
+func (i *Item) AllAuthors() []Author {
+	return allAuthors(i.Author, i.Authors)
+}
+
+// allAuthors merges the single author with the list of authors.
+func allAuthors(author *Author, authors []Author) []Author {
+	if author != nil && len(authors) == 0 {
+		return []Author{*author}
+	}
+	return authors
+}
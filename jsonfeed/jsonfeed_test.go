@@ -0,0 +1,157 @@
+package jsonfeed
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// load reads and parses one of our test fixtures.
+func load(t *testing.T, name string) *Feed {
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", name, err)
+	}
+
+	if !IsJSONFeed(data) {
+		t.Fatalf("%s was not detected as a JSON Feed", name)
+	}
+
+	feed, err := Parse(data)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %s", name, err)
+	}
+	return feed
+}
+
+// TestIsJSONFeed tests our detection of JSON Feeds.
+func TestIsJSONFeed(t *testing.T) {
+
+	invalid := []string{
+		"",
+		"<rss></rss>",
+		`{"version": "1.0"}`,
+		`{"title": "missing version"}`,
+		`[{"version": "https://jsonfeed.org/version/1.1"}]`,
+	}
+	for _, content := range invalid {
+		if IsJSONFeed([]byte(content)) {
+			t.Fatalf("%s was detected as a JSON Feed", content)
+		}
+	}
+
+	_, err := Parse([]byte(`{"version": "2.0", "items": []}`))
+	if err == nil {
+		t.Fatalf("expected an error parsing an unknown version")
+	}
+}
+
+// TestVersion10 tests parsing a version 1.0 feed.
+func TestVersion10(t *testing.T) {
+
+	feed := load(t, "feed-1.0.json")
+
+	if len(feed.Items) != 2 {
+		t.Fatalf("expected two items, got %d", len(feed.Items))
+	}
+
+	// The single author of version 1.0
+	authors := feed.AllAuthors()
+	if len(authors) != 1 || authors[0].Name != "Jane Doe" {
+		t.Fatalf("unexpected feed authors %v", authors)
+	}
+	if _, ok := feed.Extensions["_itunes"]; !ok {
+		t.Fatalf("missing feed extension")
+	}
+
+	// Numeric IDs are converted.
+	item := feed.Items[0]
+	if item.ID != "2" {
+		t.Fatalf("unexpected ID %s", item.ID)
+	}
+	if len(item.Attachments) != 1 || item.Attachments[0].DurationInSeconds != 1800 || item.Attachments[0].Title != "Episode Two (MP3)" {
+		t.Fatalf("unexpected attachments %v", item.Attachments)
+	}
+	if string(item.Extensions["_itunes"]) == "" {
+		t.Fatalf("missing item extension")
+	}
+
+	// Translation
+	gf := feed.Translate()
+	if gf.FeedVersion != "1" || gf.Author.Name != "Jane Doe" {
+		t.Fatalf("unexpected translated feed %v", gf)
+	}
+
+	// Plain-text content is converted to HTML, and escaped.
+	first := gf.Items[0]
+	if !strings.Contains(first.Content, "<p>In this episode we talk about feeds.</p>") || !strings.Contains(first.Content, "&lt;email&gt;") {
+		t.Fatalf("unexpected content %s", first.Content)
+	}
+	if first.Description != "Talking about feeds." || first.Image.URL != "https://example.com/images/2.png" {
+		t.Fatalf("unexpected translated item %v", first)
+	}
+	if len(first.Enclosures) != 1 || first.Enclosures[0].Length != "1234567" {
+		t.Fatalf("unexpected enclosures %v", first.Enclosures)
+	}
+	if first.PublishedParsed == nil || first.PublishedParsed.Year() != 2020 {
+		t.Fatalf("failed to parse publication date")
+	}
+
+	// HTML is preferred to text.
+	second := gf.Items[1]
+	if second.Content != "<p>Our <b>first</b> episode.</p>" || second.Author.Name != "John Smith" {
+		t.Fatalf("unexpected translated item %v", second)
+	}
+
+	// The original item is available.
+	orig := ItemOf(first)
+	if orig == nil || orig.ContentText == "" || len(orig.Attachments) != 1 || orig.Extensions["_itunes"] == nil {
+		t.Fatalf("failed to find original item %v", orig)
+	}
+}
+
+// TestVersion11 tests parsing a version 1.1 feed.
+func TestVersion11(t *testing.T) {
+
+	feed := load(t, "feed-1.1.json")
+
+	if len(feed.AllAuthors()) != 2 || feed.Language != "en-GB" {
+		t.Fatalf("unexpected feed %v", feed)
+	}
+
+	item := feed.Items[0]
+	if len(item.AllAuthors()) != 2 || len(item.Tags) != 2 || item.Attachments[0].MimeType != "application/pdf" {
+		t.Fatalf("unexpected item %v", item)
+	}
+	if string(item.Extensions["_example"]) == "" {
+		t.Fatalf("missing item extension")
+	}
+
+	gf := feed.Translate()
+	if gf.FeedVersion != "1.1" || gf.Image.URL != "https://example.org/icon.png" || len(gf.Authors) != 2 {
+		t.Fatalf("unexpected translated feed %v", gf)
+	}
+
+	first := gf.Items[0]
+	if first.Image == nil || first.Image.URL != "https://example.org/banner.png" {
+		t.Fatalf("banner image not used")
+	}
+	if first.UpdatedParsed == nil || first.UpdatedParsed.Day() != 3 {
+		t.Fatalf("failed to parse modification date")
+	}
+	if len(first.Categories) != 2 || len(first.Authors) != 2 {
+		t.Fatalf("unexpected translated item %v", first)
+	}
+
+	// The external URL is used if there is no URL.
+	second := gf.Items[1]
+	if second.Link != "https://example.net/article" || second.Content != "<p>Worth reading.</p>" {
+		t.Fatalf("unexpected translated item %v", second)
+	}
+
+	// Items which didn't come from a JSON Feed
+	if ItemOf(nil) != nil {
+		t.Fatalf("unexpected JSON Feed item")
+	}
+}
@@ -0,0 +1,164 @@
+package jsonfeed
+
+import (
+	"encoding/json"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// CustomKey is the key, within the Custom map of each translated
+// gofeed.Item, which holds the JSON encoding of the original item.
+//
+// This allows the fields which gofeed has no place for to be retrieved,
+// see ItemOf.
+const CustomKey = "jsonfeed"
+
+// Translate converts the feed to a gofeed.Feed.
+func (f *Feed) Translate() *gofeed.Feed {
+
+	feed := &gofeed.Feed{
+		Title:       f.Title,
+		Description: f.Description,
+		Link:        f.HomePageURL,
+		FeedLink:    f.FeedURL,
+		Language:    f.Language,
+		Authors:     people(f.AllAuthors()),
+		FeedType:    "json",
+		FeedVersion: strings.TrimPrefix(f.Version, versionPrefix),
+	}
+
+	if f.HomePageURL != "" {
+		feed.Links = append(feed.Links, f.HomePageURL)
+	}
+	if f.FeedURL != "" {
+		feed.Links = append(feed.Links, f.FeedURL)
+	}
+	if len(feed.Authors) > 0 {
+		feed.Author = feed.Authors[0]
+	}
+	if f.Icon != "" {
+		feed.Image = &gofeed.Image{URL: f.Icon}
+	} else if f.Favicon != "" {
+		feed.Image = &gofeed.Image{URL: f.Favicon}
+	}
+
+	for i := range f.Items {
+		feed.Items = append(feed.Items, f.Items[i].translate())
+	}
+
+	return feed
+}
+
+// translate converts the item to a gofeed.Item.
+func (i *Item) translate() *gofeed.Item {
+
+	item := &gofeed.Item{
+		Title:       i.Title,
+		Description: i.Summary,
+		Content:     i.ContentHTML,
+		Link:        i.URL,
+		GUID:        i.ID,
+		Published:   i.DatePublished,
+		Updated:     i.DateModified,
+		Authors:     people(i.AllAuthors()),
+		Categories:  i.Tags,
+	}
+
+	// Our emails are generated from HTML, so if there is only
+	// a plain-text version we convert it.
+	if item.Content == "" && i.ContentText != "" {
+		item.Content = textToHTML(i.ContentText)
+	}
+
+	if item.Link == "" {
+		item.Link = i.ExternalURL
+	}
+	if item.Link != "" {
+		item.Links = append(item.Links, item.Link)
+	}
+	if i.ExternalURL != "" && i.ExternalURL != item.Link {
+		item.Links = append(item.Links, i.ExternalURL)
+	}
+
+	if len(item.Authors) > 0 {
+		item.Author = item.Authors[0]
+	}
+
+	if t, err := time.Parse(time.RFC3339, i.DatePublished); err == nil {
+		item.PublishedParsed = &t
+	}
+	if t, err := time.Parse(time.RFC3339, i.DateModified); err == nil {
+		item.UpdatedParsed = &t
+	}
+
+	if i.Image != "" {
+		item.Image = &gofeed.Image{URL: i.Image}
+	} else if i.BannerImage != "" {
+		item.Image = &gofeed.Image{URL: i.BannerImage}
+	}
+
+	for _, a := range i.Attachments {
+		enc := &gofeed.Enclosure{URL: a.URL, Type: a.MimeType}
+		if a.SizeInBytes > 0 {
+			enc.Length = strconv.FormatInt(a.SizeInBytes, 10)
+		}
+		item.Enclosures = append(item.Enclosures, enc)
+	}
+
+	// Save the original item, so that the fields which gofeed
+	// has no place for are still available.
+	data, err := json.Marshal(i)
+	if err == nil {
+		item.Custom = map[string]string{CustomKey: string(data)}
+	}
+
+	return item
+}
+
+// ItemOf returns the JSON Feed item from which the given gofeed.Item was
+// translated, or nil if it didn't come from a JSON Feed.
+func ItemOf(item *gofeed.Item) *Item {
+
+	if item == nil || item.Custom == nil {
+		return nil
+	}
+
+	data, ok := item.Custom[CustomKey]
+	if !ok {
+		return nil
+	}
+
+	var i Item
+	if json.Unmarshal([]byte(data), &i) != nil {
+		return nil
+	}
+	return &i
+}
+
+// people converts the given authors to gofeed's representation.
+func people(authors []Author) []*gofeed.Person {
+
+	var out []*gofeed.Person
+	for _, a := range authors {
+		out = append(out, &gofeed.Person{Name: a.Name})
+	}
+	return out
+}
+
+// textToHTML converts plain-text to HTML, preserving paragraphs and
+// line-breaks.
+func textToHTML(text string) string {
+
+	var paras []string
+	for _, p := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		p = html.EscapeString(strings.TrimSpace(p))
+		if p != "" {
+			paras = append(paras, "<p>"+strings.ReplaceAll(p, "\n", "<br>\n")+"</p>")
+		}
+	}
+	return strings.Join(paras, "\n")
+}
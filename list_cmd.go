@@ -8,10 +8,14 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/skx/rss2email/configfile"
 	"github.com/skx/rss2email/httpfetch"
+	"github.com/skx/rss2email/state"
+	"go.etcd.io/bbolt"
 )
 
 var (
@@ -27,6 +31,10 @@ type listCmd struct {
 	// verbose controls whether our feed-list contains information
 	// about feed entries and their ages
 	verbose bool
+
+	// db is our state database, used to show the history of each
+	// feed when listing verbosely.  It might be nil.
+	db *bbolt.DB
 }
 
 // Arguments handles argument-flags we might have.
@@ -55,9 +63,10 @@ please run:
    $ rss2email help config
 
 
-You can add '-verbose' to see details about the feed contents, but note
-that this will require downloading the contents of each feed and will
-thus be slow - a simpler way of showing history would be to run:
+You can add '-verbose' to see details about the feed contents, along
+with the history of the items we've seen from each feed, but note that
+this will require downloading the contents of each feed and will thus
+be slow - a simpler way of showing history would be to run:
 
     $ rss2email seen
 
@@ -103,9 +112,88 @@ func (l *listCmd) showFeedDetails(entry configfile.Feed) {
 
 	// Now show the details, which is a bit messy.
 	fmt.Fprintf(out, "# %d %s, aged %d-%d days\n", len(feed.Items), entriesString, newest, oldest)
+	l.showFeedHistory(entry)
 	fmt.Fprintf(out, "%s\n", entry.URL)
 }
 
+// showFeedHistory shows a summary of the items we've seen from the given
+// feed, as recorded in our state database.
+func (l *listCmd) showFeedHistory(entry configfile.Feed) {
+
+	if l.db == nil {
+		return
+	}
+
+	// Count the items by status, and find the most recent.
+	count := 0
+	status := make(map[string]int)
+	var last state.Record
+
+	err := l.db.View(func(tx *bbolt.Tx) error {
+
+		b := tx.Bucket([]byte(entry.URL))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k []byte, v []byte) error {
+			rec, err := state.ParseRecord(v)
+			if err != nil {
+				return err
+			}
+
+			count++
+			status[rec.Status]++
+			if rec.FirstSeen.After(last.FirstSeen) {
+				last = rec
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		fmt.Fprintf(out, "# %s\n", err.Error())
+		return
+	}
+
+	if count == 0 {
+		fmt.Fprintf(out, "# no items seen\n")
+		return
+	}
+
+	summary := ""
+	for _, s := range []string{state.StatusEmailed, state.StatusFailed, state.StatusQueued, state.StatusExcluded, state.StatusSeen} {
+		if status[s] > 0 {
+			summary += fmt.Sprintf(", %d %s", status[s], s)
+		}
+	}
+	fmt.Fprintf(out, "# %d items seen%s\n", count, summary)
+
+	if !last.FirstSeen.IsZero() {
+		fmt.Fprintf(out, "# last new item '%s', %s\n", last.Title, last.String())
+	}
+}
+
+// openState opens our state database, read-only, if it exists.
+func (l *listCmd) openState() {
+
+	path := filepath.Join(state.Directory(), "state.db")
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	// If another process is running, for example the daemon, then the
+	// database will be locked - so don't wait for long.
+	db, err := bbolt.Open(path, 0666, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		logger.Warn("failed to open state database, history will not be shown",
+			slog.String("database", path),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	l.db = db
+}
+
 // Entry-point.
 func (l *listCmd) Execute(args []string) int {
 
@@ -118,6 +206,14 @@ func (l *listCmd) Execute(args []string) int {
 		return 1
 	}
 
+	// Open our state database, to show the history of each feed.
+	if l.verbose {
+		l.openState()
+		if l.db != nil {
+			defer l.db.Close()
+		}
+	}
+
 	// Show the feeds
 	for _, entry := range entries {
 
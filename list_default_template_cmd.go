@@ -5,17 +5,22 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 
 	"github.com/skx/rss2email/template"
-	"github.com/skx/subcommands"
 )
 
 // listDefaultTemplateCmd holds our state.
 type listDefaultTemplateCmd struct {
 
-	// We embed the NoFlags option, because we accept no command-line flags.
-	subcommands.NoFlags
+	// digest causes us to show the template used for digest emails.
+	digest bool
+}
+
+// Arguments handles our flag-setup.
+func (l *listDefaultTemplateCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&l.digest, "digest", false, "Show the template used for digest emails instead.")
 }
 
 // Info is part of the subcommand-API
@@ -34,6 +39,12 @@ This sub-command can be used to give you a starting point for your edits:
 
    $ rss2email list-default-template > ~/.rss2email/email.tmpl
 
+Digest emails, which contain several items, use a different template.  You
+can see that by adding the '-digest' flag, and override it by creating the
+file '~/.rss2email/digest.tmpl':
+
+   $ rss2email list-default-template -digest > ~/.rss2email/digest.tmpl
+
 
 Example:
 
@@ -48,6 +59,9 @@ func (l *listDefaultTemplateCmd) Execute(args []string) int {
 
 	// Load the default template from the embedded resource.
 	content := template.EmailTemplate()
+	if l.digest {
+		content = template.DigestTemplate()
+	}
 	fmt.Fprintf(out, "%s\n", string(content))
 	return 0
 }
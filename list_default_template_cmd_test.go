@@ -44,3 +44,33 @@ func TestDefaultTemplate(t *testing.T) {
 		}
 	}
 }
+
+func TestDefaultDigestTemplate(t *testing.T) {
+
+	bak := out
+	out = &bytes.Buffer{}
+	defer func() { out = bak }()
+
+	s := listDefaultTemplateCmd{}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	s.Arguments(flags)
+	flags.Parse([]string{"-digest"})
+
+	s.Execute([]string{})
+
+	expected := []string{
+		"X-RSS-Digest: {{len .Items}}",
+		"Content-Type: multipart/alternative;",
+		"the default template which is used to generate digest emails",
+	}
+
+	// The text written to stdout
+	output := out.(*bytes.Buffer).String()
+
+	for _, txt := range expected {
+		if !strings.Contains(output, txt) {
+			t.Fatalf("Failed to find expected output '%s'", txt)
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"os"
 	"strings"
 
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/settings"
 	"github.com/skx/subcommands"
 )
 
@@ -32,6 +34,12 @@ func recoverPanic() {
 // Register the subcommands, and run the one the user chose.
 func main() {
 
+	//
+	// Read our settings before anything else, as they might
+	// change how we log.
+	//
+	settingsErr := settings.Load(configfile.New())
+
 	//
 	// Setup our default logging level, which will show
 	// both warnings and errors.
@@ -42,12 +50,12 @@ func main() {
 	//
 	// If the user wants a different level they can choose it.
 	//
-	level := os.Getenv("LOG_LEVEL")
+	level := settings.Get("LOG_LEVEL")
 
 	//
 	// Legacy/Compatibility
 	//
-	if os.Getenv("LOG_ALL") != "" {
+	if settings.Get("LOG_ALL") != "" {
 		level = "DEBUG"
 	}
 
@@ -107,8 +115,8 @@ func main() {
 	// environmental variable.
 	//
 	logPath := "rss2email.log"
-	if os.Getenv("LOG_FILE_PATH") != "" {
-		logPath = os.Getenv("LOG_FILE_PATH")
+	if settings.Get("LOG_FILE_PATH") != "" {
+		logPath = settings.Get("LOG_FILE_PATH")
 	}
 
 	//
@@ -126,7 +134,7 @@ func main() {
 		// Unless we've been disabled then update our
 		// writer.
 		//
-		if os.Getenv("LOG_FILE_DISABLE") != "" {
+		if settings.Get("LOG_FILE_DISABLE") != "" {
 			multi = io.MultiWriter(file, os.Stderr)
 		}
 	}
@@ -140,7 +148,7 @@ func main() {
 	//
 	// But allow JSON formatting too.
 	//
-	if os.Getenv("LOG_JSON") != "" {
+	if settings.Get("LOG_JSON") != "" {
 		handler = slog.NewJSONHandler(multi, opts)
 	}
 
@@ -149,6 +157,11 @@ func main() {
 	//
 	logger = slog.New(handler)
 
+	if settingsErr != nil {
+		logger.Warn("failed to read settings",
+			slog.String("error", settingsErr.Error()))
+	}
+
 	//
 	// Catch errors
 	//
@@ -160,14 +173,20 @@ func main() {
 	subcommands.Register(&addCmd{})
 	subcommands.Register(&cronCmd{})
 	subcommands.Register(&configCmd{})
+	subcommands.Register(&convertCmd{})
 	subcommands.Register(&daemonCmd{})
 	subcommands.Register(&delCmd{})
 	subcommands.Register(&exportCmd{})
 	subcommands.Register(&importCmd{})
 	subcommands.Register(&listCmd{})
 	subcommands.Register(&listDefaultTemplateCmd{})
+	subcommands.Register(&optionsCmd{})
+	subcommands.Register(&outboxCmd{})
+	subcommands.Register(&queueCmd{})
 	subcommands.Register(&seenCmd{})
+	subcommands.Register(&setCmd{})
 	subcommands.Register(&unseeCmd{})
+	subcommands.Register(&unsetCmd{})
 	subcommands.Register(&versionCmd{})
 
 	//
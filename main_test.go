@@ -4,8 +4,8 @@
 package main
 
 import (
+	"io"
 	"log/slog"
-	"os"
 )
 
 // init runs at test-time.
@@ -15,9 +15,10 @@ func init() {
 	lvl := &slog.LevelVar{}
 	lvl.Set(slog.LevelWarn)
 
-	// create a handler
+	// create a handler, which discards the output rather than
+	// writing it anywhere within the working tree.
 	opts := &slog.HandlerOptions{Level: lvl}
-	handler := slog.NewTextHandler(os.Stderr, opts)
+	handler := slog.NewTextHandler(io.Discard, opts)
 
 	// ensure the global-variable is set.
 	logger = slog.New(handler)
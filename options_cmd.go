@@ -0,0 +1,92 @@
+//
+// Show the options of the feeds in our feed-list.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// Structure for our options and state.
+type optionsCmd struct {
+
+	// Configuration file, used for testing
+	config *configfile.ConfigFile
+
+	// tag selects the feeds with the given tag.
+	tag string
+}
+
+// Arguments handles argument-flags we might have.
+//
+// In our case we use this as a hook to setup our configuration-file,
+// which allows testing.
+func (o *optionsCmd) Arguments(flags *flag.FlagSet) {
+	o.config = configfile.New()
+
+	flags.StringVar(&o.tag, "tag", "", "Show the feeds with the given tag.")
+}
+
+// Info is part of the subcommand-API
+func (o *optionsCmd) Info() (string, string) {
+	return "options", `Show the options set on the feeds in our feed-list.
+
+Show the per-feed options of the feeds with the given URLs, or of all
+feeds if none are given.  The '-tag' flag may be used to show only the
+feeds with the given tag.
+
+Example:
+
+    $ rss2email options
+    $ rss2email options https://blog.steve.fi/index.rss
+    $ rss2email options -tag news
+`
+}
+
+// Execute is invoked if the user specifies `options` as the subcommand.
+func (o *optionsCmd) Execute(args []string) int {
+
+	// Parse the existing file
+	entries, err := o.config.Parse()
+	if err != nil {
+		logger.Error("failed to parse configuration file",
+			slog.String("configfile", o.config.Path()),
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	// Work out which feeds to show.
+	show := make(map[string]bool)
+	if o.tag != "" {
+		urls, _, err := selectFeeds(entries, o.tag, nil)
+		if err != nil {
+			logger.Error("failed to find the feeds to show", slog.String("error", err.Error()))
+			return 1
+		}
+		for _, url := range urls {
+			show[url] = true
+		}
+	}
+	for _, arg := range args {
+		show[arg] = true
+	}
+
+	for _, entry := range entries {
+		if len(show) > 0 && !show[entry.URL] {
+			continue
+		}
+
+		fmt.Fprintf(out, "%s\n", entry.URL)
+		for _, opt := range entry.Options {
+			fmt.Fprintf(out, " - %s:%s\n", opt.Name, opt.Value)
+		}
+	}
+
+	// All done, with no errors.
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+func TestOptions(t *testing.T) {
+
+	path := optionsHelper(t, `https://example.org/
+ - tag: news
+https://example.net/
+ - retry: 3
+`)
+
+	bak := out
+	defer func() { out = bak }()
+
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "https://example.org/\n - tag:news\nhttps://example.net/\n - retry:3\n"},
+		{[]string{"https://example.net/"}, "https://example.net/\n - retry:3\n"},
+		{[]string{"-tag", "news"}, "https://example.org/\n - tag:news\n"},
+	} {
+
+		out = &bytes.Buffer{}
+
+		opts := optionsCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		opts.Arguments(flags)
+		opts.config = configfile.NewWithPath(path)
+
+		err := flags.Parse(test.args)
+		if err != nil {
+			t.Fatalf("Error parsing flags: %s", err)
+		}
+		if opts.Execute(flags.Args()) != 0 {
+			t.Fatalf("unexpected error with %v", test.args)
+		}
+
+		if out.(*bytes.Buffer).String() != test.expected {
+			t.Fatalf("unexpected output for %v: %s", test.args, out.(*bytes.Buffer).String())
+		}
+	}
+}
@@ -0,0 +1,151 @@
+//
+// Show, retry, or drop, the messages which failed to be delivered.
+//
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/mail"
+	"os"
+	"strconv"
+
+	"github.com/skx/rss2email/processor"
+)
+
+// Structure for our options and state.
+type outboxCmd struct {
+
+	// retry causes the messages to be retried immediately.
+	retry bool
+
+	// drop causes the messages to be removed.
+	drop bool
+}
+
+// Arguments handles our flag-setup.
+func (o *outboxCmd) Arguments(f *flag.FlagSet) {
+	f.BoolVar(&o.retry, "retry", false, "Retry delivery of the given messages, or all messages, immediately.")
+	f.BoolVar(&o.drop, "drop", false, "Remove the given messages, without delivering them.")
+}
+
+// Info is part of the subcommand-API
+func (o *outboxCmd) Info() (string, string) {
+	return "outbox", `Show the messages which could not be delivered.
+
+If sending an email fails the message is saved to an outbox, within our
+state database, and the cron and daemon sub-commands will retry delivery
+on subsequent runs.  The delay between attempts doubles each time, from
+five minutes up to a maximum of one day.
+
+This sub-command shows the messages which are in the outbox, along with
+the error which was encountered the last time delivery was attempted.
+
+Messages may be retried immediately via the '-retry' flag, or removed via
+the '-drop' flag, each of which accepts a list of message IDs.  If no IDs
+are given to '-retry' then all messages will be retried.
+
+Example:
+
+    $ rss2email outbox
+    $ rss2email outbox -retry
+    $ rss2email outbox -drop 3 4
+`
+}
+
+// subject returns the (decoded) subject of the given message.
+func subject(msg []byte) string {
+
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		return ""
+	}
+
+	dec := new(mime.WordDecoder)
+	s, err := dec.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		return m.Header.Get("Subject")
+	}
+	return s
+}
+
+// Entry-point.
+func (o *outboxCmd) Execute(args []string) int {
+
+	// Parse the IDs we were given.
+	var ids []uint64
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid message ID '%s'\n", arg)
+			return 1
+		}
+		ids = append(ids, id)
+	}
+
+	if o.drop && len(ids) == 0 {
+		fmt.Printf("Usage: rss2email outbox -drop id1 .. idN\n")
+		return 1
+	}
+
+	// Create the helper
+	p, err := processor.New()
+	if err != nil {
+		logger.Error("failed to create feed processor",
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	// Close the database handle, once processed.
+	defer p.Close()
+
+	p.SetLogger(logger)
+
+	// Dropping?
+	if o.drop {
+		err = p.DropOutbox(ids)
+		if err != nil {
+			logger.Error("failed to remove messages from the outbox",
+				slog.String("error", err.Error()))
+			return 1
+		}
+		return 0
+	}
+
+	// Retrying?
+	if o.retry {
+
+		errors := p.RetryOutbox(true, ids)
+
+		// If we found errors then show them.
+		if len(errors) != 0 {
+			for _, err := range errors {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+			return 1
+		}
+		return 0
+	}
+
+	entries, err := p.Outbox()
+	if err != nil {
+		logger.Error("failed to read the outbox",
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	for _, entry := range entries {
+		fmt.Fprintf(out, "%d\t%s\t%s\n", entry.ID, entry.Recipient, subject(entry.Message))
+		fmt.Fprintf(out, "\tFeed: %s\n", entry.Feed)
+		fmt.Fprintf(out, "\tAttempts: %d, since %s, next %s\n", entry.Attempts,
+			entry.Created.Format("2006-01-02 15:04"),
+			entry.NextAttempt.Format("2006-01-02 15:04"))
+		fmt.Fprintf(out, "\tError: %s\n", entry.LastError)
+	}
+
+	return 0
+}
@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 2
+
+// diffLimit is the maximum size of the table we'll build when comparing
+// two texts, larger texts are compared more crudely.
+const diffLimit = 4 * 1024 * 1024
+
+// textDiff returns a line-based diff of the two texts, in which removed
+// lines are prefixed with "- ", added lines with "+ ", and unchanged lines
+// which give context to the changes with two spaces.
+func textDiff(old string, new string) string {
+
+	a := strings.Split(strings.TrimRight(old, "\n"), "\n")
+	b := strings.Split(strings.TrimRight(new, "\n"), "\n")
+
+	// Strip the common prefix and suffix, which is often most of the
+	// text, to keep the table small.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]string, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		lines = append(lines, "  "+l)
+	}
+	lines = append(lines, diffLines(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, "  "+l)
+	}
+
+	return strings.Join(trimContext(lines), "\n")
+}
+
+// diffLines compares the two lists of lines, using the longest common
+// subsequence to find the lines which were removed and added.
+func diffLines(a []string, b []string) []string {
+
+	var out []string
+
+	// If the table would be too large then show everything as changed.
+	if (len(a)+1)*(len(b)+1) > diffLimit {
+		for _, l := range a {
+			out = append(out, "- "+l)
+		}
+		for _, l := range b {
+			out = append(out, "+ "+l)
+		}
+		return out
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+ "+b[j])
+	}
+
+	return out
+}
+
+// trimContext removes the unchanged lines which are not close to a change,
+// replacing each run of them with "...".
+func trimContext(lines []string) []string {
+
+	// Find the lines we'll keep.
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if strings.HasPrefix(l, "  ") {
+			continue
+		}
+		for j := max(0, i-diffContext); j <= min(len(lines)-1, i+diffContext); j++ {
+			keep[j] = true
+		}
+	}
+
+	var out []string
+	skipped := false
+	for i, l := range lines {
+		if keep[i] {
+			out = append(out, l)
+			skipped = false
+			continue
+		}
+		if !skipped {
+			out = append(out, "...")
+			skipped = true
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,33 @@
+package processor
+
+import (
+	"testing"
+)
+
+// TestTextDiff tests our line-based diff.
+func TestTextDiff(t *testing.T) {
+
+	tests := []struct {
+		old      string
+		new      string
+		expected string
+	}{
+		{"one\ntwo\nthree", "one\n2\nthree",
+			"  one\n- two\n+ 2\n  three"},
+		{"one\ntwo", "one\ntwo\nthree\n",
+			"  one\n  two\n+ three"},
+		{"a\nb\nc\nd\ne\nf\ng\nh", "a\nb\nc\nd\ne\nf\ng\nH",
+			"...\n  f\n  g\n- h\n+ H"},
+		{"a\nb\nc\nd\ne\nf\ng\nh", "A\nb\nc\nd\ne\nf\ng\nh",
+			"- a\n+ A\n  b\n  c\n..."},
+		{"x\na\nb\ny", "x\nb\nc\ny",
+			"  x\n- a\n  b\n+ c\n  y"},
+	}
+
+	for _, test := range tests {
+		out := textDiff(test.old, test.new)
+		if out != test.expected {
+			t.Fatalf("unexpected diff of %q and %q:\n%s\nexpected:\n%s", test.old, test.new, out, test.expected)
+		}
+	}
+}
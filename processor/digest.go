@@ -0,0 +1,165 @@
+package processor
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/processor/emailer"
+	"github.com/skx/rss2email/state"
+)
+
+// digest holds a collection of new items, which will be sent as a single
+// email rather than one email per item.
+//
+// The items are only marked as having been seen once the digest has been
+// sent, so that they'll be retried in the future if sending fails.
+type digest struct {
+
+	// recipients holds the addresses to which the digest is sent.
+	recipients []string
+
+	// opts holds the options of the source feed, if all the items
+	// came from a single feed.
+	opts []configfile.Option
+
+	// items holds the entries which will be included.
+	items []emailer.DigestItem
+
+	// feeds holds the URL of the feed from which each item came,
+	// in the configuration file.  This is used to record the state.
+	feeds []string
+
+	// ids holds the identity of each item, the key under which its
+	// state is recorded.
+	ids []string
+
+	// records holds the record of each item, which is stored once the
+	// digest has been sent.
+	records []state.Record
+}
+
+// add appends a new item to the digest, along with its record.
+func (d *digest) add(feed string, id string, item emailer.DigestItem, rec state.Record) {
+	d.items = append(d.items, item)
+	d.feeds = append(d.feeds, feed)
+	d.ids = append(d.ids, id)
+	d.records = append(d.records, rec)
+}
+
+// source returns the feed from which the items came, or the feeds
+// separated by commas if this is a digest of several feeds.
+func (d *digest) source() string {
+
+	var feeds []string
+	seen := make(map[string]bool)
+
+	for _, feed := range d.feeds {
+		if !seen[feed] {
+			seen[feed] = true
+			feeds = append(feeds, feed)
+		}
+	}
+	return strings.Join(feeds, ", ")
+}
+
+// outboxItems returns the items of the digest, as they're recorded in our
+// outbox.
+func (d *digest) outboxItems() []OutboxItem {
+
+	var items []OutboxItem
+	for i := range d.ids {
+		items = append(items, OutboxItem{Feed: d.feeds[i], Key: d.ids[i]})
+	}
+	return items
+}
+
+// isDigest returns true if the given feed should send a digest, rather
+// than an email per item.
+func isDigest(entry configfile.Feed) bool {
+	for _, opt := range entry.Options {
+		if opt.Name == "digest" {
+			val := strings.ToLower(opt.Value)
+			if val == "yes" || val == "true" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runDigest returns the digest which collects items for the given
+// recipients, over the whole run.
+func (p *Processor) runDigest(recipients []string) *digest {
+
+	key := strings.Join(recipients, ",")
+
+	d, ok := p.digests[key]
+	if !ok {
+		d = &digest{recipients: recipients}
+		p.digests[key] = d
+	}
+	return d
+}
+
+// sendDigest sends the given digest, and records each of the items within
+// it as having been seen.
+func (p *Processor) sendDigest(logger *slog.Logger, d *digest) error {
+
+	if len(d.items) == 0 {
+		return nil
+	}
+
+	var failed []string
+
+	helper := emailer.NewDigest(d.items, d.opts, logger)
+	helper.SetSession(p.smtp)
+	err := helper.SendDigest(d.recipients)
+	if err != nil {
+
+		// Save any failed messages to our outbox, so they
+		// can be retried.
+		failed, err = p.saveFailures(logger, d.source(), d.outboxItems(), err)
+		if err != nil {
+
+			logger.Error("failed to send digest",
+				slog.String("recipients", strings.Join(d.recipients, ",")),
+				slog.String("error", err.Error()))
+
+			return err
+		}
+	}
+
+	for i := range d.items {
+
+		rec := d.records[i]
+		rec.SetDelivery(d.recipients, failed)
+
+		err = p.recordItem(d.feeds[i], d.ids[i], rec)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendRunDigests sends all the digests which were collected over the
+// course of this run, returning any errors.
+func (p *Processor) sendRunDigests() []error {
+
+	var errors []error
+
+	for _, d := range p.digests {
+		err := p.sendDigest(p.logger, d)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("error sending digest to %s - %s", strings.Join(d.recipients, ","), err))
+		}
+	}
+
+	// Reset for the next run.
+	p.digests = make(map[string]*digest)
+
+	return errors
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/skx/rss2email/processor/emailer"
+	"github.com/skx/rss2email/state"
+	"go.etcd.io/bbolt"
+)
+
+// TestDigestSource ensures a failed digest is filed under each of the feeds
+// it contains.
+func TestDigestSource(t *testing.T) {
+
+	d := &digest{}
+	d.add("https://example.com/", "1", emailer.DigestItem{}, state.Record{})
+	d.add("https://example.com/", "2", emailer.DigestItem{}, state.Record{})
+	if d.source() != "https://example.com/" {
+		t.Fatalf("unexpected source %s", d.source())
+	}
+
+	d.add("https://example.org/", "3", emailer.DigestItem{}, state.Record{})
+	if d.source() != "https://example.com/, https://example.org/" {
+		t.Fatalf("unexpected source %s", d.source())
+	}
+}
+
+// TestDigestRecords ensures the items in a digest are recorded with their
+// text, so that updates to them can be found.
+func TestDigestRecords(t *testing.T) {
+
+	// Use a temporary state-directory
+	t.Setenv("HOME", t.TempDir())
+
+	// Ensure delivery fails, rather than sending a real email, the
+	// items are recorded regardless.
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", "1")
+	t.Setenv("SMTP_USERNAME", "user")
+	t.Setenv("SMTP_PASSWORD", "pass")
+
+	p, err := New()
+	if err != nil {
+		t.Fatalf("error creating processor %s", err.Error())
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	feed := "https://example.com/"
+	err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(feed))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create bucket: %s", err)
+	}
+
+	d := &digest{recipients: []string{"bob@example.com"}}
+	d.add(feed, "https://example.com/one",
+		emailer.DigestItem{Subject: "one", Link: "https://example.com/one", Text: "body"},
+		state.Record{Title: "one", Hash: textHash("body"), Text: "body"})
+
+	err = p.sendDigest(logger, d)
+	if err != nil {
+		t.Fatalf("unexpected error sending digest: %s", err)
+	}
+
+	var rec state.Record
+	err = p.dbHandle.View(func(tx *bbolt.Tx) error {
+		rec, err = state.ParseRecord(tx.Bucket([]byte(feed)).Get([]byte("https://example.com/one")))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to read record: %s", err)
+	}
+	if rec.Status != state.StatusFailed || rec.Hash != textHash("body") || rec.Text != "body" {
+		t.Fatalf("unexpected record after digest %v", rec)
+	}
+}
@@ -0,0 +1,192 @@
+package emailer
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/settings"
+)
+
+// addressing holds the addresses used for our messages, which are set via
+// the per-feed options, or the FROM and SENDER settings.
+type addressing struct {
+
+	// single is set if we send one message to all the recipients,
+	// rather than a message to each of them.
+	single bool
+
+	// cc and bcc hold additional recipients of a single message.
+	cc  []string
+	bcc []string
+
+	// from is the address shown in the From header.
+	from string
+
+	// sender is the envelope sender.
+	sender string
+
+	// replyTo is the address shown in the Reply-To header.
+	replyTo string
+}
+
+// message holds the addresses of one of the messages we send.
+type message struct {
+
+	// to holds the addresses shown in the To header.
+	to []string
+
+	// recipients holds the envelope recipients, including any
+	// which are only shown in the Cc header, or not shown at all.
+	recipients []string
+
+	// from and sender are the header, and envelope, senders.
+	from   string
+	sender string
+}
+
+// newAddressing returns the addresses to use, from the given options and
+// our global settings.
+func newAddressing(opts []configfile.Option) (addressing, error) {
+
+	a := addressing{
+		from:   strings.TrimSpace(settings.Get("FROM")),
+		sender: strings.TrimSpace(settings.Get("SENDER")),
+	}
+
+	for _, opt := range opts {
+		switch opt.Name {
+		case "delivery":
+			a.single = strings.EqualFold(opt.Value, "single")
+		case "cc":
+			a.cc = splitAddresses(opt.Value)
+		case "bcc":
+			a.bcc = splitAddresses(opt.Value)
+		case "from":
+			a.from = strings.TrimSpace(opt.Value)
+		case "sender":
+			a.sender = strings.TrimSpace(opt.Value)
+		case "reply-to":
+			a.replyTo = strings.TrimSpace(opt.Value)
+		}
+	}
+
+	// Copies only make sense if we're sending a single message.
+	if len(a.cc) > 0 || len(a.bcc) > 0 {
+		a.single = true
+	}
+
+	// The settings aren't checked when they're loaded.
+	for name, addr := range map[string]string{"from": a.from, "sender": a.sender} {
+		if addr == "" {
+			continue
+		}
+		_, err := mail.ParseAddress(addr)
+		if err != nil {
+			return a, fmt.Errorf("invalid %s address '%s': %s", name, addr, err)
+		}
+	}
+
+	return a, nil
+}
+
+// messages returns the messages we send to the given addresses.
+//
+// Unless configured otherwise each address receives its own message, which
+// appears to be from the recipient, as has always been the case.
+func (a addressing) messages(addresses []string) []message {
+
+	var groups [][]string
+	if a.single {
+		groups = [][]string{addresses}
+	} else {
+		for _, addr := range addresses {
+			groups = append(groups, []string{addr})
+		}
+	}
+
+	var msgs []message
+	for _, to := range groups {
+
+		m := message{
+			to:     to,
+			from:   a.from,
+			sender: a.sender,
+		}
+
+		m.recipients = append(m.recipients, to...)
+		m.recipients = append(m.recipients, a.cc...)
+		m.recipients = append(m.recipients, a.bcc...)
+
+		if m.from == "" {
+			m.from = to[0]
+		}
+		if m.sender == "" {
+			m.sender = bareAddress(m.from)
+		}
+
+		msgs = append(msgs, m)
+	}
+
+	return msgs
+}
+
+// failure records that this message could not be delivered.
+func (m message) failure(msg []byte, err error) Failure {
+	return Failure{
+		Recipient:  strings.Join(m.recipients, ", "),
+		Recipients: m.recipients,
+		Sender:     m.sender,
+		Message:    msg,
+		Err:        err,
+	}
+}
+
+// splitAddresses splits a comma-delimited list of addresses.
+func splitAddresses(value string) []string {
+
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// formatAddress returns the address for use in a header, quoting, and
+// encoding, any display name as required.
+func formatAddress(addr string) string {
+
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	if parsed.Name == "" {
+		return parsed.Address
+	}
+	return parsed.String()
+}
+
+// formatAddresses returns the given addresses for use in a header.
+func formatAddresses(addrs []string) string {
+
+	var out []string
+	for _, addr := range addrs {
+		out = append(out, formatAddress(addr))
+	}
+	return strings.Join(out, ", ")
+}
+
+// bareAddress returns the address alone, without any display name, for
+// use in the envelope.
+func bareAddress(addr string) string {
+
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return parsed.Address
+}
@@ -0,0 +1,160 @@
+package emailer
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/withstate"
+)
+
+// TestAddressing ensures the messages we send are addressed as configured.
+func TestAddressing(t *testing.T) {
+
+	t.Setenv("FROM", "")
+	t.Setenv("SENDER", "")
+
+	recipients := []string{"bob@example.com", "Alice <alice@example.com>"}
+
+	// By default each recipient gets a message from themselves.
+	a, err := newAddressing(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	msgs := a.messages(recipients)
+	if len(msgs) != 2 || msgs[1].from != "Alice <alice@example.com>" || msgs[1].sender != "alice@example.com" || len(msgs[1].recipients) != 1 {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+
+	// Copies imply a single message.
+	a, _ = newAddressing([]configfile.Option{
+		{Name: "cc", Value: "carol@example.com, dave@example.com"},
+		{Name: "from", Value: "Feeds <rss2email@example.org>"},
+	})
+	msgs = a.messages(recipients)
+	if len(msgs) != 1 || len(msgs[0].to) != 2 || len(msgs[0].recipients) != 4 {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+	if msgs[0].from != "Feeds <rss2email@example.org>" || msgs[0].sender != "rss2email@example.org" {
+		t.Fatalf("unexpected sender %v", msgs[0])
+	}
+
+	a, _ = newAddressing([]configfile.Option{
+		{Name: "delivery", Value: "Single"},
+		{Name: "sender", Value: "bounces@example.org"},
+	})
+	msgs = a.messages(recipients)
+	if len(msgs) != 1 || msgs[0].from != "bob@example.com" || msgs[0].sender != "bounces@example.org" {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+}
+
+// TestGlobalFrom ensures the FROM and SENDER settings are used, unless
+// the options of a feed replace them.
+func TestGlobalFrom(t *testing.T) {
+
+	t.Setenv("FROM", `"Security Feeds" <feeds@corp>`)
+	t.Setenv("SENDER", "")
+
+	a, err := newAddressing(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	msgs := a.messages([]string{"bob@example.com"})
+	if msgs[0].from != `"Security Feeds" <feeds@corp>` || msgs[0].sender != "feeds@corp" {
+		t.Fatalf("unexpected message %v", msgs[0])
+	}
+
+	t.Setenv("SENDER", "bounces@corp")
+	a, _ = newAddressing([]configfile.Option{{Name: "from", Value: "news@example.com"}})
+	msgs = a.messages([]string{"bob@example.com"})
+	if msgs[0].from != "news@example.com" || msgs[0].sender != "bounces@corp" {
+		t.Fatalf("unexpected message %v", msgs[0])
+	}
+
+	t.Setenv("FROM", "not an address")
+	_, err = newAddressing(nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid from address") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestFormatAddress ensures display names are quoted, and encoded, for use
+// in headers.
+func TestFormatAddress(t *testing.T) {
+
+	tests := map[string]string{
+		"bob@example.com":               "bob@example.com",
+		"<bob@example.com>":             "bob@example.com",
+		"Bob <bob@example.com>":         `"Bob" <bob@example.com>`,
+		`"Security Feeds" <feeds@corp>`: `"Security Feeds" <feeds@corp>`,
+		"Zoë <zoe@example.com>":         "=?utf-8?q?Zo=C3=AB?= <zoe@example.com>",
+		"not an address":                "not an address",
+	}
+
+	for in, expected := range tests {
+		if got := formatAddress(in); got != expected {
+			t.Fatalf("formatAddress(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+// TestSingleDelivery ensures one message is sent to all the recipients,
+// and any copies.
+func TestSingleDelivery(t *testing.T) {
+
+	f := newFakeSMTP(t, nil)
+	useServer(t, f)
+
+	feed := &gofeed.Feed{Link: "https://example.com/", Title: "Example"}
+	item := withstate.FeedItem{Item: &gofeed.Item{Link: "https://example.com/one", Title: "First"}}
+
+	e := New(feed, item, []configfile.Option{
+		{Name: "delivery", Value: "single"},
+		{Name: "bcc", Value: "archive@example.com"},
+		{Name: "cc", Value: "carol@example.com"},
+		{Name: "from", Value: "Feeds <rss2email@example.org>"},
+		{Name: "reply-to", Value: "list@example.org"},
+		{Name: "sender", Value: "bounces@example.org"},
+	}, slog.Default())
+
+	err := e.Sendmail([]string{"bob@example.com", "Alice <alice@example.com>"}, "text", "<p>html</p>")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	msgs := f.received()
+	if len(msgs) != 1 {
+		t.Fatalf("unexpected messages %v", msgs)
+	}
+
+	msg := msgs[0]
+	if msg.from != "bounces@example.org" || strings.Join(msg.to, " ") != "bob@example.com alice@example.com carol@example.com archive@example.com" {
+		t.Fatalf("unexpected envelope %s %v", msg.from, msg.to)
+	}
+
+	for _, header := range []string{
+		"From: \"Feeds\" <rss2email@example.org>\n",
+		"To: bob@example.com, \"Alice\" <alice@example.com>\n",
+		"Cc: carol@example.com\n",
+		"Reply-To: list@example.org\n",
+	} {
+		if !strings.Contains(msg.data, header) {
+			t.Fatalf("missing header %q in %s", header, msg.data)
+		}
+	}
+	if strings.Contains(msg.data, "archive@example.com") {
+		t.Fatalf("the hidden copy was shown: %s", msg.data)
+	}
+
+	// A failure is recorded for all the recipients.
+	f.reject = "carol@example.com"
+	err = e.Sendmail([]string{"bob@example.com"}, "text", "<p>html</p>")
+
+	derr, ok := err.(*DeliveryError)
+	if !ok || len(derr.Failures) != 1 || len(derr.Failures[0].Recipients) != 3 || derr.Failures[0].Sender != "bounces@example.org" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -3,7 +3,7 @@
 //
 // There are two ways emails are sent:
 //
-//  1. Via spawning /usr/sbin/sendmail.
+//  1. Via spawning /usr/sbin/sendmail, or the SENDMAIL_COMMAND.
 //
 //  2. Via SMTP.
 //
@@ -16,20 +16,17 @@ import (
 	"errors"
 	"fmt"
 	"html"
-	"io"
 	"log/slog"
 	"mime/quotedprintable"
-	"net/smtp"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/mmcdole/gofeed"
 	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/settings"
 	"github.com/skx/rss2email/state"
 	emailtemplate "github.com/skx/rss2email/template"
 	"github.com/skx/rss2email/withstate"
@@ -44,11 +41,20 @@ type Emailer struct {
 	// Item is the feed item itself
 	item withstate.FeedItem
 
+	// Items contains the entries to be sent in a digest, if any.
+	items []DigestItem
+
 	// Config options for the feed.
 	opts []configfile.Option
 
+	// diff contains the changes made to an updated item, if any.
+	diff string
+
 	// logger contains a dedicated logging object
 	logger *slog.Logger
+
+	// session is the SMTP session we send via, if any.
+	session *Session
 }
 
 // New creates a new Emailer object.
@@ -69,11 +75,48 @@ func New(feed *gofeed.Feed, item withstate.FeedItem, opts []configfile.Option, l
 	return obj
 }
 
-// env returns the contents of an environmental variable.
+// SetDiff marks the item as having been updated since we last sent it,
+// the given diff shows the changes which were made to the item.
+func (e *Emailer) SetDiff(diff string) {
+	e.diff = diff
+}
+
+// SetSession causes messages to be sent via the given SMTP session, rather
+// than connecting to the SMTP server for each message.
+func (e *Emailer) SetSession(session *Session) {
+	e.session = session
+}
+
+// NewDigest creates a new Emailer object, which will send the given
+// items as a single digest email.
+//
+// The options are those of the source feed, if the items all came from
+// a single feed.
+func NewDigest(items []DigestItem, opts []configfile.Option, log *slog.Logger) *Emailer {
+
+	obj := &Emailer{items: items, opts: opts}
+
+	obj.logger = log.With(
+		slog.Group("email",
+			slog.Bool("digest", true),
+			slog.Int("items", len(items))))
+
+	return obj
+}
+
+// NewDelivery creates a new Emailer object, which is only used to deliver
+// messages which have already been rendered - such as those which are
+// being retried from our outbox.
+func NewDelivery(log *slog.Logger) *Emailer {
+	return &Emailer{logger: log}
+}
+
+// env returns the contents of an environmental variable, or of the global
+// setting with the same name.
 //
 // This function exists to be used by our email-template.
 func env(s string) string {
-	return (os.Getenv(s))
+	return (settings.Get(s))
 }
 
 // split converts a string to an array.
@@ -83,6 +126,13 @@ func split(in string, delim string) []string {
 	return strings.Split(in, delim)
 }
 
+// inc adds one to the given number.
+//
+// This function exists to be used by our digest-template, to number items.
+func inc(n int) int {
+	return n + 1
+}
+
 // loadTemplate loads the template used for sending the email notification.
 func (e *Emailer) loadTemplate() (*template.Template, error) {
 
@@ -95,10 +145,16 @@ func (e *Emailer) loadTemplate() (*template.Template, error) {
 	// The path to the overridden template
 	override := filepath.Join(stateDir, "email.tmpl")
 
-	// If a per feed template was set, get it here.
-	for _, opt := range e.opts {
-		if opt.Name == "template" {
-			override = filepath.Join(stateDir, opt.Value)
+	// Digests have their own template, otherwise a per feed template
+	// might have been set, get it here.
+	if e.items != nil {
+		content = emailtemplate.DigestTemplate()
+		override = filepath.Join(stateDir, "digest.tmpl")
+	} else {
+		for _, opt := range e.opts {
+			if opt.Name == "template" {
+				override = filepath.Join(stateDir, opt.Value)
+			}
 		}
 	}
 
@@ -125,6 +181,7 @@ func (e *Emailer) loadTemplate() (*template.Template, error) {
 		"split":            split,
 		"encodeHeader":     encodeHeader,
 		"makeListIdHeader": makeListIdHeader,
+		"inc":              inc,
 	}
 
 	tmpl := template.Must(template.New("email.tmpl").Funcs(funcMap).Parse(string(content)))
@@ -187,14 +244,130 @@ func makeListIdHeader(s string) string {
 	return sh + ".localhost"
 }
 
+// Failure records a message which could not be delivered.
+type Failure struct {
+
+	// Recipient is the address to which the message was being sent, or
+	// the addresses separated by commas if it was sent to several.
+	Recipient string
+
+	// Recipients holds each of the addresses to which the message was
+	// being sent, including any copies.
+	Recipients []string
+
+	// Sender is the envelope sender of the message.
+	Sender string
+
+	// Message contains the rendered message.
+	Message []byte
+
+	// Err is the error which was encountered.
+	Err error
+}
+
+// DeliveryError is returned when one or more messages could not be
+// delivered, it contains the details of each failure so that the
+// messages may be retried in the future.
+type DeliveryError struct {
+
+	// Failures contains the messages which could not be delivered.
+	Failures []Failure
+}
+
+// Error is part of the error interface.
+func (d *DeliveryError) Error() string {
+
+	var msgs []string
+	for _, f := range d.Failures {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Recipient, f.Err))
+	}
+
+	return "failed to deliver email to " + strings.Join(msgs, ", ")
+}
+
+// templateParms is the structure used to populate our email templates.
+type templateParms struct {
+	Feed      string
+	FeedTitle string
+	From      string
+	HTML      string
+	Link      string
+	Subject   string
+	Tag       string
+	Text      string
+	To        string
+
+	// Cc holds the addresses to which copies are sent, and ReplyTo
+	// the address to which replies should be sent, if any.
+	Cc      string
+	ReplyTo string
+
+	// Updated is true if the item has been updated since it was
+	// first sent, in which case Diff contains the changes which were
+	// made and HTMLDiff contains the same, escaped for use in HTML.
+	Updated  bool
+	Diff     string
+	HTMLDiff string
+
+	// Items contains the entries which are included in a digest,
+	// this is empty for emails which refer to a single item.
+	Items []DigestItem
+
+	// In case people need access to fields
+	// we've not wrapped/exported explicitly
+	RSSFeed *gofeed.Feed
+	RSSItem withstate.FeedItem
+}
+
+// DigestItem holds the details of a single feed item, which is to be
+// included in a digest email along with others.
+type DigestItem struct {
+
+	// Feed is the link of the feed from which the item came.
+	Feed string `json:"feed"`
+
+	// FeedTitle is the human-readable title of the source feed.
+	FeedTitle string `json:"feed_title"`
+
+	// Link is the link to the item.
+	Link string `json:"link"`
+
+	// Subject is the title of the item.
+	Subject string `json:"subject"`
+
+	// Tag is the tag of the feed, if any.
+	Tag string `json:"tag,omitempty"`
+
+	// Text contains the text version of the item's content.
+	//
+	// This is quoted-printable encoded when the template is rendered.
+	Text string `json:"text"`
+
+	// HTML contains the HTML version of the item's content.
+	//
+	// This is quoted-printable encoded when the template is rendered.
+	HTML string `json:"html"`
+
+	// RSSFeed and RSSItem give access to the fields we've not wrapped
+	// explicitly.  They're not available for all digests.
+	RSSFeed *gofeed.Feed       `json:"-"`
+	RSSItem withstate.FeedItem `json:"-"`
+}
+
 // Sendmail is a simple function that emails the given address.
 //
 // We send a MIME message with both a plain-text and a HTML-version of the
 // message.  This should be nicer for users.
+//
+// If delivery to any of the addresses fails we continue with the rest,
+// and return a *DeliveryError which contains the failed messages.
 func (e *Emailer) Sendmail(addresses []string, textstr string, htmlstr string) error {
 
 	var err error
 
+	// The messages we failed to deliver.
+	var failures []Failure
+
 	//
 	// Ensure we have a recipient.
 	//
@@ -207,41 +380,26 @@ func (e *Emailer) Sendmail(addresses []string, textstr string, htmlstr string) e
 	}
 
 	//
-	// Process each address
+	// Process each message, usually there is one for each address.
 	//
-	for _, addr := range addresses {
-
-		//
-		// Here is a temporary structure we'll use to popular our email
-		// template.
-		//
-		type TemplateParms struct {
-			Feed      string
-			FeedTitle string
-			From      string
-			HTML      string
-			Link      string
-			Subject   string
-			Tag       string
-			Text      string
-			To        string
-
-			// In case people need access to fields
-			// we've not wrapped/exported explicitly
-			RSSFeed *gofeed.Feed
-			RSSItem withstate.FeedItem
-		}
+	addrs, err := newAddressing(e.opts)
+	if err != nil {
+		return err
+	}
+	for _, m := range addrs.messages(addresses) {
 
 		//
-		// Populate it appropriately.
+		// Populate our template parameters appropriately.
 		//
-		var x TemplateParms
+		var x templateParms
 		x.Feed = e.feed.Link
 		x.FeedTitle = e.feed.Title
-		x.From = addr
+		x.From = formatAddress(m.from)
 		x.Link = e.item.Link
 		x.Subject = e.item.Title
-		x.To = addr
+		x.To = formatAddresses(m.to)
+		x.Cc = formatAddresses(addrs.cc)
+		x.ReplyTo = formatAddresses(splitAddresses(addrs.replyTo))
 		x.RSSFeed = e.feed
 		x.RSSItem = e.item
 		x.Tag = e.item.Tag
@@ -257,210 +415,258 @@ func (e *Emailer) Sendmail(addresses []string, textstr string, htmlstr string) e
 			return err
 		}
 
-		//
-		// Load the template we're going to render.
-		//
-		var t *template.Template
-		t, err = e.loadTemplate()
-		if err != nil {
-			return err
-		}
-
-		//
-		// Render the template into the buffer.
-		//
-		buf := &bytes.Buffer{}
-		err = t.Execute(buf, x)
-		if err != nil {
-			return err
-		}
-
-		//
-		// Are we sending via SMTP?
-		//
-		if e.isSMTP() {
-
-			e.logger.Debug("preparing to send email",
-				slog.String("recipient", addr),
-				slog.String("method", "smtp"))
-
-			err := e.sendSMTP(addr, buf.Bytes())
+		// If the item was updated then include the changes.
+		if e.diff != "" {
+			x.Updated = true
+			x.Diff, err = toQuotedPrintable(e.diff)
 			if err != nil {
-
-				e.logger.Error("error sending email",
-					slog.String("recipient", addr),
-					slog.String("method", "smtp"),
-					slog.String("error", err.Error()))
-
 				return err
 			}
-
-			e.logger.Debug("email sent",
-				slog.String("recipient", addr),
-				slog.String("method", "smtp"))
-
-		} else {
-
-			e.logger.Debug("preparing to send email",
-				slog.String("recipient", addr),
-				slog.String("method", "sendmail"))
-
-			err := e.sendSendmail(addr, buf.Bytes())
+			x.HTMLDiff, err = toQuotedPrintable(html.EscapeString(e.diff))
 			if err != nil {
-				e.logger.Error("error sending email",
-					slog.String("recipient", addr),
-					slog.String("method", "sendmail"),
-					slog.String("error", err.Error()))
 				return err
 			}
+		}
 
-			e.logger.Debug("email sent",
-				slog.String("recipient", addr),
-				slog.String("method", "sendmail"))
+		//
+		// Render the template, and send the result.
+		//
+		var msg []byte
+		msg, err = e.render(x)
+		if err != nil {
+			return err
+		}
 
+		err = e.Deliver(m.sender, m.recipients, msg)
+		if err != nil {
+			failures = append(failures, m.failure(msg, err))
 		}
 	}
 
+	if len(failures) > 0 {
+		return &DeliveryError{Failures: failures}
+	}
+
 	e.logger.Debug("emails sent",
 		slog.Int("recipients", len(addresses)))
 
 	return nil
 }
 
-// isSMTP determines whether we should use SMTP to send the email.
+// SendDigest emails the given addresses a single message which contains
+// all the items in the digest.
 //
-// We just check to see that the obvious mandatory parameters are set in the
-// environment.  If they're wrong we'll get an error at delivery time, as
-// expected.
-func (e *Emailer) isSMTP() bool {
+// As with Sendmail the message contains both a plain-text and a HTML-version
+// of each item, along with a table of contents, and delivery failures are
+// reported via a *DeliveryError.
+func (e *Emailer) SendDigest(addresses []string) error {
 
-	// Mandatory environmental variables
-	vars := []string{"SMTP_HOST", "SMTP_USERNAME", "SMTP_PASSWORD"}
+	var err error
 
-	for _, name := range vars {
-		if os.Getenv(name) == "" {
-			return false
-		}
-	}
+	// The messages we failed to deliver.
+	var failures []Failure
 
-	return true
-}
+	//
+	// Ensure we have a recipient.
+	//
+	if len(addresses) < 1 {
 
-// sendSMTP sends the content of the email to the destination address
-// via SMTP.
-func (e *Emailer) sendSMTP(to string, content []byte) error {
+		e.logger.Error("missing recipient address")
 
-	// basics
-	host := os.Getenv("SMTP_HOST")
-	port := os.Getenv("SMTP_PORT")
+		e := errors.New("empty recipient address, did you not setup a recipient?")
+		return e
+	}
 
-	p := 587
-	if port != "" {
-		n, err := strconv.Atoi(port)
-		if err != nil {
+	//
+	// Encode the contents of each item.
+	//
+	items := make([]DigestItem, len(e.items))
+	for i, item := range e.items {
 
-			e.logger.Warn("error converting SMTP_PORT to integer",
-				slog.String("port", port),
-				slog.String("error", err.Error()))
+		items[i] = item
 
+		items[i].Text, err = toQuotedPrintable(item.Text)
+		if err != nil {
+			return err
+		}
+		items[i].HTML, err = toQuotedPrintable(html.UnescapeString(item.HTML))
+		if err != nil {
 			return err
 		}
-		p = n
 	}
 
-	// auth
-	user := os.Getenv("SMTP_USERNAME")
-	pass := os.Getenv("SMTP_PASSWORD")
+	//
+	// Process each message, usually there is one for each address.
+	//
+	addrs, err := newAddressing(e.opts)
+	if err != nil {
+		return err
+	}
+	for _, m := range addrs.messages(addresses) {
+
+		var x templateParms
+		x.From = formatAddress(m.from)
+		x.To = formatAddresses(m.to)
+		x.Cc = formatAddresses(addrs.cc)
+		x.ReplyTo = formatAddresses(splitAddresses(addrs.replyTo))
+		x.Items = items
+		x.Subject = fmt.Sprintf("%d new items", len(items))
+
+		// If all the items came from the same feed then we
+		// can populate the feed-specific fields too.
+		if len(items) > 0 && e.singleFeed() {
+			x.Feed = items[0].Feed
+			x.FeedTitle = items[0].FeedTitle
+			x.Tag = items[0].Tag
+			x.RSSFeed = items[0].RSSFeed
+
+			if x.FeedTitle != "" {
+				x.Subject = fmt.Sprintf("%d new items from %s", len(items), x.FeedTitle)
+			}
+		}
 
-	// Authenticate
-	auth := smtp.PlainAuth("", user, pass, host)
+		var msg []byte
+		msg, err = e.render(x)
+		if err != nil {
+			return err
+		}
 
-	// Get the mailserver
-	addr := fmt.Sprintf("%s:%d", host, p)
+		err = e.Deliver(m.sender, m.recipients, msg)
+		if err != nil {
+			failures = append(failures, m.failure(msg, err))
+		}
+	}
 
-	// Send the mail
-	err := smtp.SendMail(addr, auth, to, []string{to}, content)
+	if len(failures) > 0 {
+		return &DeliveryError{Failures: failures}
+	}
 
-	return err
-}
+	e.logger.Debug("digest sent",
+		slog.Int("items", len(items)),
+		slog.Int("recipients", len(addresses)))
 
-// sendSendmail sends the content of the email to the destination address
-// via /usr/sbin/sendmail
-func (e *Emailer) sendSendmail(addr string, content []byte) error {
+	return nil
+}
 
-	// Get the command to run.
-	sendmail := exec.Command("/usr/sbin/sendmail", "-i", "-f", addr, addr)
-	stdin, err := sendmail.StdinPipe()
-	if err != nil {
+// singleFeed returns true if all the items in our digest came from
+// the same feed.
+func (e *Emailer) singleFeed() bool {
+	for _, item := range e.items {
+		if item.Feed != e.items[0].Feed {
+			return false
+		}
+	}
+	return true
+}
 
-		e.logger.Error("error creating STDIN pipe to sendmail",
-			slog.String("recipient", addr),
-			slog.String("error", err.Error()))
+// render loads our template, and renders it with the given parameters.
+func (e *Emailer) render(x templateParms) ([]byte, error) {
 
-		return err
+	//
+	// Load the template we're going to render.
+	//
+	t, err := e.loadTemplate()
+	if err != nil {
+		return nil, err
 	}
 
 	//
-	// Get the output pipe.
+	// Render the template into the buffer.
 	//
-	stdout, err := sendmail.StdoutPipe()
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, x)
 	if err != nil {
+		return nil, err
+	}
 
-		e.logger.Error("error creating STDOUT pipe to sendmail",
-			slog.String("recipient", addr),
-			slog.String("error", err.Error()))
+	return buf.Bytes(), nil
+}
 
-		return err
+// Deliver sends the given message, which has already been rendered, from
+// the given envelope sender to the specified addresses, either via SMTP or
+// via sendmail.
+func (e *Emailer) Deliver(sender string, recipients []string, msg []byte) error {
+
+	// Any display names are removed from the envelope.
+	envelope := make([]string, len(recipients))
+	for i, addr := range recipients {
+		envelope[i] = bareAddress(addr)
 	}
+	sender = bareAddress(sender)
+
+	method := "sendmail"
+	send := e.sendSendmail
 
 	//
-	// Run the command, and pipe in the rendered template-result
+	// Are we sending via SMTP?
 	//
-	err = sendmail.Start()
-	if err != nil {
+	if e.isSMTP() {
+		method = "smtp"
+		send = e.sendSMTP
+	}
 
-		e.logger.Error("error starting sendmail",
-			slog.String("recipient", addr),
-			slog.String("error", err.Error()))
+	e.logger.Debug("preparing to send email",
+		slog.String("sender", sender),
+		slog.String("recipient", strings.Join(envelope, ",")),
+		slog.String("method", method))
 
-		return err
-	}
-	_, err = stdin.Write(content)
+	err := send(sender, envelope, msg)
 	if err != nil {
 
-		e.logger.Error("error writing to sendmail pipe",
-			slog.String("recipient", addr),
+		e.logger.Error("error sending email",
+			slog.String("recipient", strings.Join(envelope, ",")),
+			slog.String("method", method),
 			slog.String("error", err.Error()))
 
 		return err
 	}
-	stdin.Close()
 
-	//
-	// Read the output of Sendmail.
-	//
-	_, err = io.ReadAll(stdout)
-	if err != nil {
+	e.logger.Debug("email sent",
+		slog.String("recipient", strings.Join(envelope, ",")),
+		slog.String("method", method))
 
-		e.logger.Error("error reading from sendmail pipe",
-			slog.String("recipient", addr),
-			slog.String("error", err.Error()))
+	return nil
+}
 
-		return err
+// isSMTP determines whether we should use SMTP to send the email.
+//
+// We just check to see that the obvious mandatory parameters are set in the
+// environment, or our settings.  If they're wrong we'll get an error at
+// delivery time, as expected.
+func (e *Emailer) isSMTP() bool {
+
+	// Mandatory environmental variables
+	vars := []string{"SMTP_HOST", "SMTP_USERNAME"}
+
+	for _, name := range vars {
+		if settings.Get(name) == "" {
+			return false
+		}
 	}
 
-	//
-	// Wait for the command to complete.
-	//
-	err = sendmail.Wait()
-	if err != nil {
+	// The password might be read from a file, or a command, and
+	// XOAUTH2 might fetch access tokens instead.
+	return settings.HasSecret("SMTP_PASSWORD") || hasOAuth()
+}
 
-		e.logger.Error("error awaiting sendmail completion",
-			slog.String("recipient", addr),
-			slog.String("error", err.Error()))
+// sendSMTP sends the content of the email to the destination addresses
+// via SMTP.
+//
+// We use our session if we have one, otherwise we connect just for this
+// message.
+func (e *Emailer) sendSMTP(sender string, to []string, content []byte) error {
+
+	if e.session != nil {
+		return e.session.Send(sender, to, content)
+	}
 
+	session := NewSession(e.logger)
+
+	err := session.Send(sender, to, content)
+	if err != nil {
+		session.Close()
 		return err
 	}
 
-	return err
+	return session.Close()
 }
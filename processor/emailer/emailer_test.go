@@ -1,8 +1,16 @@
 package emailer
 
 import (
+	"log/slog"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/jsonfeed"
+	"github.com/skx/rss2email/withstate"
 )
 
 func TestMakeListIdHeader(t *testing.T) {
@@ -51,3 +59,143 @@ func TestMakeListIdHeader(t *testing.T) {
 		}
 	}
 }
+
+// TestDigestTemplate ensures our digest template renders each item.
+func TestDigestTemplate(t *testing.T) {
+
+	// Ensure we don't find any local template overrides.
+	t.Setenv("HOME", t.TempDir())
+
+	items := []DigestItem{
+		{Feed: "https://example.com/", FeedTitle: "Example", Link: "https://example.com/one", Subject: "First", Text: "one text", HTML: "<p>one</p>"},
+		{Feed: "https://example.com/", FeedTitle: "Example", Link: "https://example.com/two", Subject: "Second", Text: "two text", HTML: "<p>two</p>"},
+	}
+
+	e := NewDigest(items, nil, slog.Default())
+	if !e.singleFeed() {
+		t.Fatalf("expected items to come from a single feed")
+	}
+
+	out, err := e.render(templateParms{
+		From:    "bob@example.com",
+		To:      "bob@example.com",
+		Subject: "2 new items",
+		Feed:    "https://example.com/",
+		Items:   items,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error rendering digest: %s", err)
+	}
+
+	expected := []string{
+		"Subject: [rss2email] 2 new items",
+		"X-RSS-Digest: 2",
+		"1. First",
+		"2. Second",
+		"one text",
+		"<p>two</p>",
+		`<a href=3D"#item-2">Second</a>`,
+	}
+
+	for _, txt := range expected {
+		if !strings.Contains(string(out), txt) {
+			t.Fatalf("failed to find '%s' in rendered digest:\n%s", txt, out)
+		}
+	}
+
+	// Items from different feeds
+	items[1].Feed = "https://example.net/"
+	e = NewDigest(items, nil, slog.Default())
+	if e.singleFeed() {
+		t.Fatalf("expected items to come from different feeds")
+	}
+}
+
+// TestUpdatedTemplate ensures our template shows the changes made to an
+// updated item.
+func TestUpdatedTemplate(t *testing.T) {
+
+	// Ensure we don't find any local template overrides.
+	t.Setenv("HOME", t.TempDir())
+
+	feed := &gofeed.Feed{Link: "https://example.com/", Title: "Example"}
+	item := withstate.FeedItem{Item: &gofeed.Item{Link: "https://example.com/one", Title: "First"}}
+
+	e := New(feed, item, nil, slog.Default())
+
+	out, err := e.render(templateParms{
+		From:     "bob@example.com",
+		To:       "bob@example.com",
+		Subject:  "First",
+		Feed:     "https://example.com/",
+		Link:     "https://example.com/one",
+		RSSFeed:  feed,
+		RSSItem:  item,
+		Updated:  true,
+		Diff:     "- old line\n+ new line",
+		HTMLDiff: "- old &lt;line&gt;",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error rendering template: %s", err)
+	}
+
+	expected := []string{
+		"Subject: [rss2email] Updated: First",
+		"This item has been updated, the changes are:",
+		"+ new line",
+		"<pre>- old &lt;line&gt;</pre>",
+	}
+
+	for _, txt := range expected {
+		if !strings.Contains(string(out), txt) {
+			t.Fatalf("failed to find '%s' in rendered email:\n%s", txt, out)
+		}
+	}
+}
+
+// TestJSONFeedTemplate ensures templates can access the fields of items
+// which came from a JSON Feed.
+func TestJSONFeedTemplate(t *testing.T) {
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := filepath.Join(home, ".rss2email")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatalf("failed to create directory %s", err)
+	}
+	tmpl := `Subject: {{.Subject}}
+
+{{.RSSItem.Summary}}
+{{range .RSSItem.Attachments}}{{.Title}} {{.URL}} {{.DurationInSeconds}}
+{{end}}`
+	err = os.WriteFile(filepath.Join(dir, "json.tmpl"), []byte(tmpl), 0644)
+	if err != nil {
+		t.Fatalf("failed to write template %s", err)
+	}
+
+	data, err := os.ReadFile("../../jsonfeed/testdata/feed-1.0.json")
+	if err != nil {
+		t.Fatalf("failed to read fixture %s", err)
+	}
+	jf, err := jsonfeed.Parse(data)
+	if err != nil {
+		t.Fatalf("failed to parse fixture %s", err)
+	}
+
+	feed := jf.Translate()
+	item := withstate.FeedItem{Item: feed.Items[0]}
+	e := New(feed, item, []configfile.Option{{Name: "template", Value: "json.tmpl"}}, slog.Default())
+
+	out, err := e.render(templateParms{Subject: item.Title, RSSFeed: feed, RSSItem: item})
+	if err != nil {
+		t.Fatalf("unexpected error rendering template: %s", err)
+	}
+
+	for _, txt := range []string{"Talking about feeds.", "Episode Two (MP3) https://example.com/episodes/2.mp3 1800"} {
+		if !strings.Contains(string(out), txt) {
+			t.Fatalf("failed to find '%s' in rendered email:\n%s", txt, out)
+		}
+	}
+}
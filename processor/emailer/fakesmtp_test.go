@@ -0,0 +1,437 @@
+package emailer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPKI holds a certificate authority, and the certificates it has
+// issued, for testing TLS connections.
+type testPKI struct {
+
+	// caFile is the path to the CA certificate.
+	caFile string
+
+	// pool contains the CA certificate.
+	pool *x509.CertPool
+
+	// server is the certificate of our fake server.
+	server tls.Certificate
+
+	// clientCert and clientKey are the paths to a client certificate,
+	// and its key.
+	clientCert string
+	clientKey  string
+}
+
+// newTestPKI creates a certificate authority, a certificate for a server
+// on 127.0.0.1, and a client certificate.
+func newTestPKI(t *testing.T) *testPKI {
+
+	dir := t.TempDir()
+
+	key := func() *ecdsa.PrivateKey {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		return k
+	}
+
+	write := func(name string, kind string, der []byte) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600)
+		if err != nil {
+			t.Fatalf("failed to write %s: %s", path, err)
+		}
+		return path
+	}
+
+	caKey := key()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rss2email test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA: %s", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		k := key()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "127.0.0.1"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &k.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("failed to create certificate: %s", err)
+		}
+		return der, k
+	}
+
+	p := &testPKI{pool: x509.NewCertPool()}
+	p.pool.AddCert(ca)
+	p.caFile = write("ca.pem", "CERTIFICATE", caDER)
+
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	p.server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %s", err)
+	}
+	p.clientCert = write("client.pem", "CERTIFICATE", clientDER)
+	p.clientKey = write("client.key", "EC PRIVATE KEY", keyDER)
+
+	return p
+}
+
+// fakeMessage is a message received by our fake SMTP server.
+type fakeMessage struct {
+
+	// from and to hold the envelope addresses.
+	from string
+	to   []string
+
+	// data holds the message.
+	data string
+
+	// user is the name with which the client authenticated.
+	user string
+
+	// tls is set if the message was sent over TLS, and clientCert if
+	// the client presented a certificate.
+	tls        bool
+	clientCert bool
+}
+
+// fakeSMTP is an in-process SMTP server, for testing.
+type fakeSMTP struct {
+
+	// listener accepts our connections.
+	listener net.Listener
+
+	// tls is the configuration used for TLS connections.
+	tls *tls.Config
+
+	// implicit is set if connections use TLS from the start.
+	implicit bool
+
+	// starttls is set if we offer STARTTLS.
+	starttls bool
+
+	// mechanisms are the authentication mechanisms we offer.
+	mechanisms []string
+
+	// username and password are the credentials we accept.
+	username string
+	password string
+
+	// token is the XOAUTH2 access token we accept, which is protected
+	// by mu.
+	token string
+
+	// reject holds a recipient we refuse.
+	reject string
+
+	// drop is the number of messages after which we close each
+	// connection, without warning, if non-zero.
+	drop int
+
+	// mu protects the fields which follow.
+	mu sync.Mutex
+
+	// messages holds the messages we've received.
+	messages []fakeMessage
+
+	// connections counts the connections we've accepted.
+	connections int
+
+	// commands holds the commands we've received.
+	commands []string
+}
+
+// newFakeSMTP starts a fake SMTP server, which is configured by the given
+// function before it accepts connections.
+func newFakeSMTP(t *testing.T, configure func(f *fakeSMTP)) *fakeSMTP {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	f := &fakeSMTP{
+		listener:   l,
+		mechanisms: []string{"PLAIN"},
+		username:   "user",
+		password:   "pass",
+	}
+	if configure != nil {
+		configure(f)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.connections++
+			f.mu.Unlock()
+			go f.handle(conn)
+		}
+	}()
+
+	t.Cleanup(func() { l.Close() })
+	return f
+}
+
+// port returns the port upon which we listen.
+func (f *fakeSMTP) port() string {
+	_, port, _ := net.SplitHostPort(f.listener.Addr().String())
+	return port
+}
+
+// received returns the messages we've received.
+func (f *fakeSMTP) received() []fakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeMessage{}, f.messages...)
+}
+
+// connected returns the number of connections we've accepted.
+func (f *fakeSMTP) connected() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connections
+}
+
+// count returns the number of times the given command was received.
+func (f *fakeSMTP) count(verb string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, c := range f.commands {
+		if strings.HasPrefix(strings.ToUpper(c), verb) {
+			n++
+		}
+	}
+	return n
+}
+
+// handle talks to a single client.
+func (f *fakeSMTP) handle(conn net.Conn) {
+
+	defer func() { conn.Close() }()
+
+	if f.implicit {
+		conn = tls.Server(conn, f.tls)
+	}
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 127.0.0.1 fake ESMTP")
+
+	user := ""
+	msg := fakeMessage{}
+	count := 0
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, line)
+		f.mu.Unlock()
+
+		verb, arg, _ := strings.Cut(line, " ")
+		tlsConn, secure := conn.(*tls.Conn)
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"127.0.0.1"}
+			if f.starttls && !secure {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(f.mechanisms) > 0 {
+				lines = append(lines, "AUTH "+strings.Join(f.mechanisms, " "))
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				text.PrintfLine("250%s%s", sep, l)
+			}
+
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			conn = tls.Server(conn, f.tls)
+			text = textproto.NewConn(conn)
+
+		case "AUTH":
+			user = f.auth(text, arg)
+
+		case "MAIL":
+			if len(f.mechanisms) > 0 && user == "" {
+				text.PrintfLine("530 authentication required")
+				continue
+			}
+			msg = fakeMessage{from: address(arg), user: user}
+			text.PrintfLine("250 OK")
+
+		case "RCPT":
+			if f.reject != "" && address(arg) == f.reject {
+				text.PrintfLine("550 no such user")
+				continue
+			}
+			msg.to = append(msg.to, address(arg))
+			text.PrintfLine("250 OK")
+
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			if secure {
+				msg.tls = true
+				msg.clientCert = len(tlsConn.ConnectionState().PeerCertificates) > 0
+			}
+			f.mu.Lock()
+			f.messages = append(f.messages, msg)
+			f.mu.Unlock()
+			msg = fakeMessage{}
+			text.PrintfLine("250 queued")
+
+			count++
+			if f.drop > 0 && count >= f.drop {
+				return
+			}
+
+		case "RSET":
+			msg = fakeMessage{}
+			text.PrintfLine("250 OK")
+
+		case "NOOP":
+			text.PrintfLine("250 OK")
+
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// auth handles an AUTH command, returning the name of the user if they
+// authenticated successfully.
+func (f *fakeSMTP) auth(text *textproto.Conn, arg string) string {
+
+	mechanism, initial, _ := strings.Cut(arg, " ")
+
+	// challenge sends the given challenge, and returns the decoded
+	// response.
+	challenge := func(c string) string {
+		text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(c)))
+		line, _ := text.ReadLine()
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		return string(decoded)
+	}
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		response := ""
+		if initial != "" {
+			decoded, _ := base64.StdEncoding.DecodeString(initial)
+			response = string(decoded)
+		} else {
+			response = challenge("")
+		}
+		if response == "\x00"+f.username+"\x00"+f.password {
+			text.PrintfLine("235 authenticated")
+			return f.username
+		}
+
+	case "LOGIN":
+		user := challenge("Username:")
+		pass := challenge("Password:")
+		if user == f.username && pass == f.password {
+			text.PrintfLine("235 authenticated")
+			return f.username
+		}
+
+	case "CRAM-MD5":
+		nonce := "<1234.5678@127.0.0.1>"
+		mac := hmac.New(md5.New, []byte(f.password))
+		mac.Write([]byte(nonce))
+		if challenge(nonce) == f.username+" "+hex.EncodeToString(mac.Sum(nil)) {
+			text.PrintfLine("235 authenticated")
+			return f.username
+		}
+
+	case "XOAUTH2":
+		f.mu.Lock()
+		token := f.token
+		f.mu.Unlock()
+
+		decoded, _ := base64.StdEncoding.DecodeString(initial)
+		if string(decoded) == "user="+f.username+"\x01auth=Bearer "+token+"\x01\x01" {
+			text.PrintfLine("235 authenticated")
+			return f.username
+		}
+
+		// Report the failure as a challenge, as Gmail does.
+		challenge(`{"status":"401","schemes":"bearer","scope":"https://mail.google.com/"}`)
+	}
+
+	text.PrintfLine("535 authentication failed")
+	return ""
+}
+
+// address returns the address from a MAIL, or RCPT, command.
+func address(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return arg
+	}
+	return arg[start+1 : end]
+}
@@ -0,0 +1,221 @@
+package emailer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/settings"
+	"github.com/skx/rss2email/state"
+)
+
+// tokenClient is used to fetch OAuth2 access tokens.
+var tokenClient = &http.Client{Timeout: 30 * time.Second}
+
+// tokenCache is the cached OAuth2 access token, which we store in our
+// state directory so that we don't fetch a new token for every run.
+type tokenCache struct {
+
+	// Key identifies the configuration which the token was fetched
+	// with, so that it isn't used if that changes.
+	Key string `json:"key"`
+
+	// AccessToken is the token used to authenticate.
+	AccessToken string `json:"access_token"`
+
+	// Expiry is the time at which the access token expires.
+	Expiry time.Time `json:"expiry"`
+
+	// RefreshToken holds a replacement refresh token, if the server
+	// issued one.
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// tokenSource provides the OAuth2 access tokens used for XOAUTH2.
+//
+// If SMTP_OAUTH_TOKEN_URL and SMTP_OAUTH_REFRESH_TOKEN are set we fetch
+// access tokens via the refresh-token flow, and cache them until they
+// expire.  Otherwise SMTP_PASSWORD is used as the access token, which
+// allows an external command to provide one.
+type tokenSource struct {
+
+	// username is the account the token is for.
+	username string
+
+	// path is the location of our cache.
+	path string
+}
+
+// newTokenSource returns the source of access tokens for the given account.
+func newTokenSource(username string) *tokenSource {
+	return &tokenSource{
+		username: username,
+		path:     filepath.Join(state.Directory(), "smtp-oauth.json"),
+	}
+}
+
+// token returns an access token, and whether it came from our cache.
+func (ts *tokenSource) token() (string, bool, error) {
+
+	if !hasOAuth() {
+		token, err := settings.Secret("SMTP_PASSWORD")
+		if err == nil && token == "" {
+			err = errors.New("XOAUTH2 requires SMTP_OAUTH_TOKEN_URL and SMTP_OAUTH_REFRESH_TOKEN, or an access token as SMTP_PASSWORD")
+		}
+		return token, false, err
+	}
+
+	refresh, err := settings.Secret("SMTP_OAUTH_REFRESH_TOKEN")
+	if err != nil {
+		return "", false, err
+	}
+	key := ts.key(refresh)
+
+	// Use our cached token if it has at least a minute left.
+	cache, _ := ts.load()
+	if cache.Key == key && cache.AccessToken != "" && time.Until(cache.Expiry) > time.Minute {
+		return cache.AccessToken, true, nil
+	}
+
+	// The server might have replaced the refresh token.
+	if cache.Key == key && cache.RefreshToken != "" {
+		refresh = cache.RefreshToken
+	}
+
+	fresh, err := ts.refresh(refresh)
+	if err != nil {
+		return "", false, err
+	}
+
+	fresh.Key = key
+	if fresh.RefreshToken == "" && cache.Key == key {
+		fresh.RefreshToken = cache.RefreshToken
+	}
+
+	err = ts.save(fresh)
+	if err != nil {
+		return "", false, err
+	}
+	return fresh.AccessToken, false, nil
+}
+
+// key identifies our configuration, so a cached token isn't used after
+// it changes.
+func (ts *tokenSource) key(refresh string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		settings.Get("SMTP_OAUTH_TOKEN_URL"),
+		settings.Get("SMTP_OAUTH_CLIENT_ID"),
+		ts.username,
+		refresh,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// refresh fetches a new access token, via the given refresh token.
+func (ts *tokenSource) refresh(refresh string) (tokenCache, error) {
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refresh},
+	}
+	if id := settings.Get("SMTP_OAUTH_CLIENT_ID"); id != "" {
+		form.Set("client_id", id)
+	}
+	secret, err := settings.Secret("SMTP_OAUTH_CLIENT_SECRET")
+	if err != nil {
+		return tokenCache{}, err
+	}
+	if secret != "" {
+		form.Set("client_secret", secret)
+	}
+
+	resp, err := tokenClient.PostForm(settings.Get("SMTP_OAUTH_TOKEN_URL"), form)
+	if err != nil {
+		return tokenCache{}, fmt.Errorf("failed to refresh the OAuth2 access token: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return tokenCache{}, fmt.Errorf("failed to refresh the OAuth2 access token: %s", err)
+	}
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		RefreshToken     string `json:"refresh_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.Unmarshal(body, &result)
+
+	if resp.StatusCode != http.StatusOK || err != nil || result.AccessToken == "" {
+		msg := resp.Status
+		if result.Error != "" {
+			msg = strings.TrimSpace(result.Error + " " + result.ErrorDescription)
+		}
+		return tokenCache{}, fmt.Errorf("failed to refresh the OAuth2 access token: %s", msg)
+	}
+
+	// Assume an hour, if the server doesn't tell us.
+	expires := time.Duration(result.ExpiresIn) * time.Second
+	if result.ExpiresIn <= 0 {
+		expires = time.Hour
+	}
+
+	return tokenCache{
+		AccessToken:  result.AccessToken,
+		Expiry:       time.Now().Add(expires),
+		RefreshToken: result.RefreshToken,
+	}, nil
+}
+
+// load reads our cached token.
+func (ts *tokenSource) load() (tokenCache, error) {
+
+	var cache tokenCache
+
+	data, err := os.ReadFile(ts.path)
+	if err != nil {
+		return cache, err
+	}
+	err = json.Unmarshal(data, &cache)
+	return cache, err
+}
+
+// save writes our cached token, which only we may read.
+func (ts *tokenSource) save(cache tokenCache) error {
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(ts.path), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ts.path, data, 0600)
+}
+
+// invalidate forgets our cached access token, keeping any replacement
+// refresh token.
+func (ts *tokenSource) invalidate() {
+
+	cache, err := ts.load()
+	if err != nil {
+		return
+	}
+	cache.AccessToken = ""
+	cache.Expiry = time.Time{}
+	ts.save(cache)
+}
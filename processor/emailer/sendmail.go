@@ -0,0 +1,223 @@
+package emailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/skx/rss2email/settings"
+)
+
+// DefaultSendmailCommand is the command we use to deliver messages, unless
+// changed via SENDMAIL_COMMAND.
+const DefaultSendmailCommand = "/usr/sbin/sendmail -i -f {{.Sender}} {{.Recipients}}"
+
+// DefaultSendmailTimeout is the longest we wait for the sendmail command,
+// unless changed via SENDMAIL_TIMEOUT.
+const DefaultSendmailTimeout = time.Minute
+
+// recipientsArg matches an argument which is replaced by one argument for
+// each recipient.
+var recipientsArg = regexp.MustCompile(`^{{-?\s*\.Recipients\s*-?}}$`)
+
+// sendmailParams is the structure used to populate the arguments of the
+// sendmail command.
+type sendmailParams struct {
+
+	// Sender is the envelope sender.
+	Sender string
+
+	// Recipients holds the envelope recipients.
+	Recipients []string
+}
+
+// sendSendmail sends the content of the email to the destination addresses
+// via the sendmail command, which is /usr/sbin/sendmail unless changed via
+// SENDMAIL_COMMAND.
+//
+// The command isn't run via the shell, so the addresses can't be used to
+// run other commands.  Anything it writes to STDERR is included in the
+// error we return if it fails.
+func (e *Emailer) sendSendmail(sender string, to []string, content []byte) error {
+
+	args, err := sendmailCommand(sender, to)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := sendmailTimeout()
+	if err != nil {
+		return err
+	}
+
+	e.logger.Debug("running sendmail",
+		slog.String("command", strings.Join(args, " ")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stderr = &stderr
+
+	// Don't wait for any children which outlive the command.
+	cmd.WaitDelay = time.Second
+
+	name := filepath.Base(args[0])
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s timed out after %s", name, timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return fmt.Errorf("%s failed: %s: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s failed: %s", name, err)
+	}
+
+	return nil
+}
+
+// sendmailCommand returns the command, and arguments, we run to send a
+// message from the given sender to the given recipients.
+//
+// Each argument of the command is a template, which may refer to the
+// {{.Sender}} and the {{.Recipients}}.  An argument which is only
+// {{.Recipients}} is replaced by an argument for each of them, otherwise
+// {{join .Recipients ","}} may be used.
+func sendmailCommand(sender string, to []string) ([]string, error) {
+
+	command := settings.Get("SENDMAIL_COMMAND")
+	if command == "" {
+		command = DefaultSendmailCommand
+	}
+
+	fields, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SENDMAIL_COMMAND: %s", err)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("invalid SENDMAIL_COMMAND: no command given")
+	}
+
+	params := sendmailParams{Sender: sender, Recipients: to}
+	funcs := template.FuncMap{"join": strings.Join}
+
+	var args []string
+	for _, field := range fields {
+
+		if recipientsArg.MatchString(field) {
+			args = append(args, to...)
+			continue
+		}
+
+		tmpl, err := template.New("arg").Funcs(funcs).Option("missingkey=error").Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SENDMAIL_COMMAND: %s", err)
+		}
+
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SENDMAIL_COMMAND: %s", err)
+		}
+		args = append(args, buf.String())
+	}
+
+	return args, nil
+}
+
+// splitCommand splits a command into its arguments, which are separated by
+// whitespace unless it is within single, or double, quotes, or within a
+// template action such as {{join .Recipients ","}}.
+func splitCommand(command string) ([]string, error) {
+
+	var args []string
+	var current strings.Builder
+
+	inArg := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+
+		c := runes[i]
+
+		switch {
+		case quote == 0 && c == '{' && i+1 < len(runes) && runes[i+1] == '{':
+			// Copy the action as-is.
+			end := strings.Index(string(runes[i:]), "}}")
+			if end < 0 {
+				return nil, errors.New("unterminated {{ action")
+			}
+			action := string(runes[i:])[:end+2]
+			current.WriteString(action)
+			i += len([]rune(action)) - 1
+			inArg = true
+
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// sendmailTimeout returns the longest we wait for the sendmail command,
+// which may be given as a duration ("90s") or a number of seconds.
+func sendmailTimeout() (time.Duration, error) {
+
+	value := settings.Get("SENDMAIL_TIMEOUT")
+	if value == "" {
+		return DefaultSendmailTimeout, nil
+	}
+
+	if n, err := strconv.Atoi(value); err == nil && n > 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid SENDMAIL_TIMEOUT '%s', expected a duration such as \"90s\"", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,143 @@
+package emailer
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/withstate"
+)
+
+// TestSplitCommand ensures commands are split into their arguments.
+func TestSplitCommand(t *testing.T) {
+
+	tests := []struct {
+		command string
+		args    []string
+		err     string
+	}{
+		{command: "/usr/sbin/sendmail -i", args: []string{"/usr/sbin/sendmail", "-i"}},
+		{command: "  msmtp\t-a  default ", args: []string{"msmtp", "-a", "default"}},
+		{command: `tag "rss feeds" 'it''s' ""`, args: []string{"tag", "rss feeds", "its", ""}},
+		{command: `wrapper --tag="a b"`, args: []string{"wrapper", "--tag=a b"}},
+		{command: `tag {{join .Recipients " "}} -- {{ .Recipients }}`, args: []string{"tag", `{{join .Recipients " "}}`, "--", "{{ .Recipients }}"}},
+		{command: `broken "quote`, err: "unterminated"},
+		{command: `broken {{.Sender`, err: "unterminated"},
+		{command: "", args: nil},
+	}
+
+	for _, test := range tests {
+		args, err := splitCommand(test.command)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %s for %q, got %v", test.err, test.command, err)
+			}
+			continue
+		}
+		if err != nil || strings.Join(args, "|") != strings.Join(test.args, "|") || len(args) != len(test.args) {
+			t.Fatalf("unexpected result %q %v for %q", args, err, test.command)
+		}
+	}
+}
+
+// TestSendmailCommand ensures the arguments of the sendmail command are
+// populated with the sender, and recipients.
+func TestSendmailCommand(t *testing.T) {
+
+	to := []string{"bob@example.com", "alice@example.com"}
+
+	tests := []struct {
+		command string
+		args    string
+		err     string
+	}{
+		{command: "", args: "/usr/sbin/sendmail -i -f rss@example.org bob@example.com alice@example.com"},
+		{command: "msmtp -f {{.Sender}} -- {{ .Recipients }}", args: "msmtp -f rss@example.org -- bob@example.com alice@example.com"},
+		{command: `tag --to={{join .Recipients ","}} --from="{{.Sender}}"`, args: "tag --to=bob@example.com,alice@example.com --from=rss@example.org"},
+		{command: "sendmail {{.Missing}}", err: "invalid SENDMAIL_COMMAND"},
+		{command: "sendmail {{.Sender", err: "invalid SENDMAIL_COMMAND"},
+		{command: "   ", err: "no command given"},
+	}
+
+	for _, test := range tests {
+		t.Setenv("SENDMAIL_COMMAND", test.command)
+
+		args, err := sendmailCommand("rss@example.org", to)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %s for %q, got %v", test.err, test.command, err)
+			}
+			continue
+		}
+		if err != nil || strings.Join(args, " ") != test.args {
+			t.Fatalf("unexpected arguments %q %v for %q", args, err, test.command)
+		}
+	}
+}
+
+// TestSendSendmail ensures messages are piped to the sendmail command, and
+// that its failures are reported.
+func TestSendSendmail(t *testing.T) {
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sendmail")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+cat > "$(dirname "$0")/message"
+case "$*" in
+  *fail*) echo "sendmail: fatal: no such user" >&2; exit 75 ;;
+  *slow*) sleep 5 ;;
+esac
+`), 0755)
+	if err != nil {
+		t.Fatalf("failed to write script: %s", err)
+	}
+
+	// Ensure we use sendmail, rather than SMTP.
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("FROM", "")
+	t.Setenv("SENDER", "bounces@example.org")
+	t.Setenv("SENDMAIL_COMMAND", script+" -i -f {{.Sender}} {{.Recipients}}")
+	t.Setenv("SENDMAIL_TIMEOUT", "")
+	t.Setenv("HOME", t.TempDir())
+
+	feed := &gofeed.Feed{Link: "https://example.com/", Title: "Example"}
+	item := withstate.FeedItem{Item: &gofeed.Item{Link: "https://example.com/one", Title: "First"}}
+	e := New(feed, item, []configfile.Option{{Name: "delivery", Value: "single"}}, slog.Default())
+
+	err = e.Sendmail([]string{"bob@example.com", "Alice <alice@example.com>"}, "text", "<p>html</p>")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if string(args) != "-i -f bounces@example.org bob@example.com alice@example.com\n" {
+		t.Fatalf("unexpected arguments %q", args)
+	}
+	msg, _ := os.ReadFile(filepath.Join(dir, "message"))
+	if !strings.Contains(string(msg), "Subject: [rss2email] First") {
+		t.Fatalf("unexpected message %s", msg)
+	}
+
+	// The output of a failing command is reported.
+	err = e.Deliver("bounces@example.org", []string{"fail@example.com"}, msg)
+	if err == nil || err.Error() != "sendmail failed: exit status 75: sendmail: fatal: no such user" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	t.Setenv("SENDMAIL_TIMEOUT", "100ms")
+	err = e.Deliver("bounces@example.org", []string{"slow@example.com"}, msg)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	t.Setenv("SENDMAIL_TIMEOUT", "soon")
+	err = e.Deliver("bounces@example.org", []string{"bob@example.com"}, msg)
+	if err == nil || !strings.Contains(err.Error(), "invalid SENDMAIL_TIMEOUT") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
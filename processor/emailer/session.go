@@ -0,0 +1,192 @@
+package emailer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+
+	"github.com/skx/rss2email/settings"
+)
+
+// DefaultMaxMessages is the number of messages we send over a single SMTP
+// connection before we reconnect, unless changed via SMTP_MAX_MESSAGES.
+const DefaultMaxMessages = 100
+
+// Session is a connection to our SMTP server, which is reused for each
+// message sent during a run, rather than connecting and authenticating
+// for every message.
+//
+// We connect when the first message is sent, reset the connection between
+// messages, and reconnect if the server drops the connection, or once we've
+// sent SMTP_MAX_MESSAGES messages over it.
+//
+// A Session may be used concurrently, and may be used again after it has
+// been closed.
+type Session struct {
+
+	// logger is used to report our connections.
+	logger *slog.Logger
+
+	// mu protects the fields which follow.
+	mu sync.Mutex
+
+	// server holds the details of our server, while we're connected.
+	server *smtpServer
+
+	// client is our connection, if any.
+	client *smtp.Client
+
+	// sent counts the messages sent over our connection.
+	sent int
+}
+
+// NewSession creates a new SMTP session, which doesn't connect until it is
+// used.
+func NewSession(log *slog.Logger) *Session {
+	return &Session{logger: log}
+}
+
+// SetLogger updates the logger used to report our connections.
+func (s *Session) SetLogger(log *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = log
+}
+
+// Send sends the given message, connecting to the server if we're not
+// already connected.
+//
+// If a connection we've used before fails we reconnect, and try again,
+// but not if the server rejected the message.
+func (s *Session) Send(from string, to []string, msg []byte) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	max, err := maxMessages()
+	if err != nil {
+		return err
+	}
+
+	reused := s.client != nil
+	if reused {
+		switch {
+		case max > 0 && s.sent >= max:
+			s.logger.Debug("reconnecting to SMTP server",
+				slog.Int("messages", s.sent))
+			s.quit()
+			reused = false
+
+		case s.client.Reset() != nil:
+			// The server probably closed an idle connection.
+			s.drop()
+			reused = false
+		}
+	}
+
+	err = s.send(from, to, msg)
+	if err != nil && reused && !isRejection(err) {
+
+		s.logger.Debug("SMTP connection failed, reconnecting",
+			slog.String("error", err.Error()))
+
+		s.drop()
+		err = s.send(from, to, msg)
+	}
+	return err
+}
+
+// send sends the given message, connecting first if we must.
+func (s *Session) send(from string, to []string, msg []byte) error {
+
+	if s.client == nil {
+		server, err := newSMTPServer()
+		if err != nil {
+			return err
+		}
+
+		c, err := server.dial()
+		if err != nil {
+			return err
+		}
+
+		s.logger.Debug("connected to SMTP server",
+			slog.String("host", server.host),
+			slog.Int("port", server.port))
+
+		s.server = server
+		s.client = c
+		s.sent = 0
+	}
+
+	err := s.server.send(s.client, from, to, msg)
+	if err != nil {
+		// The connection can't be trusted unless the server
+		// rejected the message.
+		if !isRejection(err) {
+			s.drop()
+		}
+		return err
+	}
+
+	s.sent++
+	return nil
+}
+
+// Close disconnects from the server, if we're connected.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quit()
+}
+
+// quit disconnects politely from the server.
+func (s *Session) quit() error {
+
+	if s.client == nil {
+		return nil
+	}
+
+	err := s.client.Quit()
+	if err != nil {
+		s.client.Close()
+	}
+	s.client = nil
+	return err
+}
+
+// drop closes our connection, without saying goodbye to the server.
+func (s *Session) drop() {
+
+	if s.client != nil {
+		s.client.Close()
+	}
+	s.client = nil
+}
+
+// isRejection returns true if the given error is a response from the
+// server, other than one which says it is closing the connection.
+func isRejection(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code != 421
+}
+
+// maxMessages returns the number of messages we send over a single
+// connection, zero meaning there is no limit.
+func maxMessages() (int, error) {
+
+	value := settings.Get("SMTP_MAX_MESSAGES")
+	if value == "" {
+		return DefaultMaxMessages, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid SMTP_MAX_MESSAGES '%s', expected a number", value)
+	}
+	return n, nil
+}
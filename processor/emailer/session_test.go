@@ -0,0 +1,111 @@
+package emailer
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// sendAll sends the given number of messages via the session.
+func sendAll(t *testing.T, s *Session, count int) {
+	for i := 0; i < count; i++ {
+		msg := fmt.Sprintf("Subject: test %d\r\n\r\ntest\r\n", i)
+		err := s.Send("steve@example.com", []string{"steve@example.com"}, []byte(msg))
+		if err != nil {
+			t.Fatalf("failed to send message %d: %s", i, err)
+		}
+	}
+}
+
+// TestSessionReuse ensures we send many messages over a single connection,
+// resetting it between them.
+func TestSessionReuse(t *testing.T) {
+
+	f := newFakeSMTP(t, nil)
+	useServer(t, f)
+
+	s := NewSession(slog.Default())
+	sendAll(t, s, 5)
+
+	err := s.Close()
+	if err != nil {
+		t.Fatalf("unexpected error closing: %s", err)
+	}
+
+	if len(f.received()) != 5 {
+		t.Fatalf("unexpected messages %v", f.received())
+	}
+	if f.connected() != 1 || f.count("AUTH") != 1 || f.count("RSET") != 4 || f.count("QUIT") != 1 {
+		t.Fatalf("unexpected commands %v", f.commands)
+	}
+
+	// A closed session may be used again.
+	sendAll(t, s, 1)
+	s.Close()
+	if f.connected() != 2 || len(f.received()) != 6 {
+		t.Fatalf("unexpected connections %d", f.connected())
+	}
+}
+
+// TestSessionMaxMessages ensures we reconnect after sending the configured
+// number of messages.
+func TestSessionMaxMessages(t *testing.T) {
+
+	f := newFakeSMTP(t, nil)
+	useServer(t, f)
+	t.Setenv("SMTP_MAX_MESSAGES", "2")
+
+	s := NewSession(slog.Default())
+	sendAll(t, s, 5)
+	s.Close()
+
+	if len(f.received()) != 5 || f.connected() != 3 || f.count("QUIT") != 3 {
+		t.Fatalf("unexpected connections %d, commands %v", f.connected(), f.commands)
+	}
+
+	t.Setenv("SMTP_MAX_MESSAGES", "lots")
+	err := s.Send("steve@example.com", []string{"steve@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid SMTP_MAX_MESSAGES") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestSessionReconnect ensures we reconnect if the server drops our
+// connection.
+func TestSessionReconnect(t *testing.T) {
+
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.drop = 2 })
+	useServer(t, f)
+
+	s := NewSession(slog.Default())
+	sendAll(t, s, 5)
+	s.Close()
+
+	if len(f.received()) != 5 || f.connected() != 3 {
+		t.Fatalf("unexpected connections %d, messages %v", f.connected(), f.received())
+	}
+}
+
+// TestSessionRejection ensures a rejected message isn't retried, and that
+// the connection is still used for subsequent messages.
+func TestSessionRejection(t *testing.T) {
+
+	f := newFakeSMTP(t, func(f *fakeSMTP) { f.reject = "bob@example.com" })
+	useServer(t, f)
+
+	s := NewSession(slog.Default())
+	sendAll(t, s, 1)
+
+	err := s.Send("bob@example.com", []string{"bob@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "no such user") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	sendAll(t, s, 1)
+	s.Close()
+
+	if len(f.received()) != 2 || f.connected() != 1 || f.count("RCPT") != 3 {
+		t.Fatalf("unexpected connections %d, commands %v", f.connected(), f.commands)
+	}
+}
@@ -0,0 +1,287 @@
+package emailer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/settings"
+)
+
+// DialTimeout is the longest we wait to connect to our SMTP server.
+var DialTimeout = 30 * time.Second
+
+// The ways in which we may secure our connection to the SMTP server, via
+// the SMTP_TLS setting.
+const (
+	// tlsAuto uses STARTTLS if the server offers it, this is the
+	// default.
+	tlsAuto = ""
+
+	// tlsImplicit uses TLS from the start of the connection, usually
+	// upon port 465.
+	tlsImplicit = "implicit"
+
+	// tlsStartTLS requires the server to offer STARTTLS.
+	tlsStartTLS = "starttls"
+
+	// tlsNone never uses TLS, which is only suitable for local relays.
+	tlsNone = "none"
+)
+
+// smtpServer holds the details of the SMTP server through which we send
+// email, read from our settings.
+type smtpServer struct {
+
+	// host is the name of the server.
+	host string
+
+	// port is the port of the server.
+	port int
+
+	// security is the way in which the connection is secured.
+	security string
+
+	// tls holds the configuration used for TLS connections.
+	tls *tls.Config
+
+	// username is the name with which we authenticate.
+	username string
+
+	// mechanism is the authentication mechanism we use.
+	mechanism string
+}
+
+// newSMTPServer returns the details of our SMTP server, from our settings.
+func newSMTPServer() (*smtpServer, error) {
+
+	s := &smtpServer{
+		host:      settings.Get("SMTP_HOST"),
+		port:      587,
+		security:  strings.ToLower(settings.Get("SMTP_TLS")),
+		username:  settings.Get("SMTP_USERNAME"),
+		mechanism: strings.ToUpper(settings.Get("SMTP_AUTH")),
+	}
+
+	switch s.mechanism {
+	case "":
+		s.mechanism = authPlain
+	case authPlain, authLogin, authCRAMMD5, authXOAUTH2:
+	default:
+		return nil, fmt.Errorf("invalid SMTP_AUTH '%s', expected plain, login, cram-md5, or xoauth2", s.mechanism)
+	}
+
+	switch s.security {
+	case tlsAuto, tlsStartTLS, tlsNone:
+	case tlsImplicit:
+		s.port = 465
+	default:
+		return nil, fmt.Errorf("invalid SMTP_TLS '%s', expected implicit, starttls, or none", s.security)
+	}
+
+	if port := settings.Get("SMTP_PORT"); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT '%s': %s", port, err)
+		}
+		s.port = n
+	}
+
+	var err error
+	s.tls, err = tlsConfig(s.host)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// tlsConfig returns the configuration used for TLS connections to the
+// given server, which includes any custom CA bundle, and client
+// certificate, from our settings.
+func tlsConfig(host string) (*tls.Config, error) {
+
+	config := &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if path := settings.Get("SMTP_CA_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SMTP_CA_FILE: %s", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in SMTP_CA_FILE %s", path)
+		}
+		config.RootCAs = pool
+	}
+
+	if isTrue(settings.Get("SMTP_INSECURE")) {
+		config.InsecureSkipVerify = true
+	}
+
+	cert := settings.Get("SMTP_CLIENT_CERT")
+	key := settings.Get("SMTP_CLIENT_KEY")
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, errors.New("SMTP_CLIENT_CERT and SMTP_CLIENT_KEY must be set together")
+		}
+
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the SMTP client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return config, nil
+}
+
+// isTrue returns true if the given setting is enabled.
+func isTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// dial connects, and authenticates, to the SMTP server.
+//
+// If the server refuses a cached XOAUTH2 access token we fetch a new one,
+// and try again, as net/smtp closes the connection when authentication
+// fails.
+func (s *smtpServer) dial() (*smtp.Client, error) {
+
+	c, cached, err := s.connect()
+	if err != nil && cached {
+		newTokenSource(s.username).invalidate()
+		c, _, err = s.connect()
+	}
+	return c, err
+}
+
+// connect connects, and authenticates, to the SMTP server, returning
+// whether a cached access token was refused if that fails.
+func (s *smtpServer) connect() (*smtp.Client, bool, error) {
+
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	dialer := &net.Dialer{Timeout: DialTimeout}
+
+	var conn net.Conn
+	var err error
+	if s.security == tlsImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, s.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+
+	cached := false
+	err = s.secure(c)
+	if err == nil {
+		cached, err = s.auth(c)
+	}
+	if err != nil {
+		c.Close()
+		return nil, cached, err
+	}
+
+	return c, false, nil
+}
+
+// secure upgrades the connection via STARTTLS, if we should.
+func (s *smtpServer) secure(c *smtp.Client) error {
+
+	if s.security == tlsImplicit || s.security == tlsNone {
+		return nil
+	}
+
+	ok, _ := c.Extension("STARTTLS")
+	if !ok {
+		if s.security == tlsStartTLS {
+			return fmt.Errorf("%s doesn't support STARTTLS, which SMTP_TLS requires", s.host)
+		}
+		return nil
+	}
+
+	return c.StartTLS(s.tls)
+}
+
+// auth authenticates with the server, if we have a username, returning
+// whether we used a cached access token.
+func (s *smtpServer) auth(c *smtp.Client) (bool, error) {
+
+	if s.username == "" {
+		return false, nil
+	}
+
+	ok, mechanisms := c.Extension("AUTH")
+	if !ok {
+		return false, fmt.Errorf("%s doesn't support authentication", s.host)
+	}
+	if !hasMechanism(mechanisms, s.mechanism) {
+		return false, fmt.Errorf("%s doesn't support %s authentication, it offers %s", s.host, s.mechanism, mechanisms)
+	}
+
+	if s.mechanism == authXOAUTH2 {
+		return s.authOAuth(c)
+	}
+
+	password, err := settings.Secret("SMTP_PASSWORD")
+	if err != nil {
+		return false, err
+	}
+
+	return false, c.Auth(s.authenticator(password))
+}
+
+// send sends a message, via the given connection.
+func (s *smtpServer) send(c *smtp.Client, from string, to []string, msg []byte) error {
+
+	err := c.Mail(from)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range to {
+		err = c.Rcpt(addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,219 @@
+package emailer
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/smtp"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useServer configures our settings to use the given fake server.
+func useServer(t *testing.T, f *fakeSMTP) {
+
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", f.port())
+	t.Setenv("SMTP_USERNAME", "user")
+	t.Setenv("SMTP_PASSWORD", "pass")
+
+	for _, name := range []string{"SMTP_TLS", "SMTP_CA_FILE", "SMTP_INSECURE", "SMTP_CLIENT_CERT", "SMTP_CLIENT_KEY", "SMTP_PASSWORD_FILE", "SMTP_PASSWORD_COMMAND",
+		"FROM", "SENDER", "SMTP_AUTH", "SMTP_MAX_MESSAGES", "SMTP_OAUTH_TOKEN_URL", "SMTP_OAUTH_CLIENT_ID", "SMTP_OAUTH_CLIENT_SECRET", "SMTP_OAUTH_REFRESH_TOKEN"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+}
+
+// TestSMTPTLS ensures each of our TLS modes works as expected.
+func TestSMTPTLS(t *testing.T) {
+
+	pki := newTestPKI(t)
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{pki.server}}
+
+	tests := []struct {
+		name      string
+		configure func(f *fakeSMTP)
+		settings  map[string]string
+		err       string
+		tls       bool
+		cert      bool
+	}{
+		{
+			name: "plaintext to localhost",
+		},
+		{
+			name:      "opportunistic STARTTLS",
+			configure: func(f *fakeSMTP) { f.starttls = true },
+			settings:  map[string]string{"SMTP_CA_FILE": pki.caFile},
+			tls:       true,
+		},
+		{
+			name:      "required STARTTLS",
+			configure: func(f *fakeSMTP) { f.starttls = true },
+			settings:  map[string]string{"SMTP_TLS": "starttls", "SMTP_CA_FILE": pki.caFile},
+			tls:       true,
+		},
+		{
+			name:     "required STARTTLS not offered",
+			settings: map[string]string{"SMTP_TLS": "starttls"},
+			err:      "doesn't support STARTTLS",
+		},
+		{
+			name:      "STARTTLS with an unknown CA",
+			configure: func(f *fakeSMTP) { f.starttls = true },
+			settings:  map[string]string{"SMTP_TLS": "STARTTLS"},
+			err:       "certificate signed by unknown authority",
+		},
+		{
+			name:      "implicit TLS",
+			configure: func(f *fakeSMTP) { f.implicit = true },
+			settings:  map[string]string{"SMTP_TLS": "implicit", "SMTP_CA_FILE": pki.caFile},
+			tls:       true,
+		},
+		{
+			name:      "implicit TLS, insecure",
+			configure: func(f *fakeSMTP) { f.implicit = true },
+			settings:  map[string]string{"SMTP_TLS": "implicit", "SMTP_INSECURE": "yes"},
+			tls:       true,
+		},
+		{
+			name: "client certificate",
+			configure: func(f *fakeSMTP) {
+				f.implicit = true
+				f.tls = &tls.Config{
+					Certificates: []tls.Certificate{pki.server},
+					ClientAuth:   tls.RequireAndVerifyClientCert,
+					ClientCAs:    pki.pool,
+				}
+			},
+			settings: map[string]string{"SMTP_TLS": "implicit", "SMTP_CA_FILE": pki.caFile, "SMTP_CLIENT_CERT": pki.clientCert, "SMTP_CLIENT_KEY": pki.clientKey},
+			tls:      true,
+			cert:     true,
+		},
+		{
+			name:      "no TLS",
+			configure: func(f *fakeSMTP) { f.starttls = true },
+			settings:  map[string]string{"SMTP_TLS": "none"},
+		},
+		{
+			name:     "invalid mode",
+			settings: map[string]string{"SMTP_TLS": "sometimes"},
+			err:      "invalid SMTP_TLS 'sometimes'",
+		},
+		{
+			name:     "missing CA",
+			settings: map[string]string{"SMTP_CA_FILE": filepath.Join(t.TempDir(), "missing.pem")},
+			err:      "failed to read SMTP_CA_FILE",
+		},
+		{
+			name:     "certificate without a key",
+			settings: map[string]string{"SMTP_CLIENT_CERT": pki.clientCert},
+			err:      "must be set together",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			f := newFakeSMTP(t, func(f *fakeSMTP) {
+				f.tls = serverTLS
+				if test.configure != nil {
+					test.configure(f)
+				}
+			})
+			useServer(t, f)
+			for k, v := range test.settings {
+				t.Setenv(k, v)
+			}
+
+			e := NewDelivery(slog.Default())
+			err := e.sendSMTP("steve@example.com", []string{"steve@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			msgs := f.received()
+			if len(msgs) != 1 {
+				t.Fatalf("unexpected messages %v", msgs)
+			}
+			msg := msgs[0]
+			if msg.from != "steve@example.com" || len(msg.to) != 1 || msg.to[0] != "steve@example.com" || msg.user != "user" {
+				t.Fatalf("unexpected message %v", msg)
+			}
+			if msg.tls != test.tls || msg.clientCert != test.cert {
+				t.Fatalf("unexpected security, tls:%v cert:%v", msg.tls, msg.clientCert)
+			}
+		})
+	}
+}
+
+// TestPlainAuth ensures credentials aren't sent to a remote server over an
+// unencrypted connection, unless we've chosen not to use TLS.
+func TestPlainAuth(t *testing.T) {
+
+	a := &plainAuth{username: "user", password: "pass", host: "smtp.example.com"}
+
+	_, _, err := a.Start(&smtp.ServerInfo{Name: "smtp.example.com"})
+	if err == nil || !strings.Contains(err.Error(), "unencrypted") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+
+	_, _, err = a.Start(&smtp.ServerInfo{Name: "other.example.com", TLS: true})
+	if err == nil {
+		t.Fatalf("expected an error with the wrong host")
+	}
+
+	mech, resp, err := a.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+	if err != nil || mech != "PLAIN" || string(resp) != "\x00user\x00pass" {
+		t.Fatalf("unexpected result %s %q %v", mech, resp, err)
+	}
+
+	a.insecure = true
+	_, _, err = a.Start(&smtp.ServerInfo{Name: "smtp.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// TestSMTPPassword ensures the SMTP password may be read from a file, or
+// a command, and that failures to read it are reported.
+func TestSMTPPassword(t *testing.T) {
+
+	f := newFakeSMTP(t, nil)
+	useServer(t, f)
+	t.Setenv("SMTP_PASSWORD", "")
+
+	e := NewDelivery(slog.Default())
+	if e.isSMTP() {
+		t.Fatalf("SMTP shouldn't be used without a password")
+	}
+
+	t.Setenv("SMTP_PASSWORD_COMMAND", "echo pass")
+	if !e.isSMTP() {
+		t.Fatalf("SMTP should be used with a password command")
+	}
+
+	err := e.sendSMTP("steve@example.com", []string{"steve@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err != nil || len(f.received()) != 1 {
+		t.Fatalf("failed to send with a password command: %v", err)
+	}
+
+	t.Setenv("SMTP_PASSWORD_COMMAND", "exit 1")
+	err = e.sendSMTP("steve@example.com", []string{"steve@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "SMTP_PASSWORD_COMMAND failed") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	t.Setenv("SMTP_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	err = e.sendSMTP("steve@example.com", []string{"steve@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "failed to read SMTP_PASSWORD_FILE") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
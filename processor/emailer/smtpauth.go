@@ -0,0 +1,213 @@
+package emailer
+
+import (
+	"errors"
+	"net/smtp"
+	"strings"
+
+	"github.com/skx/rss2email/settings"
+)
+
+// The authentication mechanisms we support, chosen via the SMTP_AUTH
+// setting.
+const (
+	authPlain   = "PLAIN"
+	authLogin   = "LOGIN"
+	authCRAMMD5 = "CRAM-MD5"
+	authXOAUTH2 = "XOAUTH2"
+)
+
+// hasMechanism returns true if the given mechanism is in the list the
+// server offered.
+func hasMechanism(offered string, mechanism string) bool {
+	for _, m := range strings.Fields(offered) {
+		if strings.EqualFold(m, mechanism) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticator returns the smtp.Auth for our mechanism, other than
+// XOAUTH2, using the given password.
+func (s *smtpServer) authenticator(password string) smtp.Auth {
+
+	insecure := s.security == tlsNone
+
+	switch s.mechanism {
+	case authLogin:
+		return &loginAuth{username: s.username, password: password, host: s.host, insecure: insecure}
+	case authCRAMMD5:
+		return smtp.CRAMMD5Auth(s.username, password)
+	}
+	return &plainAuth{username: s.username, password: password, host: s.host, insecure: insecure}
+}
+
+// authOAuth authenticates via XOAUTH2, returning whether we used a cached
+// access token.
+func (s *smtpServer) authOAuth(c *smtp.Client) (bool, error) {
+
+	token, cached, err := newTokenSource(s.username).token()
+	if err != nil {
+		return false, err
+	}
+
+	return cached, c.Auth(&oauthAuth{username: s.username, token: token, host: s.host, insecure: s.security == tlsNone})
+}
+
+// checkServer returns an error if we're not talking to the expected server,
+// or if credentials would be sent over an unencrypted connection to a
+// remote server without the user choosing that.
+func checkServer(server *smtp.ServerInfo, host string, insecure bool) error {
+
+	if server.Name != host {
+		return errors.New("wrong host name")
+	}
+	if !server.TLS && !insecure && !isLocalhost(server.Name) {
+		return errors.New("refusing to send credentials over an unencrypted connection, set SMTP_TLS=none to allow this")
+	}
+	return nil
+}
+
+// isLocalhost returns true if the given host is the local machine.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// plainAuth implements the PLAIN authentication mechanism.
+//
+// Unlike smtp.PlainAuth we allow credentials to be sent over an
+// unencrypted connection to a remote server, but only if the user chose
+// not to use TLS.
+type plainAuth struct {
+
+	// username and password are our credentials.
+	username string
+	password string
+
+	// host is the name of the server we expect to be talking to.
+	host string
+
+	// insecure allows unencrypted connections.
+	insecure bool
+}
+
+// Start is part of the smtp.Auth interface.
+func (a *plainAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+
+	err := checkServer(server, a.host, a.insecure)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return authPlain, []byte("\x00" + a.username + "\x00" + a.password), nil
+}
+
+// Next is part of the smtp.Auth interface.
+func (a *plainAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("unexpected server challenge")
+	}
+	return nil, nil
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which is
+// offered by some servers which don't support PLAIN.
+type loginAuth struct {
+
+	// username and password are our credentials.
+	username string
+	password string
+
+	// host is the name of the server we expect to be talking to.
+	host string
+
+	// insecure allows unencrypted connections.
+	insecure bool
+
+	// step counts the challenges we've answered.
+	step int
+}
+
+// Start is part of the smtp.Auth interface.
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+
+	err := checkServer(server, a.host, a.insecure)
+	if err != nil {
+		return "", nil, err
+	}
+
+	a.step = 0
+	return authLogin, nil, nil
+}
+
+// Next is part of the smtp.Auth interface.
+//
+// The server prompts for the username, and then the password, we look at
+// the prompts but fall back to answering them in that order.
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+
+	if !more {
+		return nil, nil
+	}
+
+	a.step++
+	prompt := strings.ToLower(string(fromServer))
+
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	case a.step == 1:
+		return []byte(a.username), nil
+	case a.step == 2:
+		return []byte(a.password), nil
+	}
+	return nil, errors.New("unexpected server challenge")
+}
+
+// oauthAuth implements the XOAUTH2 authentication mechanism, used by Gmail
+// and Microsoft 365, with an OAuth2 access token.
+type oauthAuth struct {
+
+	// username is the address of the account.
+	username string
+
+	// token is the access token.
+	token string
+
+	// host is the name of the server we expect to be talking to.
+	host string
+
+	// insecure allows unencrypted connections.
+	insecure bool
+}
+
+// Start is part of the smtp.Auth interface.
+func (a *oauthAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+
+	err := checkServer(server, a.host, a.insecure)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return authXOAUTH2, []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// Next is part of the smtp.Auth interface.
+//
+// If the token is refused the server sends the details as a challenge,
+// which we must answer with an empty response before it reports the
+// failure.
+func (a *oauthAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// hasOAuth returns true if we're configured to fetch XOAUTH2 access tokens.
+func hasOAuth() bool {
+	return settings.Get("SMTP_OAUTH_TOKEN_URL") != "" && settings.HasSecret("SMTP_OAUTH_REFRESH_TOKEN")
+}
@@ -0,0 +1,219 @@
+package emailer
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestSMTPAuth ensures each of our authentication mechanisms works.
+func TestSMTPAuth(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		mechanisms []string
+		auth       string
+		password   string
+		err        string
+	}{
+		{name: "default", mechanisms: []string{"PLAIN", "LOGIN"}},
+		{name: "plain", mechanisms: []string{"PLAIN"}, auth: "plain"},
+		{name: "login", mechanisms: []string{"LOGIN"}, auth: "login"},
+		{name: "cram-md5", mechanisms: []string{"CRAM-MD5"}, auth: "CRAM-MD5"},
+		{name: "xoauth2 with an access token", mechanisms: []string{"XOAUTH2"}, auth: "xoauth2", password: "token"},
+		{name: "wrong password", mechanisms: []string{"LOGIN"}, auth: "login", password: "wrong", err: "535"},
+		{name: "wrong token", mechanisms: []string{"XOAUTH2"}, auth: "xoauth2", password: "wrong", err: "535"},
+		{name: "not offered", mechanisms: []string{"PLAIN"}, auth: "cram-md5", err: "doesn't support CRAM-MD5"},
+		{name: "invalid", mechanisms: []string{"PLAIN"}, auth: "kerberos", err: "invalid SMTP_AUTH 'KERBEROS'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			f := newFakeSMTP(t, func(f *fakeSMTP) {
+				f.mechanisms = test.mechanisms
+				f.token = "token"
+			})
+			useServer(t, f)
+			t.Setenv("SMTP_AUTH", test.auth)
+			if test.password != "" {
+				t.Setenv("SMTP_PASSWORD", test.password)
+			}
+
+			e := NewDelivery(slog.Default())
+			err := e.sendSMTP("steve@example.com", []string{"steve@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error '%s', got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			msgs := f.received()
+			if len(msgs) != 1 || msgs[0].user != "user" {
+				t.Fatalf("unexpected messages %v", msgs)
+			}
+		})
+	}
+}
+
+// tokenServer is a fake OAuth2 token endpoint.
+type tokenServer struct {
+
+	// mu protects the fields which follow.
+	mu sync.Mutex
+
+	// requests holds the refresh tokens we were sent.
+	requests []string
+
+	// tokens are the access tokens we issue, in order.
+	tokens []string
+
+	// rotate holds the refresh token we issue, if any.
+	rotate string
+}
+
+// newTokenServer starts a token endpoint, and configures our settings to
+// use it.
+func newTokenServer(t *testing.T, tokens ...string) *tokenServer {
+
+	ts := &tokenServer{tokens: tokens}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+
+		r.ParseForm()
+		ts.requests = append(ts.requests, r.Form.Get("refresh_token"))
+
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("client_id") != "id" || r.Form.Get("client_secret") != "secret" || len(ts.tokens) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "Token has been revoked."})
+			return
+		}
+
+		result := map[string]any{"access_token": ts.tokens[0], "expires_in": 3600}
+		if ts.rotate != "" {
+			result["refresh_token"] = ts.rotate
+		}
+		ts.tokens = ts.tokens[1:]
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("SMTP_AUTH", "xoauth2")
+	t.Setenv("SMTP_PASSWORD", "")
+	t.Setenv("SMTP_OAUTH_TOKEN_URL", server.URL)
+	t.Setenv("SMTP_OAUTH_CLIENT_ID", "id")
+	t.Setenv("SMTP_OAUTH_CLIENT_SECRET", "secret")
+	t.Setenv("SMTP_OAUTH_REFRESH_TOKEN", "refresh")
+	return ts
+}
+
+// refreshes returns the refresh tokens we were sent.
+func (ts *tokenServer) refreshes() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]string{}, ts.requests...)
+}
+
+// TestXOAUTH2 ensures access tokens are fetched, cached, and refreshed.
+func TestXOAUTH2(t *testing.T) {
+
+	f := newFakeSMTP(t, func(f *fakeSMTP) {
+		f.mechanisms = []string{"XOAUTH2"}
+		f.token = "first"
+	})
+	useServer(t, f)
+	ts := newTokenServer(t, "first", "second")
+	ts.rotate = "rotated"
+
+	e := NewDelivery(slog.Default())
+	if !e.isSMTP() {
+		t.Fatalf("SMTP should be used with a refresh token")
+	}
+
+	send := func() error {
+		return e.sendSMTP("steve@example.com", []string{"steve@example.com"}, []byte("Subject: test\r\n\r\ntest\r\n"))
+	}
+
+	// The first message fetches a token, the second uses our cache.
+	for i := 0; i < 2; i++ {
+		err := send()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if got := ts.refreshes(); len(got) != 1 || got[0] != "refresh" {
+		t.Fatalf("unexpected refreshes %v", got)
+	}
+
+	info, err := os.Stat(newTokenSource("user").path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected cache %v %v", info, err)
+	}
+
+	// If the server refuses our cached token we refresh it, with the
+	// refresh token the server gave us.
+	f.mu.Lock()
+	f.token = "second"
+	f.mu.Unlock()
+
+	err = send()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := ts.refreshes(); len(got) != 2 || got[1] != "rotated" {
+		t.Fatalf("unexpected refreshes %v", got)
+	}
+	if len(f.received()) != 3 {
+		t.Fatalf("unexpected messages %v", f.received())
+	}
+
+	// Failures to refresh are reported.
+	f.mu.Lock()
+	f.token = "third"
+	f.mu.Unlock()
+
+	err = send()
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant Token has been revoked.") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestTokenCacheKey ensures a cached token isn't used once the
+// configuration changes.
+func TestTokenCacheKey(t *testing.T) {
+
+	t.Setenv("HOME", t.TempDir())
+	ts := newTokenServer(t, "first", "second")
+
+	token, cached, err := newTokenSource("user").token()
+	if err != nil || token != "first" || cached {
+		t.Fatalf("unexpected token %s %v %v", token, cached, err)
+	}
+
+	token, cached, err = newTokenSource("user").token()
+	if err != nil || token != "first" || !cached {
+		t.Fatalf("unexpected token %s %v %v", token, cached, err)
+	}
+
+	token, cached, err = newTokenSource("other").token()
+	if err != nil || token != "second" || cached {
+		t.Fatalf("unexpected token %s %v %v", token, cached, err)
+	}
+
+	if got := ts.refreshes(); len(got) != 2 {
+		t.Fatalf("unexpected refreshes %v", got)
+	}
+}
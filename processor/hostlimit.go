@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// hostLimiter is used to ensure that we're polite to remote hosts.
+//
+// Some remote sites, such as Reddit, will apply rate-limiting if we make
+// too many requests in a short period of time.  Since we fetch feeds
+// concurrently we ensure that only a single request is in-flight to any
+// given host, and that consecutive requests to the same host are spaced
+// out by a minimum delay.
+type hostLimiter struct {
+
+	// mutex protects our map of hosts.
+	mutex sync.Mutex
+
+	// delay is the minimum time between two requests to the same host.
+	delay time.Duration
+
+	// hosts contains the state of each host we've made a request to.
+	hosts map[string]*hostState
+}
+
+// hostState contains the state for a single remote host.
+type hostState struct {
+
+	// lock is held while a request is in-flight to the host.
+	lock sync.Mutex
+
+	// last records when the most recent request to the host completed.
+	last time.Time
+}
+
+// newHostLimiter creates a new limiter, with the given delay between
+// requests to the same host.
+func newHostLimiter(delay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		delay: delay,
+		hosts: make(map[string]*hostState),
+	}
+}
+
+// acquire blocks until a request may be made to the given host.
+//
+// The function which is returned must be called once the request has
+// completed, to allow subsequent requests to that host to proceed.
+func (h *hostLimiter) acquire(logger *slog.Logger, host string) func() {
+
+	// Find the state for this host, creating it if necessary.
+	h.mutex.Lock()
+	state, ok := h.hosts[host]
+	if !ok {
+		state = &hostState{}
+		h.hosts[host] = state
+	}
+	h.mutex.Unlock()
+
+	// Wait for any in-flight request to complete.
+	state.lock.Lock()
+
+	// If we made a request recently then wait a while.
+	if !state.last.IsZero() {
+		wait := h.delay - time.Since(state.last)
+		if wait > 0 {
+
+			logger.Debug("fetching from the same host as a previous feed, adding delay",
+				slog.Duration("sleep", wait),
+				slog.String("host", host))
+
+			time.Sleep(wait)
+		}
+	}
+
+	return func() {
+		state.last = time.Now()
+		state.lock.Unlock()
+	}
+}
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestHostLimiterDelay ensures consecutive requests to a host are delayed.
+func TestHostLimiterDelay(t *testing.T) {
+
+	h := newHostLimiter(50 * time.Millisecond)
+
+	start := time.Now()
+
+	release := h.acquire(logger, "example.com")
+	release()
+
+	// A different host shouldn't be delayed
+	release = h.acquire(logger, "example.net")
+	release()
+
+	if time.Since(start) >= 50*time.Millisecond {
+		t.Fatalf("unexpected delay for distinct hosts")
+	}
+
+	// But the same host should be
+	release = h.acquire(logger, "example.com")
+	release()
+
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("expected a delay for the same host")
+	}
+}
+
+// TestHostLimiterConcurrency ensures only one request per-host is in-flight.
+func TestHostLimiterConcurrency(t *testing.T) {
+
+	h := newHostLimiter(0)
+
+	var mutex sync.Mutex
+	active := 0
+	max := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release := h.acquire(logger, "example.com")
+
+			mutex.Lock()
+			active++
+			if active > max {
+				max = active
+			}
+			mutex.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mutex.Lock()
+			active--
+			mutex.Unlock()
+
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if max != 1 {
+		t.Fatalf("expected a single in-flight request, got %d", max)
+	}
+}
@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/withstate"
+	"go.etcd.io/bbolt"
+)
+
+// feedIdentity returns the strategy used to identify the items in the
+// given feed, as set by the "identity" option.
+func feedIdentity(opts []configfile.Option) (string, error) {
+
+	identity := withstate.IdentityLink
+
+	for _, opt := range opts {
+		if opt.Name == "identity" {
+			identity = opt.Value
+		}
+	}
+
+	if !slices.Contains(withstate.Identities, identity) {
+		return withstate.IdentityLink, fmt.Errorf("unknown identity '%s', valid choices are %v", identity, withstate.Identities)
+	}
+
+	return identity, nil
+}
+
+// itemKey returns the key under which the state of the given item is
+// recorded, using the given identity strategy.
+//
+// If the feed contains duplicate links then items identified by their
+// normalized link have their GUID appended to the key, to tell them apart.
+// This is done after the link is canonicalized, as that drops the fragment.
+func itemKey(item withstate.FeedItem, identity string, dupes bool) string {
+
+	id := item.ID(identity)
+	if dupes && identity == withstate.IdentityNormalizedLink {
+		id += "#" + item.Item.GUID
+	}
+	return id
+}
+
+// canonicalKeys returns a map of the canonical form of the keys in the
+// given feed-bucket, to the keys themselves, for those keys which are
+// not already in canonical form.
+//
+// This is used to find items which were recorded before the feed used
+// the "normalized-link" identity, or whose links have since changed.
+func (p *Processor) canonicalKeys(feed string) map[string]string {
+
+	keys := make(map[string]string)
+
+	p.dbHandle.View(func(tx *bbolt.Tx) error {
+
+		b := tx.Bucket([]byte(feed))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k []byte, _ []byte) error {
+			canon := withstate.CanonicalURL(string(k))
+			if canon != string(k) {
+				keys[canon] = string(k)
+			}
+			return nil
+		})
+	})
+
+	return keys
+}
+
+// migrateItem looks for an item which was recorded under one of the
+// given legacy keys, and if found moves the record to the given key.
+//
+// This allows the identity strategy of a feed to be changed without
+// all of its existing items being regarded as new.
+func (p *Processor) migrateItem(feed string, key string, legacy ...string) (bool, error) {
+
+	// Most items are simply new, so look for a legacy key before we
+	// pay for a write transaction.
+	old := ""
+
+	p.dbHandle.View(func(tx *bbolt.Tx) error {
+
+		b := tx.Bucket([]byte(feed))
+		if b == nil {
+			return nil
+		}
+
+		for _, k := range legacy {
+			if k != "" && k != key && b.Get([]byte(k)) != nil {
+				old = k
+				return nil
+			}
+		}
+		return nil
+	})
+
+	if old == "" {
+		return false, nil
+	}
+
+	found := false
+
+	err := p.dbHandle.Update(func(tx *bbolt.Tx) error {
+
+		b := tx.Bucket([]byte(feed))
+
+		data := b.Get([]byte(old))
+		if data == nil {
+			return nil
+		}
+
+		// Copy the value, as it is only valid for the life of the
+		// transaction and we're modifying the bucket.
+		err := b.Put([]byte(key), append([]byte{}, data...))
+		if err != nil {
+			return err
+		}
+
+		found = true
+		return b.Delete([]byte(old))
+	})
+
+	return found, err
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/state"
+	"github.com/skx/rss2email/withstate"
+	"go.etcd.io/bbolt"
+)
+
+// TestFeedIdentity tests the identity option is validated.
+func TestFeedIdentity(t *testing.T) {
+
+	id, err := feedIdentity(nil)
+	if err != nil || id != withstate.IdentityLink {
+		t.Fatalf("unexpected default identity %s %v", id, err)
+	}
+
+	id, err = feedIdentity([]configfile.Option{{Name: "identity", Value: "guid"}})
+	if err != nil || id != withstate.IdentityGUID {
+		t.Fatalf("unexpected identity %s %v", id, err)
+	}
+
+	id, err = feedIdentity([]configfile.Option{{Name: "identity", Value: "bogus"}})
+	if err == nil || id != withstate.IdentityLink {
+		t.Fatalf("expected an error for a bogus identity, got %s %v", id, err)
+	}
+}
+
+// TestItemKeyDuplicates ensures items with duplicate links are recorded
+// under different keys, when identified by their normalized link.
+func TestItemKeyDuplicates(t *testing.T) {
+
+	one := withstate.FeedItem{Item: &gofeed.Item{Link: "http://www.example.com/post/", GUID: "one"}}
+	two := withstate.FeedItem{Item: &gofeed.Item{Link: "http://www.example.com/post/", GUID: "two"}}
+
+	a := itemKey(one, withstate.IdentityNormalizedLink, true)
+	b := itemKey(two, withstate.IdentityNormalizedLink, true)
+	if a == b {
+		t.Fatalf("duplicate items have the same key %s", a)
+	}
+	if a != "https://example.com/post#one" {
+		t.Fatalf("unexpected key %s", a)
+	}
+
+	// Without duplicates the key is the normalized link.
+	a = itemKey(one, withstate.IdentityNormalizedLink, false)
+	if a != "https://example.com/post" {
+		t.Fatalf("unexpected key %s", a)
+	}
+}
+
+// TestMigrateItem ensures items recorded under a legacy key are found,
+// and moved to their new key.
+func TestMigrateItem(t *testing.T) {
+
+	// Use a temporary state-directory
+	t.Setenv("HOME", t.TempDir())
+
+	p, err := New()
+	if err != nil {
+		t.Fatalf("error creating processor %s", err.Error())
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	feed := "https://example.com/feed"
+	err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(feed))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create bucket %s", err)
+	}
+
+	old := "http://www.example.com/post/?utm_source=rss"
+	err = p.recordItem(feed, old, state.Record{Status: state.StatusEmailed})
+	if err != nil {
+		t.Fatalf("failed to record item %s", err)
+	}
+
+	// The item can be found by its canonical form.
+	canonical := p.canonicalKeys(feed)
+	key := "https://example.com/post"
+	if canonical[key] != old {
+		t.Fatalf("failed to find canonical key, got %v", canonical)
+	}
+
+	found, err := p.migrateItem(feed, key, "https://example.com/post/", canonical[key])
+	if err != nil || !found {
+		t.Fatalf("failed to migrate item %v %v", found, err)
+	}
+	if !p.seenItem(feed, key) || p.seenItem(feed, old) {
+		t.Fatalf("item was not moved to its new key")
+	}
+
+	// Items recorded with the GUID appended to a duplicate link
+	// are found.
+	err = p.recordItem(feed, "https://example.com/dupe#guid-1", state.Record{Status: state.StatusEmailed})
+	if err != nil {
+		t.Fatalf("failed to record item %s", err)
+	}
+	found, err = p.migrateItem(feed, "guid-1", "https://example.com/dupe", "https://example.com/dupe#guid-1")
+	if err != nil || !found {
+		t.Fatalf("failed to migrate item %v %v", found, err)
+	}
+	if !p.seenItem(feed, "guid-1") {
+		t.Fatalf("item was not moved to its new key")
+	}
+
+	// Unknown items aren't found.
+	found, err = p.migrateItem(feed, "guid-2", "https://example.com/other")
+	if err != nil || found {
+		t.Fatalf("unexpected migration %v %v", found, err)
+	}
+}
@@ -0,0 +1,417 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/skx/rss2email/processor/emailer"
+	"github.com/skx/rss2email/state"
+	"go.etcd.io/bbolt"
+)
+
+// OutboxRetryDelay is the delay before the first retry of a message which
+// could not be delivered.  The delay doubles after each failed attempt, up
+// to a maximum of OutboxMaxDelay.
+const OutboxRetryDelay = 5 * time.Minute
+
+// OutboxMaxDelay is the maximum delay between attempts to deliver a message.
+const OutboxMaxDelay = 24 * time.Hour
+
+// OutboxEntry is a message which could not be delivered, and which is
+// saved in our state database so that it can be retried.
+type OutboxEntry struct {
+
+	// ID is the identifier of the entry, it is the key of the entry
+	// in the outbox bucket and is not stored in the value.
+	ID uint64 `json:"-"`
+
+	// Feed is the URL of the feed from which the message came.
+	Feed string `json:"feed"`
+
+	// Recipient is the address to which the message should be sent, or
+	// the addresses separated by commas if it is sent to several.
+	Recipient string `json:"recipient"`
+
+	// Recipients holds each of the addresses to which the message
+	// should be sent, it is empty for entries saved by older releases.
+	Recipients []string `json:"recipients,omitempty"`
+
+	// Sender is the envelope sender of the message, it is empty for
+	// entries saved by older releases.
+	Sender string `json:"sender,omitempty"`
+
+	// Message contains the rendered message.
+	Message []byte `json:"message"`
+
+	// Created is the time at which the first delivery attempt failed.
+	Created time.Time `json:"created"`
+
+	// Attempts is the number of failed delivery attempts.
+	Attempts int `json:"attempts"`
+
+	// NextAttempt is the time after which we'll retry delivery.
+	NextAttempt time.Time `json:"next_attempt"`
+
+	// LastError holds the error from the most recent delivery attempt.
+	LastError string `json:"last_error"`
+
+	// Items holds the items which the message contains, whose records
+	// are updated once it has been delivered.  It is empty for entries
+	// saved by older releases.
+	Items []OutboxItem `json:"items,omitempty"`
+}
+
+// OutboxItem identifies an item contained in a message in our outbox.
+type OutboxItem struct {
+
+	// Feed is the URL of the feed, the bucket in which the record of
+	// the item is stored.
+	Feed string `json:"feed"`
+
+	// Key is the key under which the record of the item is stored.
+	Key string `json:"key"`
+}
+
+// backoff returns the delay before the next attempt, given the number of
+// attempts which have been made so far.
+func backoff(attempts int) time.Duration {
+
+	delay := OutboxRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= OutboxMaxDelay {
+			return OutboxMaxDelay
+		}
+	}
+	return delay
+}
+
+// envelope returns the envelope sender, and recipients, of the entry.
+//
+// Older releases sent each message to a single recipient, which was also
+// used as the sender.
+func (o OutboxEntry) envelope() (string, []string) {
+
+	recipients := o.Recipients
+	if len(recipients) == 0 {
+		recipients = []string{o.Recipient}
+	}
+
+	sender := o.Sender
+	if sender == "" {
+		sender = o.Recipient
+	}
+
+	return sender, recipients
+}
+
+// outboxKey converts the ID of an outbox entry to the key we use to store it.
+func outboxKey(id uint64) []byte {
+	return []byte(fmt.Sprintf("%020d", id))
+}
+
+// saveFailures stores any messages which could not be delivered in our
+// outbox, so that they can be retried in the future.
+//
+// The given items are those which the messages contain, whose records are
+// updated once a retry succeeds.
+//
+// The addresses to which delivery failed are returned.  If the error is
+// not a delivery error then it is returned, as there is nothing we can retry.
+func (p *Processor) saveFailures(logger *slog.Logger, feed string, items []OutboxItem, err error) ([]string, error) {
+
+	var derr *emailer.DeliveryError
+	if !errors.As(err, &derr) {
+		return nil, err
+	}
+
+	var failed []string
+	now := time.Now()
+
+	for _, f := range derr.Failures {
+
+		entry := OutboxEntry{
+			Feed:        feed,
+			Recipient:   f.Recipient,
+			Recipients:  f.Recipients,
+			Sender:      f.Sender,
+			Message:     f.Message,
+			Created:     now,
+			Attempts:    1,
+			NextAttempt: now.Add(backoff(1)),
+			LastError:   f.Err.Error(),
+			Items:       items,
+		}
+
+		id, saveErr := p.saveOutboxEntry(entry)
+		if saveErr != nil {
+
+			logger.Error("failed to save message to outbox",
+				slog.String("recipient", f.Recipient),
+				slog.String("error", saveErr.Error()))
+
+			return nil, fmt.Errorf("failed to save message to outbox: %s (delivery failed with %s)", saveErr, f.Err)
+		}
+
+		if len(f.Recipients) > 0 {
+			failed = append(failed, f.Recipients...)
+		} else {
+			failed = append(failed, f.Recipient)
+		}
+
+		logger.Warn("failed to send email, it will be retried later",
+			slog.String("recipient", f.Recipient),
+			slog.Uint64("outbox-id", id),
+			slog.Time("next-attempt", entry.NextAttempt),
+			slog.String("error", f.Err.Error()))
+	}
+
+	return failed, nil
+}
+
+// saveOutboxEntry stores the given entry in the outbox, allocating an ID
+// for it if it doesn't already have one.
+func (p *Processor) saveOutboxEntry(entry OutboxEntry) (uint64, error) {
+
+	err := p.dbHandle.Update(func(tx *bbolt.Tx) error {
+
+		b, err := tx.CreateBucketIfNotExists([]byte(state.OutboxBucket))
+		if err != nil {
+			return err
+		}
+
+		if entry.ID == 0 {
+			entry.ID, err = b.NextSequence()
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(outboxKey(entry.ID), data)
+	})
+
+	return entry.ID, err
+}
+
+// Outbox returns the messages which are waiting to be retried.
+func (p *Processor) Outbox() ([]OutboxEntry, error) {
+
+	var entries []OutboxEntry
+
+	err := p.dbHandle.View(func(tx *bbolt.Tx) error {
+
+		b := tx.Bucket([]byte(state.OutboxBucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k []byte, v []byte) error {
+
+			var entry OutboxEntry
+			err := json.Unmarshal(v, &entry)
+			if err != nil {
+				return fmt.Errorf("failed to decode outbox entry %s: %s", k, err)
+			}
+
+			entry.ID, err = strconv.ParseUint(string(k), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid outbox key %s: %s", k, err)
+			}
+
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+
+	return entries, err
+}
+
+// DropOutbox removes the entries with the given IDs from the outbox,
+// without attempting to deliver them.
+func (p *Processor) DropOutbox(ids []uint64) error {
+
+	return p.dbHandle.Update(func(tx *bbolt.Tx) error {
+
+		b := tx.Bucket([]byte(state.OutboxBucket))
+
+		for _, id := range ids {
+			if b == nil || b.Get(outboxKey(id)) == nil {
+				return fmt.Errorf("outbox entry %d not found", id)
+			}
+
+			err := b.Delete(outboxKey(id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// delivered removes an entry, which has now been delivered, from the
+// outbox, and records the delivery in the records of the items which it
+// contains.
+func (p *Processor) delivered(entry OutboxEntry) error {
+
+	_, recipients := entry.envelope()
+
+	return p.dbHandle.Update(func(tx *bbolt.Tx) error {
+
+		b := tx.Bucket([]byte(state.OutboxBucket))
+		if b == nil || b.Get(outboxKey(entry.ID)) == nil {
+			return fmt.Errorf("outbox entry %d not found", entry.ID)
+		}
+
+		err := b.Delete(outboxKey(entry.ID))
+		if err != nil {
+			return err
+		}
+
+		for _, item := range entry.Items {
+			err = markDelivered(tx, item, recipients)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// markDelivered updates the record of the given item to show that it has
+// now been delivered to the given recipients, for which delivery failed.
+func markDelivered(tx *bbolt.Tx, item OutboxItem, recipients []string) error {
+
+	// The feed, or item, might have been removed since.
+	b := tx.Bucket([]byte(item.Feed))
+	if b == nil {
+		return nil
+	}
+	data := b.Get([]byte(item.Key))
+	if data == nil {
+		return nil
+	}
+
+	rec, err := state.ParseRecord(data)
+	if err != nil {
+		return err
+	}
+	if rec.Status != state.StatusFailed {
+		return nil
+	}
+
+	sent := make(map[string]bool)
+	for _, addr := range recipients {
+		sent[addr] = true
+	}
+
+	var failed []string
+	for _, addr := range rec.Failed {
+		if !sent[addr] {
+			failed = append(failed, addr)
+		}
+	}
+
+	rec.SetDelivery(append(rec.Recipients, rec.Failed...), failed)
+
+	data, err = rec.Marshal()
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(item.Key), data)
+}
+
+// RetryOutbox attempts to deliver the messages in our outbox.
+//
+// Normally only messages whose backoff has expired are retried, but if
+// force is true then all the messages are retried immediately.  If a list
+// of IDs is given then only those entries are retried.
+func (p *Processor) RetryOutbox(force bool, ids []uint64) []error {
+
+	var errs []error
+
+	entries, err := p.Outbox()
+	if err != nil {
+		return append(errs, err)
+	}
+
+	// The entries we were asked to retry.
+	wanted := make(map[uint64]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	now := time.Now()
+
+	for _, entry := range entries {
+
+		if len(ids) > 0 {
+			if !wanted[entry.ID] {
+				continue
+			}
+			delete(wanted, entry.ID)
+		}
+
+		if !force && now.Before(entry.NextAttempt) {
+			continue
+		}
+
+		logger := p.logger.With(
+			slog.Group("outbox",
+				slog.Uint64("id", entry.ID),
+				slog.String("feed", entry.Feed),
+				slog.Int("attempts", entry.Attempts)))
+
+		helper := emailer.NewDelivery(logger)
+		helper.SetSession(p.smtp)
+		sender, recipients := entry.envelope()
+		err = helper.Deliver(sender, recipients, entry.Message)
+
+		if err == nil {
+
+			logger.Debug("delivered message from outbox",
+				slog.String("recipient", entry.Recipient))
+
+			err = p.delivered(entry)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		// Failed again, so update the entry and back off further.
+		entry.Attempts++
+		entry.NextAttempt = now.Add(backoff(entry.Attempts))
+		entry.LastError = err.Error()
+
+		logger.Warn("failed to deliver message from outbox",
+			slog.String("recipient", entry.Recipient),
+			slog.Time("next-attempt", entry.NextAttempt),
+			slog.String("error", err.Error()))
+
+		_, err = p.saveOutboxEntry(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to update outbox entry %d: %s", entry.ID, err))
+			continue
+		}
+
+		// Only report the failure if we were asked to retry.
+		if force {
+			errs = append(errs, fmt.Errorf("failed to deliver outbox entry %d to %s: %s", entry.ID, entry.Recipient, entry.LastError))
+		}
+	}
+
+	for id := range wanted {
+		errs = append(errs, fmt.Errorf("outbox entry %d not found", id))
+	}
+
+	return errs
+}
@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/skx/rss2email/processor/emailer"
+	"github.com/skx/rss2email/state"
+	"go.etcd.io/bbolt"
+)
+
+// TestBackoff ensures our retry delay doubles, up to the maximum.
+func TestBackoff(t *testing.T) {
+
+	if backoff(1) != OutboxRetryDelay {
+		t.Fatalf("unexpected initial delay %s", backoff(1))
+	}
+	if backoff(3) != 4*OutboxRetryDelay {
+		t.Fatalf("unexpected third delay %s", backoff(3))
+	}
+	if backoff(100) != OutboxMaxDelay {
+		t.Fatalf("unexpected maximum delay %s", backoff(100))
+	}
+}
+
+// TestOutbox ensures failed messages are saved, retried, and dropped.
+func TestOutbox(t *testing.T) {
+
+	// Use a temporary state-directory
+	t.Setenv("HOME", t.TempDir())
+
+	// Ensure delivery fails, rather than sending a real email.
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", "1")
+	t.Setenv("SMTP_USERNAME", "user")
+	t.Setenv("SMTP_PASSWORD", "pass")
+
+	p, err := New()
+	if err != nil {
+		t.Fatalf("error creating processor %s", err.Error())
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	// A non-delivery error is returned as-is.
+	_, err = p.saveFailures(logger, "https://example.com/", nil, errors.New("template error"))
+	if err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+
+	// But delivery errors are saved.
+	failed, err := p.saveFailures(logger, "https://example.com/", nil, &emailer.DeliveryError{
+		Failures: []emailer.Failure{
+			{Recipient: "bob@example.com", Message: []byte("Subject: one\n\nbody"), Err: errors.New("failed")},
+			{Recipient: "alice@example.com", Message: []byte("Subject: two\n\nbody"), Err: errors.New("failed")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error saving failures: %s", err)
+	}
+	if len(failed) != 2 || failed[0] != "bob@example.com" {
+		t.Fatalf("unexpected failed recipients %v", failed)
+	}
+
+	entries, err := p.Outbox()
+	if err != nil {
+		t.Fatalf("unexpected error reading outbox: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected two outbox entries, got %d", len(entries))
+	}
+	if entries[0].ID != 1 || entries[0].Recipient != "bob@example.com" || entries[0].Attempts != 1 {
+		t.Fatalf("unexpected outbox entry %v", entries[0])
+	}
+
+	// Retrying without force does nothing, as the backoff hasn't expired.
+	errs := p.RetryOutbox(false, nil)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors retrying: %v", errs)
+	}
+	entries, _ = p.Outbox()
+	if entries[0].Attempts != 1 {
+		t.Fatalf("unexpected retry of outbox entry")
+	}
+
+	// Forcing a retry will fail, and increase the backoff.
+	errs = p.RetryOutbox(true, []uint64{1})
+	if len(errs) != 1 {
+		t.Fatalf("expected a single error retrying, got %v", errs)
+	}
+	entries, _ = p.Outbox()
+	if entries[0].Attempts != 2 || entries[1].Attempts != 1 {
+		t.Fatalf("unexpected attempt counts after retry")
+	}
+	if entries[0].NextAttempt.Before(time.Now().Add(backoff(1))) {
+		t.Fatalf("expected the backoff to have increased")
+	}
+
+	// Unknown entries can't be retried, or dropped.
+	errs = p.RetryOutbox(true, []uint64{33})
+	if len(errs) != 1 {
+		t.Fatalf("expected an error retrying a missing entry")
+	}
+	err = p.DropOutbox([]uint64{33})
+	if err == nil {
+		t.Fatalf("expected an error dropping a missing entry")
+	}
+
+	// Drop the entries.
+	err = p.DropOutbox([]uint64{1, 2})
+	if err != nil {
+		t.Fatalf("unexpected error dropping entries: %s", err)
+	}
+	entries, _ = p.Outbox()
+	if len(entries) != 0 {
+		t.Fatalf("expected an empty outbox, got %d entries", len(entries))
+	}
+}
+
+// TestOutboxDelivered ensures the record of an item is updated once the
+// message containing it has been delivered from the outbox.
+func TestOutboxDelivered(t *testing.T) {
+
+	// Use a temporary state-directory
+	t.Setenv("HOME", t.TempDir())
+
+	p, err := New()
+	if err != nil {
+		t.Fatalf("error creating processor %s", err.Error())
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	feed := "https://example.com/"
+	err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(feed))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create bucket: %s", err)
+	}
+
+	rec := state.Record{Title: "one"}
+	rec.SetDelivery([]string{"bob@example.com", "alice@example.com"}, []string{"alice@example.com"})
+	err = p.recordItem(feed, "https://example.com/one", rec)
+	if err != nil {
+		t.Fatalf("failed to record item: %s", err)
+	}
+
+	_, err = p.saveFailures(logger, feed, []OutboxItem{{Feed: feed, Key: "https://example.com/one"}}, &emailer.DeliveryError{
+		Failures: []emailer.Failure{
+			{Recipient: "alice@example.com", Message: []byte("Subject: one\n\nbody"), Err: errors.New("failed")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error saving failures: %s", err)
+	}
+
+	entries, _ := p.Outbox()
+	if len(entries) != 1 {
+		t.Fatalf("expected one outbox entry, got %d entries", len(entries))
+	}
+
+	err = p.delivered(entries[0])
+	if err != nil {
+		t.Fatalf("unexpected error removing delivered entry: %s", err)
+	}
+
+	entries, _ = p.Outbox()
+	if len(entries) != 0 {
+		t.Fatalf("expected an empty outbox, got %d entries", len(entries))
+	}
+
+	err = p.dbHandle.View(func(tx *bbolt.Tx) error {
+		rec, err = state.ParseRecord(tx.Bucket([]byte(feed)).Get([]byte("https://example.com/one")))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to read record: %s", err)
+	}
+	if rec.Status != state.StatusEmailed || len(rec.Recipients) != 2 || len(rec.Failed) != 0 {
+		t.Fatalf("unexpected record after delivery %v", rec)
+	}
+}
+
+// TestOutboxEnvelope ensures entries are retried with their envelope,
+// including those saved by older releases which have none.
+func TestOutboxEnvelope(t *testing.T) {
+
+	sender, recipients := OutboxEntry{Recipient: "bob@example.com"}.envelope()
+	if sender != "bob@example.com" || len(recipients) != 1 || recipients[0] != "bob@example.com" {
+		t.Fatalf("unexpected envelope %s %v", sender, recipients)
+	}
+
+	sender, recipients = OutboxEntry{
+		Recipient:  "bob@example.com, alice@example.com",
+		Recipients: []string{"bob@example.com", "alice@example.com"},
+		Sender:     "rss2email@example.org",
+	}.envelope()
+	if sender != "rss2email@example.org" || len(recipients) != 2 {
+		t.Fatalf("unexpected envelope %s %v", sender, recipients)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/k3a/html2text"
@@ -28,6 +29,14 @@ import (
 	"go.etcd.io/bbolt"
 )
 
+// DefaultWorkers is the number of feeds which we'll fetch concurrently,
+// unless changed via SetWorkers.
+const DefaultWorkers = 4
+
+// HostDelay is the minimum delay between two consecutive requests made
+// to the same remote host.
+const HostDelay = 5 * time.Second
+
 // Processor stores our state
 type Processor struct {
 
@@ -43,6 +52,27 @@ type Processor struct {
 
 	// version stores the version of our application.
 	version string
+
+	// workers holds the number of feeds we'll fetch concurrently.
+	workers int
+
+	// hosts is used to limit the requests we make to each remote host.
+	hosts *hostLimiter
+
+	// mutex is held while the items of a feed are processed.
+	mutex sync.Mutex
+
+	// digest is true if we send a single digest for each run, rather
+	// than an email for each new item.
+	digest bool
+
+	// digests holds the digests we're building for this run, keyed
+	// by the recipients.
+	digests map[string]*digest
+
+	// smtp is the SMTP session used to send our messages, so that
+	// we don't connect to the server for each one.
+	smtp *emailer.Session
 }
 
 // New creates a new Processor object.
@@ -64,16 +94,36 @@ func New() (*Processor, error) {
 		return nil, err
 	}
 
-	return &Processor{send: true, dbHandle: db}, nil
+	// Update any records written by older releases.
+	_, err = state.Migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate state database: %s", err)
+	}
+
+	return &Processor{send: true,
+		dbHandle: db,
+		workers:  DefaultWorkers,
+		hosts:    newHostLimiter(HostDelay),
+		digests:  make(map[string]*digest),
+		smtp:     emailer.NewSession(slog.Default()),
+	}, nil
 }
 
-// Close should be called to cleanup our internal database-handle.
+// Close should be called to cleanup our internal database-handle, and
+// any connection to the SMTP server.
 func (p *Processor) Close() {
+	p.smtp.Close()
 	p.dbHandle.Close()
 }
 
 // ProcessFeeds is the main workhorse here, we process each feed and send
 // emails appropriately.
+//
+// Feeds are fetched in parallel by a bounded pool of workers, the size of
+// which may be changed via SetWorkers.  To avoid annoying remote sites we
+// never make more than one request to a given host at a time, and we add
+// a delay between consecutive requests to the same host.
 func (p *Processor) ProcessFeeds(recipients []string) []error {
 
 	//
@@ -94,22 +144,29 @@ func (p *Processor) ProcessFeeds(recipients []string) []error {
 		return errors
 	}
 
-	// Keep track of the previous hostname from which we fetched a feed
-	prev := ""
+	// Warn about any mistakes in the per-feed options, which
+	// would otherwise be ignored.
+	for _, problem := range conf.Check() {
+		p.logger.Warn("invalid configuration option",
+			slog.String("error", problem.Error()))
+	}
+
+	// Retry any messages which previously failed to be delivered.
+	if p.send {
+		errors = append(errors, p.RetryOutbox(false, nil)...)
+	}
 
 	// Keep track of each feed we've processed
 	feeds := []string{}
 
 	// We're about to process the feeds.
 	p.logger.Debug("about to process feeds",
-		slog.Int("feed_count", len(entries)))
+		slog.Int("feed_count", len(entries)),
+		slog.Int("workers", p.workers))
 
 	// For each feed contained in the configuration file
 	for _, entry := range entries {
 
-		p.logger.Debug("starting to process feed",
-			slog.String("feed", entry.URL))
-
 		// Create a bucket to hold the entry-state here,
 		// if we've not done so previously.
 		//
@@ -123,10 +180,13 @@ func (p *Processor) ProcessFeeds(recipients []string) []error {
 		// a bucket for each Feed URL, and then store the
 		// URLs we've seen with a random value.
 		//
+		// We do this before we start any workers, so that they
+		// can assume the bucket exists.
+		//
 		err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
 			_, err2 := tx.CreateBucketIfNotExists([]byte(entry.URL))
 			if err2 != nil {
-				return fmt.Errorf("create bucket failed: %s", err)
+				return fmt.Errorf("create bucket failed: %s", err2)
 			}
 			return nil
 		})
@@ -145,92 +205,50 @@ func (p *Processor) ProcessFeeds(recipients []string) []error {
 		// Record the URL of the feed in our list,
 		// which is used for reaping obsolete feeds
 		feeds = append(feeds, entry.URL)
+	}
 
-		// Should we sleep before getting this feed?
-		sleep := 0
-
-		// We default to notifying the global recipient-list.
-		//
-		// But there might be a per-feed set of recipients which
-		// we'll prefer if available.
-		feedRecipients := recipients
-
-		// parse the hostname form the URL
-		//
-		// We do this because some remote sites, such as Reddit,
-		// will apply rate-limiting if we make too many consecutive
-		// requests in a short period of time.
-		host := ""
-		u, err2 := url.Parse(entry.URL)
-		if err2 == nil {
-			host = u.Host
-		}
-
-		// Are we fetching from the same host as the previous feed?
-		// If so then we'll add a delay to try to avoid annoying that
-		// host.
-		if host == prev {
-
-			p.logger.Debug("fetching from same host as previous feed adding delay",
-				slog.Int("sleep", 5),
-				slog.String("host", prev),
-				slog.String("feed", entry.URL))
-
-			sleep = 5
-		}
-
-		// Now look at each per-feed option, if any are set.
-		for _, opt := range entry.Options {
-
-			// Is it a set of recipients?
-			if opt.Name == "notify" {
-
-				// Save the values
-				feedRecipients = strings.Split(opt.Value, ",")
+	// The queue of feeds to be processed by our workers.
+	jobs := make(chan configfile.Feed)
 
-				// But trim leading/trailing space
-				for i := range feedRecipients {
-					feedRecipients[i] = strings.TrimSpace(feedRecipients[i])
-				}
-			}
+	// errMutex protects the errors our workers append.
+	var errMutex sync.Mutex
 
-			// Sleep setting?
-			if opt.Name == "sleep" {
+	// Launch the workers.
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
 
-				// Convert the value, and if there was
-				// no error save it away.
-				num, nErr := strconv.Atoi(opt.Value)
-				if nErr != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-					p.logger.Warn("failed to parse sleep value as number",
-						slog.String("sleep", opt.Value),
-						slog.String("error", nErr.Error()))
+			for entry := range jobs {
 
-					// be conservative
-					sleep = 10
-				} else {
-					sleep = num
+				// Process this specific entry.
+				err := p.processEntry(entry, recipients)
+				if err != nil {
+					errMutex.Lock()
+					errors = append(errors, fmt.Errorf("error processing %s - %s", entry.URL, err))
+					errMutex.Unlock()
 				}
 			}
-		}
-
-		// If we're supposed to sleep, do so
-		if sleep != 0 {
-
-			p.logger.Debug("sleeping",
-				slog.Int("sleep", sleep))
+		}()
+	}
 
-			time.Sleep(time.Duration(sleep) * time.Second)
-		}
+	// Feed each entry to the workers, and wait for them to complete.
+	for _, entry := range entries {
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
 
-		// Process this specific entry.
-		err = p.processFeed(entry, feedRecipients)
-		if err != nil {
-			errors = append(errors, fmt.Errorf("error processing %s - %s", entry.URL, err))
-		}
+	// If we're sending a digest for the whole run, then do so.
+	if p.digest {
+		errors = append(errors, p.sendRunDigests()...)
+	}
 
-		// Now update with our current host.
-		prev = host
+	// Send any scheduled digests which are now due.
+	if p.send {
+		errors = append(errors, p.sendScheduledDigests(entries)...)
 	}
 
 	// Reap feeds which are obsolete.
@@ -243,6 +261,14 @@ func (p *Processor) ProcessFeeds(recipients []string) []error {
 		errors = append(errors, err)
 	}
 
+	// Disconnect from the SMTP server, rather than holding an idle
+	// connection until our next run.
+	err = p.smtp.Close()
+	if err != nil {
+		p.logger.Debug("failed to disconnect from SMTP server",
+			slog.String("error", err.Error()))
+	}
+
 	// We're about to process the feeds.
 	p.logger.Debug("all feeds processed",
 		slog.Int("feed_count", len(entries)))
@@ -251,12 +277,73 @@ func (p *Processor) ProcessFeeds(recipients []string) []error {
 	return errors
 }
 
+// processEntry handles the per-feed options which relate to the fetching
+// of a feed, and then calls processFeed to do the real work.
+//
+// This is invoked concurrently by the workers launched in ProcessFeeds.
+func (p *Processor) processEntry(entry configfile.Feed, recipients []string) error {
+
+	p.logger.Debug("starting to process feed",
+		slog.String("feed", entry.URL))
+
+	// Should we sleep before getting this feed?
+	sleep := 0
+
+	// We default to notifying the global recipient-list.
+	//
+	// But there might be a per-feed set of recipients which
+	// we'll prefer if available.
+	feedRecipients := recipients
+
+	// Now look at each per-feed option, if any are set.
+	for _, opt := range entry.Options {
+
+		// Is it a set of recipients?
+		if opt.Name == "notify" {
+
+			// Save the values
+			feedRecipients = strings.Split(opt.Value, ",")
+
+			// But trim leading/trailing space
+			for i := range feedRecipients {
+				feedRecipients[i] = strings.TrimSpace(feedRecipients[i])
+			}
+		}
+
+		// Sleep setting?
+		if opt.Name == "sleep" {
+
+			// Convert the value, and if there was
+			// no error save it away.
+			num, nErr := strconv.Atoi(opt.Value)
+			if nErr != nil {
+
+				p.logger.Warn("failed to parse sleep value as number",
+					slog.String("sleep", opt.Value),
+					slog.String("error", nErr.Error()))
+
+				// be conservative
+				sleep = 10
+			} else {
+				sleep = num
+			}
+		}
+	}
+
+	return p.processFeed(entry, feedRecipients, time.Duration(sleep)*time.Second)
+}
+
 // processFeed takes a configuration entry as input, fetches the appropriate
 // remote contents, and then processes each feed item found within it.
 //
 // Feed items which are new/unread will generate an email, unless they are
 // specifically excluded by the per-feed options.
-func (p *Processor) processFeed(entry configfile.Feed, recipients []string) error {
+//
+// The fetch is carried out while holding the per-host slot for the feed's
+// host, and the given delay is applied before the fetch is made.  Once the
+// feed has been retrieved we process the items while holding our mutex, so
+// that we don't send emails or update state concurrently.
+func (p *Processor) processFeed(entry configfile.Feed, recipients []string, sleep time.Duration) error {
 
 	// Create a local logger with some dedicated information
 	logger := p.logger.With(
@@ -273,9 +360,44 @@ func (p *Processor) processFeed(entry configfile.Feed, recipients []string) erro
 		}
 	}
 
+	// How do we identify the items in this feed?
+	identity, err := feedIdentity(entry.Options)
+	if err != nil {
+		logger.Warn("failed to parse 'identity', using the default",
+			slog.String("default", identity),
+			slog.String("error", err.Error()))
+	}
+
+	// parse the hostname form the URL
+	//
+	// We do this because some remote sites, such as Reddit,
+	// will apply rate-limiting if we make too many consecutive
+	// requests in a short period of time.
+	host := ""
+	u, err := url.Parse(entry.URL)
+	if err == nil {
+		host = u.Host
+	}
+
+	// Wait until we're allowed to make a request to this host.
+	release := p.hosts.acquire(logger, host)
+
+	// If we're supposed to sleep, do so
+	if sleep != 0 {
+
+		logger.Debug("sleeping",
+			slog.Duration("sleep", sleep))
+
+		time.Sleep(sleep)
+	}
+
 	// Fetch the feed for the input URL
 	helper := httpfetch.New(entry, logger, p.version)
 	feed, err := helper.Fetch()
+
+	// Let other requests to this host proceed.
+	release()
+
 	if err != nil {
 
 		if err == httpfetch.ErrUnchanged {
@@ -291,10 +413,33 @@ func (p *Processor) processFeed(entry configfile.Feed, recipients []string) erro
 	// Show how many entries we've found in the feed.
 	logger.Debug("feed retrieved", slog.Int("entries", len(feed.Items)))
 
+	// Only one feed may be processed at a time, to ensure that we
+	// don't send emails, or update our state, concurrently.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
 	// Count how many seen/unseen items there were.
 	seen := 0
 	unseen := 0
 
+	// Are we sending the new items as a digest?
+	//
+	// If we're sending a single digest for the whole run we add the
+	// items to that, otherwise we might send one for this feed.
+	var dig *digest
+	if p.digest {
+		dig = p.runDigest(recipients)
+	} else if isDigest(entry) {
+		dig = &digest{recipients: recipients, opts: entry.Options}
+	}
+
+	// Or are we queueing them for a scheduled digest?
+	sched, err := feedSchedule(entry.Options)
+	if err != nil {
+		logger.Warn("ignoring invalid digest-schedule",
+			slog.String("error", err.Error()))
+	}
+
 	// Keep track of all the items in the feed.
 	items := []string{}
 
@@ -327,12 +472,22 @@ func (p *Processor) processFeed(entry configfile.Feed, recipients []string) erro
 		seenDupes[str.Link]++
 	}
 
+	// Are we notifying the recipients of updated items?
+	updates := notifyUpdates(entry)
+
+	// If we identify items by their normalized link then some might
+	// have been recorded under a different version of their link.
+	var canonical map[string]string
+	if identity == withstate.IdentityNormalizedLink {
+		canonical = p.canonicalKeys(entry.URL)
+	}
+
 	// For each entry in the feed ..
 	for _, xp := range feed.Items {
 
 		// If the feed contains duplicate entries
 		// then we try to uniquify them.
-		if dupes {
+		if dupes && identity == withstate.IdentityLink {
 			xp.Link += "#"
 			xp.Link += xp.GUID
 		}
@@ -352,90 +507,188 @@ func (p *Processor) processFeed(entry configfile.Feed, recipients []string) erro
 			item.Tag = tag
 		}
 
+		// The key under which we record the state of the item.
+		id := itemKey(item, identity, dupes)
+
 		// Keep track of the fact that we saw this feed-item.
 		//
 		// This is used for pruning the BoltDB state file.
-		items = append(items, item.Link)
+		items = append(items, id)
 
-		// Assume this feed-entry is new, and we've not seen it
-		// in the past.
-		isNew := true
+		// Is this item already in the BoltDB?
+		//
+		// If so it's not new, and there's nothing to do.
+		seenBefore := p.seenItem(entry.URL, id)
+
+		// If not it might have been recorded under its link, before
+		// the identity of the feed was changed, or under a different
+		// version of its link.  If the feed contained duplicate links
+		// at the time its link would have had the GUID appended.
+		if !seenBefore && identity != withstate.IdentityLink {
+			legacy := []string{item.Link, canonical[id]}
+			if xp.GUID != "" && !strings.HasSuffix(item.Link, "#"+xp.GUID) {
+				legacy = append(legacy, item.Link+"#"+xp.GUID)
+			}
 
-		// Is this link already in the BoltDB?
+			seenBefore, err = p.migrateItem(entry.URL, id, legacy...)
+			if err != nil {
+				logger.Error("failed to migrate item",
+					slog.String("link", item.Link),
+					slog.String("error", err.Error()))
+				return err
+			}
+		}
+
+		if seenBefore {
+
+			// Bump the count
+			seen++
+
+			// Unless the item has been updated.
+			if updates {
+				err = p.checkUpdate(logger, entry, feed, item, id, recipients)
+				if err != nil {
+					logger.Error("failed to check item for updates",
+						slog.String("link", item.Link),
+						slog.String("error", err.Error()))
+					return err
+				}
+			}
+			continue
+		}
+
+		// Bump the count
+		unseen++
+
+		// Show that we got something
+		logger.Debug("new entry found in feed",
+			slog.String("title", item.Title),
+			slog.String("link", item.Link))
+
+		// The record of what we did with this item, which we'll
+		// save in our state database.
+		rec := state.Record{
+			FirstSeen: time.Now(),
+			Status:    state.StatusSeen,
+			Title:     item.Title,
+			Link:      item.Link,
+		}
+
+		// Get the content of the feed-item.
 		//
-		// If so it's not new.
-		if p.seenItem(entry.URL, item.Link) {
-			isNew = false
+		// This has to be done ahead of sending email,
+		// as we can use this to skip entries via
+		// regular expression on the title/body contents.
+		content := ""
+		content, err = item.HTMLContent()
+		if err != nil {
+			content = item.RawContent()
+		}
+
+		// Convert the content to text.
+		text := html2text.HTML2Text(content)
+
+		// If we're notifying updates then record the text, so
+		// that we can see if it changes.
+		if updates {
+			rec.Hash = textHash(text)
+			rec.Text = text
 		}
 
 		// If this entry is new then we must notify, unless
 		// the entry is excluded for some reason.
-		if isNew {
+		//
+		// If we're supposed to send email then do that.
+		if p.send {
 
-			// Bump the count
-			unseen++
-
-			// Show that we got something
-			logger.Debug("new entry found in feed",
-				slog.String("title", item.Title),
-				slog.String("link", item.Link))
-
-			// If we're supposed to send email then do that.
-			if p.send {
-
-				// Get the content of the feed-item.
-				//
-				// This has to be done ahead of sending email,
-				// as we can use this to skip entries via
-				// regular expression on the title/body contents.
-				content := ""
-				content, err = item.HTMLContent()
-				if err != nil {
-					content = item.RawContent()
+			// Should we skip this entry?
+			//
+			// Skipping here means that we don't send an email,
+			// however we do mark it as read - so it will only
+			// be processed once.
+
+			// check for regular expressions
+			reason := p.skipReason(logger, entry, item.Title, content)
+
+			// check for age (exclude-older)
+			if reason == "" {
+				reason = p.skipOlderReason(logger, entry, item.Published)
+			}
+
+			if reason != "" {
+				rec.Status = state.StatusExcluded
+				rec.ExcludedBy = reason
+			} else {
+				// The item, as it appears in a digest.
+				di := emailer.DigestItem{
+					Feed:      feed.Link,
+					FeedTitle: feed.Title,
+					Link:      item.Link,
+					Subject:   item.Title,
+					Tag:       item.Tag,
+					Text:      text,
+					HTML:      content,
+					RSSFeed:   feed,
+					RSSItem:   item,
 				}
 
-				// Should we skip this entry?
-				//
-				// Skipping here means that we don't send an email,
-				// however we do mark it as read - so it will only
-				// be processed once.
+				if sched != nil {
+
+					// If we're sending a scheduled digest then
+					// we queue the item, and mark it as seen.
+					logger.Debug("adding entry to digest queue",
+						slog.String("link", item.Link))
+
+					err = p.enqueueItem(entry.URL, id, recipients, di)
+					if err != nil {
+
+						logger.Error("failed to queue item",
+							slog.String("error", err.Error()))
+
+						return err
+					}
 
-				// check for regular expressions
-				skip := p.shouldSkip(logger, entry, item.Title, content)
+					rec.Status = state.StatusQueued
+					rec.Recipients = recipients
+				} else if dig != nil {
 
-				// check for age (exclude-older)
-				skip = skip || p.shouldSkipOlder(logger, entry, item.Published)
+					// If we're sending a digest then we save
+					// the item, and record it once that is sent.
+					logger.Debug("adding entry to digest",
+						slog.String("link", item.Link))
 
-				if !skip {
-					// Convert the content to text.
-					text := html2text.HTML2Text(content)
+					dig.add(entry.URL, id, di, rec)
+					continue
+				} else {
 
 					// Send the mail
+					var failed []string
 					helper := emailer.New(feed, item, entry.Options, logger)
+					helper.SetSession(p.smtp)
 					err = helper.Sendmail(recipients, text, content)
 					if err != nil {
 
-						logger.Error("failed to send email",
-							slog.String("recipients", strings.Join(recipients, ",")),
-							slog.String("error", err.Error()))
+						// Save any failed messages to our
+						// outbox, so they can be retried.
+						failed, err = p.saveFailures(logger, entry.URL, []OutboxItem{{Feed: entry.URL, Key: id}}, err)
+						if err != nil {
 
-						return err
+							logger.Error("failed to send email",
+								slog.String("recipients", strings.Join(recipients, ",")),
+								slog.String("error", err.Error()))
+
+							return err
+						}
 					}
+
+					rec.SetDelivery(recipients, failed)
 				}
 			}
-		} else {
-
-			// Bump the count
-			seen++
-
 		}
 
 		// Mark the item as having been seen, after the email
-		// was (probably) sent.
-		//
-		// This does run the risk that sending mail fails,
-		// due to error, and that keeps happening forever...
-		err = p.recordItem(entry.URL, item.Link)
+		// was sent - or saved to our outbox for a later retry.
+		err = p.recordItem(entry.URL, id, rec)
 		if err != nil {
 			logger.Error("failed to mark item as processed",
 				slog.String("error", err.Error()))
@@ -447,8 +700,27 @@ func (p *Processor) processFeed(entry configfile.Feed, recipients []string) erro
 		slog.Int("seen_count", seen),
 		slog.Int("unseen_count", unseen))
 
+	// If we've got a per-feed digest then send it now.
+	if dig != nil && !p.digest {
+		err = p.sendDigest(logger, dig)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Find how long items must be missing before they're pruned.
+	g, err := feedGrace(entry.Options)
+	if err != nil {
+
+		logger.Warn("failed to parse 'prune-grace', using the default",
+			slog.String("default", DefaultPruneGrace),
+			slog.String("error", err.Error()))
+
+		g, _ = parseGrace(DefaultPruneGrace)
+	}
+
 	// Now prune the items in this feed.
-	err = p.pruneFeed(entry.URL, items)
+	err = p.pruneFeed(entry.URL, items, g)
 	if err != nil {
 
 		logger.Error("failed to prune bolddb",
@@ -488,18 +760,24 @@ func (p *Processor) seenItem(feed string, entry string) bool {
 	return val != ""
 }
 
-// recordItem marks an URL as having been seen.
+// recordItem marks an URL as having been seen, storing the given record
+// of what we did with it.
 //
 // It does this by updating the BoltDB in which we record state.
-func (p *Processor) recordItem(feed string, entry string) error {
+func (p *Processor) recordItem(feed string, entry string, rec state.Record) error {
 
-	err := p.dbHandle.Update(func(tx *bbolt.Tx) error {
+	data, err := rec.Marshal()
+	if err != nil {
+		return err
+	}
+
+	err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
 
 		// Select the feed-bucket
 		b := tx.Bucket([]byte(feed))
 
-		// Set a value "seen" to the key of the feed item link
-		err := b.Put([]byte(entry), []byte("seen"))
+		// Store the record with the key of the feed item link
+		err := b.Put([]byte(entry), data)
 		return err
 	})
 
@@ -515,15 +793,17 @@ func (p *Processor) recordItem(feed string, entry string) error {
 
 // pruneFeed will remove unknown items from our state database.
 //
-// Here we are given the URL of the feed, and a set of feed-item links,
-// we remove items which are no longer in the remote feed.
+// Here we look for items which are in the feed-bucket, but which were not
+// present in the most recent fetch of the feed.  Rather than removing these
+// immediately we record that they're missing, and only remove them once the
+// grace period has passed - feeds sometimes return a truncated list of items
+// and we don't want to email the missing items again when they reappear.
+//
+// Items which have reappeared have their missing-state reset.
 //
 // See also `pruneUnknownFeeds` for removing feeds which are no longer
 // fetched at all.
-func (p *Processor) pruneFeed(feed string, items []string) error {
-
-	// A list of items to remove
-	toRemove := []string{}
+func (p *Processor) pruneFeed(feed string, items []string, g grace) error {
 
 	// Create a map of the items we've already seen
 	seen := make(map[string]bool)
@@ -531,64 +811,85 @@ func (p *Processor) pruneFeed(feed string, items []string) error {
 		seen[str] = true
 	}
 
-	// Select the bucket, which we know will exist,
-	// and see if we should remove any of the keys
-	// that are present.
-	//
-	// (i.e. Remove the ones that are not in the map above)
-	err := p.dbHandle.View(func(tx *bbolt.Tx) error {
+	now := time.Now()
+
+	err := p.dbHandle.Update(func(tx *bbolt.Tx) error {
+
+		// Items to remove, and records to update.
+		toRemove := [][]byte{}
+		toUpdate := make(map[string]state.Record)
 
 		// Select the bucket, which we know must exist
 		b := tx.Bucket([]byte(feed))
 
-		// Get a cursor to the key=value entries in the bucket
-		c := b.Cursor()
-
 		// Iterate over the key/value pairs.
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		err := b.ForEach(func(k []byte, v []byte) error {
 
-			// Convert the key to a string
-			key := string(k)
+			rec, err := state.ParseRecord(v)
+			if err != nil {
+				return fmt.Errorf("failed to read state of %s - %s", k, err)
+			}
 
 			// Is this in our list of seen entries?
-			_, ok := seen[key]
-			if !ok {
-				// If not remove the key/value pair
-				toRemove = append(toRemove, key)
+			if seen[string(k)] {
+
+				// If it was missing it has now reappeared.
+				if rec.Misses > 0 || !rec.MissingSince.IsZero() {
+					rec.Misses = 0
+					rec.MissingSince = time.Time{}
+					toUpdate[string(k)] = rec
+				}
+				return nil
+			}
+
+			if g.expired(&rec, now) {
+				toRemove = append(toRemove, append([]byte{}, k...))
+			} else {
+				toUpdate[string(k)] = rec
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		return nil
-	})
 
-	if err != nil {
+		// Remove each entry that we were supposed to remove.
+		for _, k := range toRemove {
 
-		p.logger.Error("error getting all bucket keys",
-			slog.String("error", err.Error()))
-		return err
-	}
+			p.logger.Debug("removing item from state database",
+				slog.String("feed", feed),
+				slog.String("entry", string(k)))
 
-	// Remove each entry that we were supposed to remove.
-	for _, ent := range toRemove {
+			err = b.Delete(k)
+			if err != nil {
+				return fmt.Errorf("failed to remove %s - %s", k, err)
+			}
+		}
 
-		err := p.dbHandle.Update(func(tx *bbolt.Tx) error {
+		// Update the state of the rest.
+		for k, rec := range toUpdate {
 
-			// Select the bucket
-			b := tx.Bucket([]byte(feed))
+			data, err := rec.Marshal()
+			if err != nil {
+				return err
+			}
 
-			// Delete the key=value pair.
-			return b.Delete([]byte(ent))
-		})
-		if err != nil {
+			err = b.Put([]byte(k), data)
+			if err != nil {
+				return fmt.Errorf("failed to update %s - %s", k, err)
+			}
+		}
 
-			p.logger.Error("error deleting key from bucket",
-				slog.String("entry", ent),
-				slog.String("error", err.Error()))
+		return nil
+	})
 
-			return fmt.Errorf("failed to remove %s - %s", ent, err)
-		}
+	if err != nil {
+		p.logger.Error("error pruning items from feed",
+			slog.String("feed", feed),
+			slog.String("error", err.Error()))
 	}
 
-	return nil
+	return err
 }
 
 // pruneUnknownFeeds removes feeds from our database which are no longer
@@ -598,7 +899,8 @@ func (p *Processor) pruneFeed(feed string, items []string) error {
 // pairs.  We create a bucket for every feed which is present in our
 // configuration value, then use the URL of feed-items as the keys.
 //
-// Here we remove buckets which are obsolete.
+// Here we remove buckets which are obsolete, along with any items which
+// are queued for a scheduled digest from those feeds.
 func (p *Processor) pruneUnknownFeeds(feeds []string) error {
 
 	// Create a map for lookup
@@ -610,10 +912,32 @@ func (p *Processor) pruneUnknownFeeds(feeds []string) error {
 	// Now walk the database and see which buckets should be removed.
 	toRemove := []string{}
 
+	// Similarly the queues which should be removed.
+	queued := []string{}
+
 	err := p.dbHandle.View(func(tx *bbolt.Tx) error {
 
+		// Remove the queued items of unknown feeds.
+		q := tx.Bucket([]byte(state.QueueBucket))
+		if q != nil {
+			err := q.ForEach(func(bucketName []byte, _ []byte) error {
+				if !seen[string(bucketName)] {
+					queued = append(queued, string(bucketName))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
 		return tx.ForEach(func(bucketName []byte, _ *bbolt.Bucket) error {
 
+			// Skip our own buckets.
+			if state.IsInternalBucket(string(bucketName)) {
+				return nil
+			}
+
 			// Does this name exist in our map?
 			_, ok := seen[string(bucketName)]
 
@@ -673,10 +997,30 @@ func (p *Processor) pruneUnknownFeeds(feeds []string) error {
 		}
 	}
 
+	// Remove the queues too.
+	for _, bucket := range queued {
+
+		err := p.dbHandle.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket([]byte(state.QueueBucket)).DeleteBucket([]byte(bucket))
+		})
+		if err != nil {
+			p.logger.Error("error removing queue",
+				slog.String("bucket", bucket),
+				slog.String("error", err.Error()))
+			return fmt.Errorf("error removing queue %s: %s", bucket, err)
+		}
+	}
+
 	return nil
 }
 
 // shouldSkip returns true if this entry should be skipped/ignored.
+func (p *Processor) shouldSkip(logger *slog.Logger, config configfile.Feed, title string, content string) bool {
+	return p.skipReason(logger, config, title, content) != ""
+}
+
+// skipReason returns the rule by which this entry should be skipped/ignored,
+// or the empty string if it should not be skipped.
 //
 // Our configuration file allows a series of per-feed configuration items,
 // and those allow skipping the entry by regular expression matches on
@@ -687,7 +1031,7 @@ func (p *Processor) pruneUnknownFeeds(feeds []string) error {
 //
 // Note that if an entry should be skipped it is still marked as
 // having been read, but no email is sent.
-func (p *Processor) shouldSkip(logger *slog.Logger, config configfile.Feed, title string, content string) bool {
+func (p *Processor) skipReason(logger *slog.Logger, config configfile.Feed, title string, content string) string {
 
 	// Walk over the options to see if there are any exclude* options
 	// specified.
@@ -700,8 +1044,8 @@ func (p *Processor) shouldSkip(logger *slog.Logger, config configfile.Feed, titl
 				logger.Debug("excluding entry due to exclude-title",
 					slog.String("exclude-title", opt.Value),
 					slog.String("item-title", title))
-				// True: skip/ignore this entry
-				return true
+				// Skip/ignore this entry
+				return "exclude-title: " + opt.Value
 			}
 		}
 
@@ -714,8 +1058,8 @@ func (p *Processor) shouldSkip(logger *slog.Logger, config configfile.Feed, titl
 					slog.String("exclude", opt.Value),
 					slog.String("item-title", title))
 
-				// True: skip/ignore this entry
-				return true
+				// Skip/ignore this entry
+				return "exclude: " + opt.Value
 			}
 		}
 	}
@@ -748,8 +1092,8 @@ func (p *Processor) shouldSkip(logger *slog.Logger, config configfile.Feed, titl
 					slog.String("include-title", opt.Value),
 					slog.String("item-title", title))
 
-				// False: Do not skip/ignore this entry
-				return false
+				// Do not skip/ignore this entry
+				return ""
 			}
 		}
 		if opt.Name == "include" {
@@ -768,8 +1112,8 @@ func (p *Processor) shouldSkip(logger *slog.Logger, config configfile.Feed, titl
 					slog.String("include", opt.Value),
 					slog.String("item-title", title))
 
-				// False: Do not skip/ignore this entry
-				return false
+				// Do not skip/ignore this entry
+				return ""
 			}
 		}
 	}
@@ -784,18 +1128,27 @@ func (p *Processor) shouldSkip(logger *slog.Logger, config configfile.Feed, titl
 			slog.String("include-title", it),
 			slog.String("item-title", title))
 
-		// True: skip/ignore this entry
-		return true
+		// Skip/ignore this entry
+		if i != "" {
+			return "include: " + i
+		}
+		return "include-title: " + it
 	}
 
-	// False: Do not skip/ignore this entry
-	return false
+	// Do not skip/ignore this entry
+	return ""
 }
 
 // shouldSkipOlder returns true if this entry should be skipped due to age.
 //
 // Age is configured with "exclude-older" in days.
 func (p *Processor) shouldSkipOlder(logger *slog.Logger, config configfile.Feed, published string) bool {
+	return p.skipOlderReason(logger, config, published) != ""
+}
+
+// skipOlderReason returns the rule by which this entry should be skipped
+// due to age, or the empty string if it should not be skipped.
+func (p *Processor) skipOlderReason(logger *slog.Logger, config configfile.Feed, published string) string {
 
 	// Walk over the options to see if there are any exclude-age options
 	// specified.
@@ -807,7 +1160,7 @@ func (p *Processor) shouldSkipOlder(logger *slog.Logger, config configfile.Feed,
 				logger.Warn("failed to parse 'item.published' as date",
 					slog.String("date", published),
 					slog.String("error", err.Error()))
-				return false
+				return ""
 			}
 			f, err := strconv.ParseFloat(opt.Value, 32)
 			if err != nil {
@@ -815,7 +1168,7 @@ func (p *Processor) shouldSkipOlder(logger *slog.Logger, config configfile.Feed,
 					slog.String("exclude-older", opt.Value),
 					slog.String("error", err.Error()))
 
-				return false
+				return ""
 			}
 
 			delta := time.Second * time.Duration(f*24*60*60)
@@ -823,13 +1176,13 @@ func (p *Processor) shouldSkipOlder(logger *slog.Logger, config configfile.Feed,
 				logger.Debug("excluding entry due to exclude-older setting",
 					slog.String("exclude-older", opt.Value),
 					slog.Float64("days", time.Since(pubTime).Hours()/24))
-				return true
+				return "exclude-older: " + opt.Value
 			}
 		}
 	}
 
-	// False: Do not skip/ignore this entry
-	return false
+	// Do not skip/ignore this entry
+	return ""
 }
 
 // SetSendEmail updates the state of this object, when the send-flag
@@ -838,9 +1191,24 @@ func (p *Processor) SetSendEmail(state bool) {
 	p.send = state
 }
 
+// SetDigest updates the state of this object, when the digest-flag is
+// true we'll send a single email for all the new items found in a run.
+func (p *Processor) SetDigest(state bool) {
+	p.digest = state
+}
+
+// SetWorkers updates the number of feeds which will be fetched
+// concurrently, values less than one are ignored.
+func (p *Processor) SetWorkers(workers int) {
+	if workers > 0 {
+		p.workers = workers
+	}
+}
+
 // SetLogger ensures we have a logging-handle
 func (p *Processor) SetLogger(logger *slog.Logger) {
 	p.logger = logger
+	p.smtp.SetLogger(logger)
 }
 
 // SetVersion ensures we can pass the version of our client to our HTTP-fetcher,
@@ -88,6 +88,12 @@ func TestSkipExclude(t *testing.T) {
 		t.Fatalf("failed to skip entry by title")
 	}
 
+	// The rule which excluded the entry is recorded.
+	reason := x.skipReason(logger, feed, "test", "<p>This matches the title</p>")
+	if reason != "exclude-title: test" {
+		t.Fatalf("unexpected reason for skipping entry '%s'", reason)
+	}
+
 	// With no options we're not going to skip
 	feed = configfile.Feed{
 		URL:     "blah",
@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/settings"
+	"github.com/skx/rss2email/state"
+)
+
+// DefaultPruneGrace is the default period for which an item must be
+// missing from its feed before we forget about it.
+//
+// This may be changed globally via the PRUNE_GRACE environmental variable,
+// or per-feed via the "prune-grace" option.
+const DefaultPruneGrace = "24h"
+
+// grace describes how long an item must be missing from a feed before it
+// is removed from our state database.
+//
+// Feeds sometimes return a truncated list of items, and if we forgot about
+// the missing items immediately they'd be regarded as new, and emailed
+// again, when they reappeared.
+type grace struct {
+
+	// fetches is the number of consecutive fetches from which the item
+	// must be missing.
+	fetches int
+
+	// period is the length of time for which the item must be missing.
+	period time.Duration
+}
+
+// parseGrace parses a grace period, which is either a number of fetches,
+// such as "3", or a length of time such as "12h" or "7d".
+//
+// A value of "0" disables the grace period entirely.
+func parseGrace(value string) (grace, error) {
+
+	g, err := configfile.ParseGrace(value)
+	if err != nil {
+		return grace{}, err
+	}
+	return grace{fetches: g.Fetches, period: g.Period}, nil
+}
+
+// feedGrace returns the grace period for the given feed, taking into
+// account the global default and any per-feed option.
+func feedGrace(opts []configfile.Option) (grace, error) {
+
+	value := DefaultPruneGrace
+	if env := settings.Get("PRUNE_GRACE"); env != "" {
+		value = env
+	}
+
+	for _, opt := range opts {
+		if opt.Name == "prune-grace" {
+			value = opt.Value
+		}
+	}
+
+	return parseGrace(value)
+}
+
+// expired updates the record of an item which was missing from the most
+// recent fetch of its feed, and returns true if the grace period has
+// passed and the item should be removed.
+func (g grace) expired(rec *state.Record, now time.Time) bool {
+
+	if rec.MissingSince.IsZero() {
+		rec.MissingSince = now
+	}
+	rec.Misses++
+
+	if g.fetches > 0 {
+		return rec.Misses >= g.fetches
+	}
+
+	return now.Sub(rec.MissingSince) >= g.period
+}
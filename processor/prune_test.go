@@ -0,0 +1,133 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/state"
+	"go.etcd.io/bbolt"
+)
+
+// TestParseGrace tests parsing grace periods.
+func TestParseGrace(t *testing.T) {
+
+	valid := map[string]grace{
+		"0":   {},
+		"3":   {fetches: 3},
+		"12h": {period: 12 * time.Hour},
+		"2d":  {period: 48 * time.Hour},
+		"90m": {period: 90 * time.Minute},
+	}
+
+	for input, expected := range valid {
+		g, err := parseGrace(input)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s: %s", input, err)
+		}
+		if g != expected {
+			t.Fatalf("parsed %s wrongly, got %v", input, g)
+		}
+	}
+
+	for _, input := range []string{"", "-1", "bogus", "xd", "-2h"} {
+		_, err := parseGrace(input)
+		if err == nil {
+			t.Fatalf("expected error parsing %s", input)
+		}
+	}
+}
+
+// TestFeedGrace tests the per-feed option overrides the default.
+func TestFeedGrace(t *testing.T) {
+
+	t.Setenv("PRUNE_GRACE", "")
+
+	g, err := feedGrace(nil)
+	if err != nil || g.period != 24*time.Hour {
+		t.Fatalf("unexpected default grace %v %v", g, err)
+	}
+
+	t.Setenv("PRUNE_GRACE", "5")
+	g, err = feedGrace(nil)
+	if err != nil || g.fetches != 5 {
+		t.Fatalf("environment didn't change grace %v %v", g, err)
+	}
+
+	g, err = feedGrace([]configfile.Option{{Name: "prune-grace", Value: "1h"}})
+	if err != nil || g.period != time.Hour || g.fetches != 0 {
+		t.Fatalf("option didn't change grace %v %v", g, err)
+	}
+}
+
+// TestPruneFeed ensures items are only removed once the grace period
+// has passed, and that reappearing items are kept.
+func TestPruneFeed(t *testing.T) {
+
+	// Use a temporary state-directory
+	t.Setenv("HOME", t.TempDir())
+
+	p, err := New()
+	if err != nil {
+		t.Fatalf("error creating processor %s", err.Error())
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	feed := "https://example.com/"
+	err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(feed))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create bucket %s", err)
+	}
+
+	for _, link := range []string{"one", "two", "three"} {
+		err = p.recordItem(feed, link, state.Record{Status: state.StatusSeen})
+		if err != nil {
+			t.Fatalf("failed to record item %s", err)
+		}
+	}
+
+	// Items must be missing from two fetches.
+	g := grace{fetches: 2}
+
+	// "two" and "three" are missing.
+	err = p.pruneFeed(feed, []string{"one"}, g)
+	if err != nil {
+		t.Fatalf("unexpected error pruning %s", err)
+	}
+	for _, link := range []string{"one", "two", "three"} {
+		if !p.seenItem(feed, link) {
+			t.Fatalf("%s was pruned too soon", link)
+		}
+	}
+
+	// "two" reappears, "three" is still missing.
+	err = p.pruneFeed(feed, []string{"one", "two"}, g)
+	if err != nil {
+		t.Fatalf("unexpected error pruning %s", err)
+	}
+	if p.seenItem(feed, "three") {
+		t.Fatalf("three should have been pruned")
+	}
+
+	// "two" goes missing again, but its count was reset.
+	err = p.pruneFeed(feed, []string{"one"}, g)
+	if err != nil {
+		t.Fatalf("unexpected error pruning %s", err)
+	}
+	if !p.seenItem(feed, "two") {
+		t.Fatalf("two was pruned too soon")
+	}
+
+	// Without a grace period items are removed immediately.
+	err = p.pruneFeed(feed, []string{"two"}, grace{})
+	if err != nil {
+		t.Fatalf("unexpected error pruning %s", err)
+	}
+	if p.seenItem(feed, "one") {
+		t.Fatalf("one should have been pruned")
+	}
+}
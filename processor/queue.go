@@ -0,0 +1,342 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/processor/emailer"
+	"github.com/skx/rss2email/state"
+	"go.etcd.io/bbolt"
+)
+
+// QueuedItem is an item which is waiting to be sent in a scheduled digest.
+//
+// These are stored, JSON-encoded, in the queue bucket of our database.
+type QueuedItem struct {
+
+	// Queued is the time at which the item was added to the queue.
+	Queued time.Time `json:"queued"`
+
+	// Recipients holds the addresses to which the item should be sent.
+	Recipients []string `json:"recipients"`
+
+	// Item contains the item itself.
+	Item emailer.DigestItem `json:"item"`
+
+	// ID is the identity of the item, the key under which its state
+	// is recorded.  Items queued by older releases don't have this,
+	// and were recorded under their link.
+	ID string `json:"id,omitempty"`
+
+	// key is the key of the item within the queue bucket.
+	key []byte
+}
+
+// QueuedFeed holds the items queued for a single feed.
+type QueuedFeed struct {
+
+	// URL is the URL of the feed, as it appears in the configuration file.
+	URL string
+
+	// Items holds the queued items, oldest first.
+	Items []QueuedItem
+}
+
+// enqueueItem adds an item to the queue of the given feed.
+func (p *Processor) enqueueItem(feed string, id string, recipients []string, item emailer.DigestItem) error {
+
+	data, err := json.Marshal(QueuedItem{
+		Queued:     time.Now(),
+		Recipients: recipients,
+		Item:       item,
+		ID:         id,
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.dbHandle.Update(func(tx *bbolt.Tx) error {
+
+		q, err := tx.CreateBucketIfNotExists([]byte(state.QueueBucket))
+		if err != nil {
+			return err
+		}
+
+		b, err := q.CreateBucketIfNotExists([]byte(feed))
+		if err != nil {
+			return err
+		}
+
+		// Use a sequence number as the key, so that the items
+		// are kept in the order in which they were added.
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(fmt.Sprintf("%020d", seq)), data)
+	})
+}
+
+// Queue returns the items which are queued for scheduled digests.
+func (p *Processor) Queue() ([]QueuedFeed, error) {
+
+	var feeds []QueuedFeed
+
+	err := p.dbHandle.View(func(tx *bbolt.Tx) error {
+
+		q := tx.Bucket([]byte(state.QueueBucket))
+		if q == nil {
+			return nil
+		}
+
+		return q.ForEach(func(name []byte, _ []byte) error {
+
+			feed := QueuedFeed{URL: string(name)}
+
+			err := q.Bucket(name).ForEach(func(k []byte, v []byte) error {
+
+				var item QueuedItem
+				err := json.Unmarshal(v, &item)
+				if err != nil {
+					return fmt.Errorf("failed to decode queued item %s in %s: %s", k, name, err)
+				}
+
+				item.key = append([]byte{}, k...)
+				feed.Items = append(feed.Items, item)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(feed.Items) > 0 {
+				feeds = append(feeds, feed)
+			}
+			return nil
+		})
+	})
+
+	return feeds, err
+}
+
+// sendQueue sends the items queued for the given feed as digests, one
+// for each distinct set of recipients, and then removes them from the
+// queue.
+func (p *Processor) sendQueue(feed QueuedFeed, opts []configfile.Option) error {
+
+	logger := p.logger.With(
+		slog.Group("feed",
+			slog.String("link", feed.URL)))
+
+	// Group the items by their recipients.
+	var order []string
+	digests := make(map[string]*digest)
+	keys := make(map[string][][]byte)
+
+	for _, item := range feed.Items {
+
+		key := strings.Join(item.Recipients, ",")
+
+		d, ok := digests[key]
+		if !ok {
+			d = &digest{recipients: item.Recipients, opts: opts}
+			digests[key] = d
+			order = append(order, key)
+		}
+
+		id := item.ID
+		if id == "" {
+			id = item.Item.Link
+		}
+
+		// The records of queued items are already stored, and
+		// are updated once the digest has been sent.
+		d.add(feed.URL, id, item.Item, state.Record{})
+		keys[key] = append(keys[key], item.key)
+	}
+
+	for _, key := range order {
+
+		d := digests[key]
+
+		logger.Debug("sending scheduled digest",
+			slog.String("recipients", key),
+			slog.Int("items", len(d.items)))
+
+		var failed []string
+
+		helper := emailer.NewDigest(d.items, d.opts, logger)
+		helper.SetSession(p.smtp)
+		err := helper.SendDigest(d.recipients)
+		if err != nil {
+
+			// Save any failed messages to our outbox, so they
+			// can be retried.
+			failed, err = p.saveFailures(logger, feed.URL, d.outboxItems(), err)
+			if err != nil {
+
+				logger.Error("failed to send scheduled digest",
+					slog.String("recipients", key),
+					slog.String("error", err.Error()))
+
+				return err
+			}
+		}
+
+		// Remove the items which were sent, and update the
+		// records of them.
+		err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
+
+			b := tx.Bucket([]byte(state.QueueBucket)).Bucket([]byte(feed.URL))
+			for _, k := range keys[key] {
+				err := b.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+
+			return updateDelivery(tx, feed.URL, d, failed)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove sent items from the queue: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// updateDelivery updates the records of the given items, which were queued,
+// to show that they've now been sent.
+func updateDelivery(tx *bbolt.Tx, feed string, d *digest, failed []string) error {
+
+	// The feed might have been removed since the items were queued.
+	b := tx.Bucket([]byte(feed))
+	if b == nil {
+		return nil
+	}
+
+	for i, item := range d.items {
+
+		rec := state.Record{Title: item.Subject, Link: item.Link}
+
+		data := b.Get([]byte(d.ids[i]))
+		if data != nil {
+			var err error
+			rec, err = state.ParseRecord(data)
+			if err != nil {
+				return err
+			}
+		}
+
+		rec.SetDelivery(d.recipients, failed)
+
+		data, err := rec.Marshal()
+		if err != nil {
+			return err
+		}
+
+		err = b.Put([]byte(d.ids[i]), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendScheduledDigests sends the queued items of each feed for which the
+// digest schedule has come around.
+func (p *Processor) sendScheduledDigests(entries []configfile.Feed) []error {
+
+	var errors []error
+
+	queue, err := p.Queue()
+	if err != nil {
+		return append(errors, err)
+	}
+
+	// Find the options for each feed.
+	options := make(map[string][]configfile.Option)
+	for _, entry := range entries {
+		options[entry.URL] = entry.Options
+	}
+
+	now := time.Now()
+
+	for _, feed := range queue {
+
+		// If the schedule is invalid we send the items now, rather
+		// than leaving them queued until it is fixed.
+		sched, err := feedSchedule(options[feed.URL])
+		if err != nil {
+			p.logger.Warn("invalid digest-schedule, sending the queued items now",
+				slog.String("feed", feed.URL),
+				slog.String("error", err.Error()))
+		}
+
+		// If the feed no longer has a schedule then we send
+		// the items immediately.
+		if sched != nil && !sched.due(feed.Items[0].Queued, now) {
+			p.logger.Debug("scheduled digest not yet due",
+				slog.String("feed", feed.URL),
+				slog.Int("items", len(feed.Items)),
+				slog.Time("due", sched.next(feed.Items[0].Queued)))
+			continue
+		}
+
+		err = p.sendQueue(feed, options[feed.URL])
+		if err != nil {
+			errors = append(errors, fmt.Errorf("error sending digest for %s - %s", feed.URL, err))
+		}
+	}
+
+	return errors
+}
+
+// FlushQueue sends all the items which are queued for scheduled digests
+// immediately, regardless of their schedule.
+func (p *Processor) FlushQueue() []error {
+
+	var errors []error
+
+	queue, err := p.Queue()
+	if err != nil {
+		return append(errors, err)
+	}
+
+	// The per-feed options, which might change the template.
+	options := make(map[string][]configfile.Option)
+
+	entries, err := configfile.New().Parse()
+	if err == nil {
+		for _, entry := range entries {
+			options[entry.URL] = entry.Options
+		}
+	}
+
+	for _, feed := range queue {
+		err = p.sendQueue(feed, options[feed.URL])
+		if err != nil {
+			errors = append(errors, fmt.Errorf("error sending digest for %s - %s", feed.URL, err))
+		}
+	}
+
+	return errors
+}
+
+// NextDigest returns the time at which the digest for the given queued
+// feed is due to be sent, and false if the feed has no valid schedule.
+func NextDigest(feed QueuedFeed, opts []configfile.Option) (time.Time, bool) {
+
+	sched, err := feedSchedule(opts)
+	if err != nil || sched == nil || len(feed.Items) == 0 {
+		return time.Time{}, false
+	}
+
+	return sched.next(feed.Items[0].Queued), true
+}
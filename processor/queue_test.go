@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/skx/rss2email/processor/emailer"
+)
+
+// TestQueue ensures that items can be queued, and read back in order.
+func TestQueue(t *testing.T) {
+
+	// Use a temporary state-directory
+	t.Setenv("HOME", t.TempDir())
+
+	p, err := New()
+	if err != nil {
+		t.Fatalf("error creating processor %s", err.Error())
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	queue, err := p.Queue()
+	if err != nil {
+		t.Fatalf("unexpected error reading queue: %s", err)
+	}
+	if len(queue) != 0 {
+		t.Fatalf("expected empty queue, got %d feeds", len(queue))
+	}
+
+	for _, title := range []string{"one", "two", "three"} {
+		err = p.enqueueItem("https://example.com/", title, []string{"bob@example.com"}, emailer.DigestItem{Subject: title})
+		if err != nil {
+			t.Fatalf("unexpected error queueing item: %s", err)
+		}
+	}
+
+	queue, err = p.Queue()
+	if err != nil {
+		t.Fatalf("unexpected error reading queue: %s", err)
+	}
+	if len(queue) != 1 {
+		t.Fatalf("expected one feed in the queue, got %d", len(queue))
+	}
+	if len(queue[0].Items) != 3 {
+		t.Fatalf("expected three queued items, got %d", len(queue[0].Items))
+	}
+	if queue[0].Items[0].Item.Subject != "one" || queue[0].Items[2].Item.Subject != "three" {
+		t.Fatalf("queued items are not in order")
+	}
+
+	// Removing the feed should remove the queue too.
+	err = p.pruneUnknownFeeds([]string{})
+	if err != nil {
+		t.Fatalf("unexpected error pruning: %s", err)
+	}
+
+	queue, err = p.Queue()
+	if err != nil {
+		t.Fatalf("unexpected error reading queue: %s", err)
+	}
+	if len(queue) != 0 {
+		t.Fatalf("expected empty queue after pruning, got %d feeds", len(queue))
+	}
+}
@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// schedule describes when a scheduled digest should be sent, it is
+// configured via the per-feed "digest-schedule" option.
+//
+// The supported forms are:
+//
+//	daily            - Every day, at midnight.
+//	daily@08:00      - Every day, at the given time.
+//	weekly@mon       - Every week, on the given day at midnight.
+//	weekly@mon@08:00 - Every week, on the given day and time.
+//
+// Times are interpreted in the local timezone.
+type schedule struct {
+
+	// weekly is true if this schedule runs once a week.
+	weekly bool
+
+	// day is the day of the week, for weekly schedules.
+	day time.Weekday
+
+	// hour and minute of the day at which we run.
+	hour   int
+	minute int
+}
+
+// parseSchedule parses the value of a "digest-schedule" option.
+func parseSchedule(value string) (*schedule, error) {
+
+	spec, err := configfile.ParseSchedule(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule{
+		weekly: spec.Weekly,
+		day:    spec.Day,
+		hour:   spec.Hour,
+		minute: spec.Minute,
+	}, nil
+}
+
+// previous returns the most recent time, at or before the given time,
+// at which this schedule was due to run.
+func (s *schedule) previous(now time.Time) time.Time {
+
+	t := time.Date(now.Year(), now.Month(), now.Day(), s.hour, s.minute, 0, 0, now.Location())
+
+	// Step backwards until we're not in the future, and on the right day.
+	for t.After(now) || (s.weekly && t.Weekday() != s.day) {
+		t = t.AddDate(0, 0, -1)
+	}
+
+	return t
+}
+
+// next returns the first time, after the given time, at which this
+// schedule is due to run.
+func (s *schedule) next(after time.Time) time.Time {
+
+	t := time.Date(after.Year(), after.Month(), after.Day(), s.hour, s.minute, 0, 0, after.Location())
+
+	// Step forwards until we're in the future, and on the right day.
+	for !t.After(after) || (s.weekly && t.Weekday() != s.day) {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t
+}
+
+// due returns true if items which were queued at the given time should
+// be sent, because the schedule has run since then.
+func (s *schedule) due(queued time.Time, now time.Time) bool {
+	return queued.Before(s.previous(now))
+}
+
+// feedSchedule returns the digest schedule of the given feed, if any.
+func feedSchedule(opts []configfile.Option) (*schedule, error) {
+	for _, opt := range opts {
+		if opt.Name == "digest-schedule" {
+			return parseSchedule(opt.Value)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseSchedule ensures we can parse valid schedules, and reject bogus ones.
+func TestParseSchedule(t *testing.T) {
+
+	valid := []string{"daily", "daily@08:00", "weekly@mon", "weekly@Friday@17:30", " DAILY@23:59 "}
+	for _, str := range valid {
+		_, err := parseSchedule(str)
+		if err != nil {
+			t.Fatalf("unexpected error parsing '%s': %s", str, err)
+		}
+	}
+
+	bogus := []string{"", "hourly", "daily@25:00", "daily@08:00@mon", "weekly", "weekly@funday", "weekly@mon@8am", "daily@", "weekly@mon@"}
+	for _, str := range bogus {
+		_, err := parseSchedule(str)
+		if err == nil {
+			t.Fatalf("expected error parsing '%s', got none", str)
+		}
+	}
+}
+
+// TestScheduleDaily tests the previous/next times of a daily schedule.
+func TestScheduleDaily(t *testing.T) {
+
+	s, err := parseSchedule("daily@08:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	prev := s.previous(now)
+	if !prev.Equal(time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected previous time %s", prev)
+	}
+
+	next := s.next(now)
+	if !next.Equal(time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next time %s", next)
+	}
+
+	// Queued before the schedule ran: due
+	if !s.due(time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC), now) {
+		t.Fatalf("expected queued item to be due")
+	}
+
+	// Queued after the schedule ran: not due
+	if s.due(time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC), now) {
+		t.Fatalf("expected queued item not to be due")
+	}
+}
+
+// TestScheduleWeekly tests the previous/next times of a weekly schedule.
+func TestScheduleWeekly(t *testing.T) {
+
+	s, err := parseSchedule("weekly@mon@09:30")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// A Sunday.
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	prev := s.previous(now)
+	if !prev.Equal(time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected previous time %s", prev)
+	}
+
+	next := s.next(now)
+	if !next.Equal(time.Date(2024, 3, 11, 9, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next time %s", next)
+	}
+
+	if s.due(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), now) {
+		t.Fatalf("expected queued item not to be due")
+	}
+	if !s.due(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), now) {
+		t.Fatalf("expected queued item to be due")
+	}
+}
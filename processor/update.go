@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/k3a/html2text"
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/processor/emailer"
+	"github.com/skx/rss2email/state"
+	"github.com/skx/rss2email/withstate"
+	"go.etcd.io/bbolt"
+)
+
+// notifyUpdates returns true if we should send an email when an item in
+// the given feed is updated, after we first saw it.
+func notifyUpdates(entry configfile.Feed) bool {
+	for _, opt := range entry.Options {
+		if opt.Name == "notify-updates" {
+			val := strings.ToLower(opt.Value)
+			if val == "yes" || val == "true" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// textHash returns the hash of the given text, used to detect updates.
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// itemRecord returns the record of the given item in the given feed.
+func (p *Processor) itemRecord(feed string, key string) (state.Record, error) {
+
+	var rec state.Record
+
+	err := p.dbHandle.View(func(tx *bbolt.Tx) error {
+
+		var err error
+		rec, err = state.ParseRecord(tx.Bucket([]byte(feed)).Get([]byte(key)))
+		return err
+	})
+
+	return rec, err
+}
+
+// checkUpdate looks to see whether an item we've already seen has been
+// updated, by comparing the hash of its text with the one we recorded.
+//
+// If it has changed then we send an email containing the changes, unless
+// the item is excluded.  The first time we see an item after the option
+// is enabled we only record its hash.
+func (p *Processor) checkUpdate(logger *slog.Logger, entry configfile.Feed, feed *gofeed.Feed, item withstate.FeedItem, key string, recipients []string) error {
+
+	rec, err := p.itemRecord(entry.URL, key)
+	if err != nil {
+		return err
+	}
+
+	content, err := item.HTMLContent()
+	if err != nil {
+		content = item.RawContent()
+	}
+	text := html2text.HTML2Text(content)
+
+	hash := textHash(text)
+	if rec.Hash == hash {
+		return nil
+	}
+
+	if rec.Hash != "" && p.send {
+
+		reason := p.skipReason(logger, entry, item.Title, content)
+		if reason == "" {
+
+			logger.Debug("updated entry found in feed",
+				slog.String("title", item.Title),
+				slog.String("link", item.Link))
+
+			helper := emailer.New(feed, item, entry.Options, logger)
+			helper.SetDiff(textDiff(rec.Text, text))
+			helper.SetSession(p.smtp)
+
+			err = helper.Sendmail(recipients, text, content)
+			if err != nil {
+
+				// Save any failed messages to our outbox, so
+				// they can be retried.  The record of the item
+				// doesn't track the delivery of updates.
+				_, err = p.saveFailures(logger, entry.URL, nil, err)
+				if err != nil {
+
+					logger.Error("failed to send email",
+						slog.String("recipients", strings.Join(recipients, ",")),
+						slog.String("error", err.Error()))
+
+					return err
+				}
+			}
+
+			rec.Updates++
+			rec.Updated = time.Now()
+		}
+	}
+
+	rec.Title = item.Title
+	rec.Hash = hash
+	rec.Text = text
+
+	return p.recordItem(entry.URL, key, rec)
+}
@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/state"
+	"github.com/skx/rss2email/withstate"
+	"go.etcd.io/bbolt"
+)
+
+// TestCheckUpdate ensures updated items generate an email.
+func TestCheckUpdate(t *testing.T) {
+
+	// Use a temporary state-directory
+	t.Setenv("HOME", t.TempDir())
+
+	// Ensure delivery fails, so the message ends up in our outbox
+	// rather than being sent.
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", "1")
+	t.Setenv("SMTP_USERNAME", "user")
+	t.Setenv("SMTP_PASSWORD", "pass")
+
+	p, err := New()
+	if err != nil {
+		t.Fatalf("error creating processor %s", err.Error())
+	}
+	defer p.Close()
+	p.SetLogger(logger)
+
+	entry := configfile.Feed{
+		URL:     "https://example.com/feed",
+		Options: []configfile.Option{{Name: "notify-updates", Value: "yes"}},
+	}
+	if !notifyUpdates(entry) {
+		t.Fatalf("expected updates to be enabled")
+	}
+
+	err = p.dbHandle.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(entry.URL))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create bucket %s", err)
+	}
+
+	// An item seen before the option was enabled.
+	err = p.recordItem(entry.URL, "https://example.com/one", state.Record{Status: state.StatusEmailed})
+	if err != nil {
+		t.Fatalf("failed to record item %s", err)
+	}
+
+	feed := &gofeed.Feed{Link: "https://example.com/", Title: "Example"}
+	item := withstate.FeedItem{Item: &gofeed.Item{
+		Link:    "https://example.com/one",
+		Title:   "Advisory",
+		Content: "<p>Version 1.0 is affected.</p>",
+	}}
+	recipients := []string{"bob@example.com"}
+
+	// The first time we only record the hash.
+	err = p.checkUpdate(logger, entry, feed, item, item.Link, recipients)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	rec, err := p.itemRecord(entry.URL, item.Link)
+	if err != nil || rec.Hash == "" || rec.Updates != 0 {
+		t.Fatalf("unexpected record %v %v", rec, err)
+	}
+
+	// Unchanged content does nothing.
+	err = p.checkUpdate(logger, entry, feed, item, item.Link, recipients)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	outbox, _ := p.Outbox()
+	if len(outbox) != 0 {
+		t.Fatalf("unexpected email for unchanged item")
+	}
+
+	// Changed content sends an email.
+	item.Item.Content = "<p>Versions 1.0 and 1.1 are affected.</p>"
+	err = p.checkUpdate(logger, entry, feed, item, item.Link, recipients)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	outbox, _ = p.Outbox()
+	if len(outbox) != 1 {
+		t.Fatalf("expected an email for the updated item, got %d", len(outbox))
+	}
+	msg := string(outbox[0].Message)
+	for _, txt := range []string{"Updated: Advisory", "- Version 1.0 is affected.", "+ Versions 1.0 and 1.1 are affected."} {
+		if !strings.Contains(msg, txt) {
+			t.Fatalf("failed to find '%s' in message:\n%s", txt, msg)
+		}
+	}
+
+	rec, err = p.itemRecord(entry.URL, item.Link)
+	if err != nil || rec.Updates != 1 || !strings.Contains(rec.Text, "1.1") {
+		t.Fatalf("unexpected record %v %v", rec, err)
+	}
+}
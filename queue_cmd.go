@@ -0,0 +1,130 @@
+//
+// Show, or flush, the items queued for scheduled digests.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/skx/rss2email/configfile"
+	"github.com/skx/rss2email/processor"
+)
+
+// Structure for our options and state.
+type queueCmd struct {
+
+	// Configuration file, used for testing
+	config *configfile.ConfigFile
+
+	// flush causes the queued items to be sent immediately.
+	flush bool
+}
+
+// Arguments handles argument-flags we might have.
+//
+// In our case we use this as a hook to setup our configuration-file,
+// which allows testing.
+func (q *queueCmd) Arguments(flags *flag.FlagSet) {
+
+	// Setup configuration file
+	q.config = configfile.New()
+
+	flags.BoolVar(&q.flush, "flush", false, "Send all queued items now, regardless of their schedule.")
+}
+
+// Info is part of the subcommand-API
+func (q *queueCmd) Info() (string, string) {
+	return "queue", `Show the items queued for scheduled digests.
+
+Feeds which have the 'digest-schedule' option set don't generate
+emails as new items are found, instead the items are added to a queue
+and sent as a single digest email when the schedule comes around.
+
+This sub-command shows the items which are currently queued, and when
+the digest for each feed is next due to be sent.
+
+If you add the '-flush' flag the queued items will be sent immediately,
+regardless of their schedule.
+
+Example:
+
+    $ rss2email queue
+    $ rss2email queue -flush
+`
+}
+
+// Entry-point.
+func (q *queueCmd) Execute(args []string) int {
+
+	// Parse the configuration file, so that we can find the schedules.
+	entries, err := q.config.Parse()
+	if err != nil {
+		logger.Error("failed to parse configuration file",
+			slog.String("configfile", q.config.Path()),
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	options := make(map[string][]configfile.Option)
+	for _, entry := range entries {
+		options[entry.URL] = entry.Options
+	}
+
+	// Create the helper
+	p, err := processor.New()
+	if err != nil {
+		logger.Error("failed to create feed processor",
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	// Close the database handle, once processed.
+	defer p.Close()
+
+	p.SetLogger(logger)
+	p.SetVersion(version)
+
+	// Flushing?
+	if q.flush {
+
+		errors := p.FlushQueue()
+
+		// If we found errors then show them.
+		if len(errors) != 0 {
+			for _, err := range errors {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+			return 1
+		}
+		return 0
+	}
+
+	queue, err := p.Queue()
+	if err != nil {
+		logger.Error("failed to read the queue",
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	for _, feed := range queue {
+
+		fmt.Fprintf(out, "%s\n", feed.URL)
+
+		due, ok := processor.NextDigest(feed, options[feed.URL])
+		if ok {
+			fmt.Fprintf(out, "# %d queued, digest due %s\n", len(feed.Items), due.Format("2006-01-02 15:04"))
+		} else {
+			fmt.Fprintf(out, "# %d queued, digest due on the next run\n", len(feed.Items))
+		}
+
+		for _, item := range feed.Items {
+			fmt.Fprintf(out, "\t%s %s\n\t\t%s\n", item.Queued.Format("2006-01-02 15:04"), item.Item.Subject, item.Item.Link)
+		}
+	}
+
+	return 0
+}
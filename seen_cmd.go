@@ -33,6 +33,11 @@ to which you've been notified in the past.
 (i.e. This walks the internal database which is used to
 store state, and outputs the list of recorded items which
 are no longer regarded as new/unseen.)
+
+Along with the link of each item we show its title, when it
+was first seen, and what happened to it - whether it was
+emailed and to whom, queued for a digest, or excluded by a
+rule in the configuration file.
 `
 }
 
@@ -63,7 +68,9 @@ func (s *seenCmd) Execute(args []string) int {
 
 	err = db.View(func(tx *bbolt.Tx) error {
 		err = tx.ForEach(func(bucketName []byte, _ *bbolt.Bucket) error {
-			bucketNames = append(bucketNames, bucketName)
+			if !state.IsInternalBucket(string(bucketName)) {
+				bucketNames = append(bucketNames, bucketName)
+			}
 			return nil
 		})
 		return err
@@ -87,12 +94,23 @@ func (s *seenCmd) Execute(args []string) int {
 			c := b.Cursor()
 
 			// Iterate over the key/value pairs.
-			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			for k, v := c.First(); k != nil; k, v = c.Next() {
 
 				// Convert the key to a string
 				key := string(k)
 
 				fmt.Printf("\t%s\n", key)
+
+				// Show the history of the item
+				rec, err := state.ParseRecord(v)
+				if err != nil {
+					fmt.Printf("\t\t%s\n", err.Error())
+					continue
+				}
+				if rec.Title != "" {
+					fmt.Printf("\t\t%s\n", rec.Title)
+				}
+				fmt.Printf("\t\t%s\n", rec.String())
 			}
 
 			return nil
@@ -0,0 +1,159 @@
+//
+// Set options on the feeds in our feed-list.
+//
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// Structure for our options and state.
+type setCmd struct {
+
+	// Configuration file, used for testing
+	config *configfile.ConfigFile
+
+	// tag selects the feeds with the given tag, rather than an URL.
+	tag string
+
+	// append adds values, rather than replacing existing ones.
+	append bool
+}
+
+// Arguments handles argument-flags we might have.
+//
+// In our case we use this as a hook to setup our configuration-file,
+// which allows testing.
+func (s *setCmd) Arguments(flags *flag.FlagSet) {
+	s.config = configfile.New()
+
+	flags.StringVar(&s.tag, "tag", "", "Change the feeds with the given tag, rather than a single URL.")
+	flags.BoolVar(&s.append, "append", false, "Add the values to any the options already have, rather than replacing them.")
+}
+
+// Info is part of the subcommand-API
+func (s *setCmd) Info() (string, string) {
+	return "set", `Set options on a feed in our feed-list.
+
+Set one or more per-feed options, given as 'key:value' pairs, on the
+feed with the given URL.  Any existing values of those options are
+replaced, unless you use '-append', in which case another value is
+added, which is useful for options such as "exclude" which may be
+repeated.
+
+Rather than naming an URL you may change all the feeds with a given
+tag via the '-tag' flag.
+
+Options may be removed via the 'unset' sub-command, and shown via
+the 'options' sub-command.  To see the available options please run:
+
+   $ rss2email help config
+
+Example:
+
+    $ rss2email set https://blog.steve.fi/index.rss tag:news
+    $ rss2email set -append https://blog.steve.fi/index.rss exclude-title:(?i)cake
+    $ rss2email set -tag news frequency:60
+`
+}
+
+// selectFeeds returns the URLs of the feeds which have the given tag, or,
+// if the tag is empty, the URL given as the first argument, along with the
+// arguments which remain.
+func selectFeeds(entries []configfile.Feed, tag string, args []string) ([]string, []string, error) {
+
+	if tag == "" {
+		if len(args) < 1 {
+			return nil, nil, fmt.Errorf("no feed URL was given")
+		}
+
+		for _, entry := range entries {
+			if entry.URL == args[0] {
+				return []string{entry.URL}, args[1:], nil
+			}
+		}
+		return nil, nil, fmt.Errorf("%s is not in the feed list", args[0])
+	}
+
+	var urls []string
+	for _, entry := range entries {
+		for _, opt := range entry.Options {
+			if strings.ToLower(opt.Name) == "tag" && opt.Value == tag {
+				urls = append(urls, entry.URL)
+				break
+			}
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, nil, fmt.Errorf("no feeds have the tag %s", tag)
+	}
+	return urls, args, nil
+}
+
+// Execute is invoked if the user specifies `set` as the subcommand.
+func (s *setCmd) Execute(args []string) int {
+
+	// Parse the existing file
+	entries, err := s.config.Parse()
+	if err != nil {
+		logger.Error("failed to parse configuration file",
+			slog.String("configfile", s.config.Path()),
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	urls, args, err := selectFeeds(entries, s.tag, args)
+	if err != nil {
+		logger.Error("failed to find the feeds to change", slog.String("error", err.Error()))
+		return 1
+	}
+
+	// Parse, and validate, the options before changing anything.
+	var opts optionsFlag
+	for _, arg := range args {
+		err = opts.Set(arg)
+		if err != nil {
+			logger.Error("invalid option", slog.String("error", err.Error()))
+			return 1
+		}
+	}
+	if len(opts) == 0 {
+		logger.Error("no options were given")
+		return 1
+	}
+	for _, opt := range opts {
+		err = configfile.CheckOption(opt)
+		if err != nil {
+			logger.Error("invalid option, see 'rss2email help config' for the available options",
+				slog.String("error", err.Error()))
+			return 1
+		}
+	}
+
+	for _, url := range urls {
+		for _, opt := range opts {
+			if s.append {
+				s.config.AppendOption(url, opt.Name, opt.Value)
+			} else {
+				s.config.SetOption(url, opt.Name, opt.Value)
+			}
+		}
+	}
+
+	// Save the list.
+	err = s.config.Save()
+	if err != nil {
+		logger.Error("failed to save the updated feed list", slog.String("error", err.Error()))
+		return 1
+	}
+
+	// All done, with no errors.
+	return 0
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// optionsHelper writes the given feed list to a temporary file, and
+// returns its path.
+func optionsHelper(t *testing.T, content string) string {
+
+	path := t.TempDir() + "/feeds.txt"
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Error writing config file")
+	}
+	return path
+}
+
+func TestSet(t *testing.T) {
+
+	path := optionsHelper(t, `https://example.org/
+ - tag: news
+ - exclude: foo
+https://example.net/
+ - tag: news
+https://example.com/
+`)
+
+	run := func(args ...string) int {
+		set := setCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.Arguments(flags)
+		set.config = configfile.NewWithPath(path)
+
+		err := flags.Parse(args)
+		if err != nil {
+			t.Fatalf("Error parsing flags: %s", err)
+		}
+		return set.Execute(flags.Args())
+	}
+
+	// Errors
+	for _, args := range [][]string{
+		{},
+		{"https://example.com/"},
+		{"https://missing.example.com/", "retry:3"},
+		{"https://example.com/", "bogus:3"},
+		{"https://example.com/", "retry:three"},
+		{"https://example.com/", "retry"},
+		{"-tag", "missing", "retry:3"},
+	} {
+		if run(args...) == 0 {
+			t.Fatalf("expected an error with %v", args)
+		}
+	}
+
+	// Set by URL, by tag, and append.
+	if run("https://example.org/", "exclude:bar", "retry:3") != 0 {
+		t.Fatalf("failed to set options")
+	}
+	if run("-tag", "news", "frequency:60") != 0 {
+		t.Fatalf("failed to set options by tag")
+	}
+	if run("-append", "https://example.com/", "exclude:foo") != 0 {
+		t.Fatalf("failed to append options")
+	}
+
+	entries, err := configfile.NewWithPath(path).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing written file")
+	}
+
+	expected := map[string][]configfile.Option{
+		"https://example.org/": {{Name: "tag", Value: "news"}, {Name: "exclude", Value: "bar"}, {Name: "retry", Value: "3"}, {Name: "frequency", Value: "60"}},
+		"https://example.net/": {{Name: "tag", Value: "news"}, {Name: "frequency", Value: "60"}},
+		"https://example.com/": {{Name: "exclude", Value: "foo"}},
+	}
+	for _, entry := range entries {
+		want := expected[entry.URL]
+		if len(want) != len(entry.Options) {
+			t.Fatalf("unexpected options for %s: %v", entry.URL, entry.Options)
+		}
+		for i := range want {
+			if want[i] != entry.Options[i] {
+				t.Fatalf("unexpected options for %s: %v", entry.URL, entry.Options)
+			}
+		}
+	}
+}
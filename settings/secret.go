@@ -0,0 +1,85 @@
+package settings
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CommandTimeout is the longest we wait for a command which outputs a
+// secret.
+var CommandTimeout = 30 * time.Second
+
+// Secret returns the value of the named secret setting, such as
+// SMTP_PASSWORD.
+//
+// Rather than setting the value directly, which means it is visible in
+// the environment of our process, it may be read from a file named by
+// the NAME_FILE setting, or from the output of the command given by the
+// NAME_COMMAND setting.  Surrounding whitespace, such as a trailing
+// newline, is removed.  The value is used if it is set, then the file,
+// then the command.
+func Secret(name string) (string, error) {
+
+	if value := Get(name); value != "" {
+		return value, nil
+	}
+
+	if path := Get(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %s", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	if command := Get(name + "_COMMAND"); command != "" {
+		return runSecret(name, command)
+	}
+
+	return "", nil
+}
+
+// HasSecret returns true if the named secret setting is set, directly or
+// via a file or command, without reading it.
+func HasSecret(name string) bool {
+	return Get(name) != "" || Get(name+"_FILE") != "" || Get(name+"_COMMAND") != ""
+}
+
+// runSecret runs the given command, via the shell, and returns its output.
+func runSecret(name string, command string) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Don't wait for any children which outlive the shell.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s_COMMAND timed out after %s", name, CommandTimeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("%s_COMMAND failed: %s: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s_COMMAND failed: %s", name, err)
+	}
+
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("%s_COMMAND produced no output", name)
+	}
+	return value, nil
+}
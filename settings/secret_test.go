@@ -0,0 +1,81 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSecret ensures secrets are read from the environment, a file, or a
+// command, in that order.
+func TestSecret(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "secret")
+	err := os.WriteFile(path, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	t.Setenv("TEST_SECRET", "")
+	t.Setenv("TEST_SECRET_FILE", "")
+	t.Setenv("TEST_SECRET_COMMAND", "")
+
+	if HasSecret("TEST_SECRET") {
+		t.Fatalf("unexpected secret")
+	}
+	value, err := Secret("TEST_SECRET")
+	if err != nil || value != "" {
+		t.Fatalf("unexpected secret %s %s", value, err)
+	}
+
+	t.Setenv("TEST_SECRET_COMMAND", "echo from-command")
+	value, err = Secret("TEST_SECRET")
+	if err != nil || value != "from-command" || !HasSecret("TEST_SECRET") {
+		t.Fatalf("unexpected secret %s %s", value, err)
+	}
+
+	t.Setenv("TEST_SECRET_FILE", path)
+	value, err = Secret("TEST_SECRET")
+	if err != nil || value != "from-file" {
+		t.Fatalf("unexpected secret %s %s", value, err)
+	}
+
+	t.Setenv("TEST_SECRET", "from-env")
+	value, err = Secret("TEST_SECRET")
+	if err != nil || value != "from-env" {
+		t.Fatalf("unexpected secret %s %s", value, err)
+	}
+}
+
+// TestSecretErrors ensures failures to read secrets are reported.
+func TestSecretErrors(t *testing.T) {
+
+	t.Setenv("TEST_SECRET", "")
+
+	tests := []struct {
+		file    string
+		command string
+		err     string
+	}{
+		{filepath.Join(t.TempDir(), "missing"), "", "failed to read TEST_SECRET_FILE"},
+		{"", "echo oops >&2; exit 3", "TEST_SECRET_COMMAND failed: exit status 3: oops"},
+		{"", "true", "TEST_SECRET_COMMAND produced no output"},
+		{"", "sleep 5", "TEST_SECRET_COMMAND timed out"},
+	}
+
+	bak := CommandTimeout
+	CommandTimeout = 100 * time.Millisecond
+	defer func() { CommandTimeout = bak }()
+
+	for _, test := range tests {
+		t.Setenv("TEST_SECRET_FILE", test.file)
+		t.Setenv("TEST_SECRET_COMMAND", test.command)
+
+		_, err := Secret("TEST_SECRET")
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error '%s', got %v", test.err, err)
+		}
+	}
+}
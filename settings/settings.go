@@ -0,0 +1,121 @@
+// Package settings provides access to our global settings.
+//
+// Each setting may be given as an environmental variable, in the settings
+// section of the structured configuration file, or in a "[settings]"
+// section of the plain-text list of feeds.  They take precedence in that
+// order, so a variable set in the environment always wins.
+package settings
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// Value is the effective value of a setting, along with where it came from.
+type Value struct {
+
+	// Name is the name of the setting.
+	Name string
+
+	// Value is the value of the setting.
+	Value string
+
+	// Source describes where the value came from, which is
+	// "environment", the file and line on which it was set, "default",
+	// or empty if the setting isn't set.
+	Source string
+}
+
+var (
+	// mutex protects our loaded settings.
+	mutex sync.RWMutex
+
+	// loaded holds the settings read from our configuration files.
+	loaded = make(map[string]configfile.Setting)
+)
+
+// Load reads the settings from the structured configuration file, and from
+// the given configuration file, if that is a different file, replacing any
+// which were loaded previously.
+//
+// The given configuration file is parsed if necessary, if it can't be
+// parsed its settings are ignored, as the problem will be reported when the
+// feeds are read.
+func Load(config *configfile.ConfigFile) error {
+
+	found := make(map[string]configfile.Setting)
+
+	if config.Path() != configfile.YAMLPath() {
+		_, err := config.Parse()
+		if err == nil {
+			list, _ := config.Settings()
+			for _, s := range list {
+				found[s.Name] = s
+			}
+		}
+	}
+
+	list, err := configfile.ReadSettings(configfile.YAMLPath())
+	for _, s := range list {
+		found[s.Name] = s
+	}
+
+	mutex.Lock()
+	loaded = found
+	mutex.Unlock()
+
+	return err
+}
+
+// Get returns the value of the named setting, or an empty string if it is
+// not set.  Defaults are not returned, they're applied by the code which
+// uses each setting.
+func Get(name string) string {
+
+	if env := os.Getenv(name); env != "" {
+		return env
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return loaded[name].Value
+}
+
+// Lookup returns the effective value of the named setting, including its
+// default, and where it came from.
+func Lookup(name string) Value {
+
+	if env := os.Getenv(name); env != "" {
+		return Value{Name: name, Value: env, Source: "environment"}
+	}
+
+	mutex.RLock()
+	s, ok := loaded[name]
+	mutex.RUnlock()
+
+	if ok && s.Value != "" {
+		return Value{Name: name, Value: s.Value, Source: fmt.Sprintf("%s:%d", s.Path, s.Line)}
+	}
+
+	for _, info := range configfile.AllSettings() {
+		if info.Name == name && info.Default != "" {
+			return Value{Name: name, Value: info.Default, Source: "default"}
+		}
+	}
+
+	return Value{Name: name}
+}
+
+// All returns the effective values of all the known settings, in the order
+// of configfile.AllSettings.
+func All() []Value {
+
+	var out []Value
+	for _, info := range configfile.AllSettings() {
+		out = append(out, Lookup(info.Name))
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// TestPrecedence ensures the environment takes precedence over the
+// structured configuration file, which takes precedence over the feed list.
+func TestPrecedence(t *testing.T) {
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_PORT", "")
+	t.Setenv("SLEEP", "")
+	t.Setenv("LOG_LEVEL", "")
+
+	dir := filepath.Dir(configfile.YAMLPath())
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+
+	feeds := filepath.Join(dir, "feeds.txt")
+	err = os.WriteFile(feeds, []byte("[settings]\n - smtp_host: one.example.com\n - smtp_port: 25\n - sleep: 5\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	err = os.WriteFile(configfile.YAMLPath(), []byte("settings:\n  smtp_host: two.example.com\n  sleep: 10\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+
+	err = Load(configfile.NewWithPath(feeds))
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	defer Load(configfile.NewWithPath(filepath.Join(dir, "missing.txt")))
+
+	t.Setenv("SLEEP", "15")
+
+	tests := []Value{
+		{"SMTP_HOST", "two.example.com", configfile.YAMLPath() + ":2"},
+		{"SMTP_PORT", "25", feeds + ":3"},
+		{"SLEEP", "15", "environment"},
+		{"LOG_LEVEL", "warn", "default"},
+		{"SMTP_USERNAME", "", ""},
+	}
+
+	for _, test := range tests {
+		got := Lookup(test.Name)
+		if got != test {
+			t.Fatalf("unexpected value %v, expected %v", got, test)
+		}
+
+		// Defaults aren't returned by Get.
+		if test.Source != "default" && Get(test.Name) != test.Value {
+			t.Fatalf("unexpected value %s for %s", Get(test.Name), test.Name)
+		}
+	}
+	if Get("LOG_LEVEL") != "" {
+		t.Fatalf("unexpected default %s", Get("LOG_LEVEL"))
+	}
+
+	if len(All()) != len(configfile.AllSettings()) {
+		t.Fatalf("unexpected settings %v", All())
+	}
+
+	// A broken structured file is reported.
+	err = os.WriteFile(configfile.YAMLPath(), []byte("settings: [\n"), 0644)
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if Load(configfile.NewWithPath(feeds)) == nil {
+		t.Fatalf("expected an error")
+	}
+}
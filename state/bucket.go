@@ -0,0 +1,31 @@
+package state
+
+import "strings"
+
+// Our BoltDB database contains a bucket for each feed, named after the
+// URL of the feed, which holds the state of the items within it.
+//
+// We also use some buckets for our own purposes, and these are named with
+// a prefix which cannot be confused with an URL.
+const internalPrefix = "rss2email:"
+
+// QueueBucket is the name of the bucket which contains the items which
+// are queued for a scheduled digest.
+//
+// Within it there is a nested bucket for each feed, named after the URL of
+// the feed, holding the queued items in the order they were added.
+const QueueBucket = internalPrefix + "queue"
+
+// IsInternalBucket returns true if the named bucket is used for our own
+// purposes, rather than holding the state of a feed.
+func IsInternalBucket(name string) bool {
+	return strings.HasPrefix(name, internalPrefix)
+}
+
+// OutboxBucket is the name of the bucket which contains the messages which
+// could not be delivered, and which will be retried in the future.
+const OutboxBucket = internalPrefix + "outbox"
+
+// MetaBucket is the name of the bucket which contains information about
+// the database itself, such as the version of the records within it.
+const MetaBucket = internalPrefix + "meta"
@@ -0,0 +1,77 @@
+package state
+
+import (
+	"strconv"
+
+	"go.etcd.io/bbolt"
+)
+
+// versionKey is the key, within the MetaBucket, which holds the version
+// of the records stored in the database.
+const versionKey = "version"
+
+// Migrate updates any records in the database which were written in an
+// older format, returning the number of records which were converted.
+//
+// Once the database has been migrated its version is recorded, so that
+// subsequent calls are cheap.
+func Migrate(db *bbolt.DB) (int, error) {
+
+	count := 0
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+
+		meta, err := tx.CreateBucketIfNotExists([]byte(MetaBucket))
+		if err != nil {
+			return err
+		}
+
+		// Already up to date?
+		version, _ := strconv.Atoi(string(meta.Get([]byte(versionKey))))
+		if version >= RecordVersion {
+			return nil
+		}
+
+		err = tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+
+			if IsInternalBucket(string(name)) {
+				return nil
+			}
+
+			// Find the legacy records, we can't update
+			// the bucket while we're iterating over it.
+			var legacy [][]byte
+			err := b.ForEach(func(k []byte, v []byte) error {
+				if v != nil && IsLegacyRecord(v) {
+					legacy = append(legacy, append([]byte{}, k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, k := range legacy {
+
+				data, err := Record{Status: StatusSeen}.Marshal()
+				if err != nil {
+					return err
+				}
+
+				err = b.Put(k, data)
+				if err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return meta.Put([]byte(versionKey), []byte(strconv.Itoa(RecordVersion)))
+	})
+
+	return count, err
+}
@@ -0,0 +1,72 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// TestMigrate ensures legacy records are converted.
+func TestMigrate(t *testing.T) {
+
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "state.db"), 0666, nil)
+	if err != nil {
+		t.Fatalf("failed to open database %s", err)
+	}
+	defer db.Close()
+
+	// Create a database in the legacy format.
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("https://example.com/"))
+		if err != nil {
+			return err
+		}
+		err = b.Put([]byte("https://example.com/one"), []byte("seen"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("https://example.com/two"), []byte(`{"v":1,"status":"emailed"}`))
+	})
+	if err != nil {
+		t.Fatalf("failed to populate database %s", err)
+	}
+
+	count, err := Migrate(db)
+	if err != nil {
+		t.Fatalf("unexpected error migrating %s", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected one record to be migrated, got %d", count)
+	}
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("https://example.com/"))
+
+		one, err := ParseRecord(b.Get([]byte("https://example.com/one")))
+		if err != nil {
+			return err
+		}
+		if IsLegacyRecord(b.Get([]byte("https://example.com/one"))) || one.Status != StatusSeen {
+			t.Fatalf("record was not migrated: %v", one)
+		}
+
+		two, err := ParseRecord(b.Get([]byte("https://example.com/two")))
+		if err != nil {
+			return err
+		}
+		if two.Status != StatusEmailed {
+			t.Fatalf("record was changed by migration: %v", two)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read database %s", err)
+	}
+
+	// A second migration is a no-op.
+	count, err = Migrate(db)
+	if err != nil || count != 0 {
+		t.Fatalf("unexpected result from second migration %d %v", count, err)
+	}
+}
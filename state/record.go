@@ -0,0 +1,188 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RecordVersion is the version of the record format we write.
+//
+// Version zero is the legacy format, in which the literal string "seen"
+// was stored for each item.
+const RecordVersion = 1
+
+// The status of an item, as stored in a Record.
+const (
+	// StatusSeen is used for items which were recorded without sending
+	// an email, for example when running with "-send=false", and for
+	// items migrated from the legacy format.
+	StatusSeen = "seen"
+
+	// StatusEmailed is used for items which were emailed.
+	StatusEmailed = "emailed"
+
+	// StatusExcluded is used for items which were excluded by a rule.
+	StatusExcluded = "excluded"
+
+	// StatusQueued is used for items queued for a scheduled digest.
+	StatusQueued = "queued"
+
+	// StatusFailed is used for items which couldn't be emailed, and
+	// which were saved to our outbox to be retried.
+	StatusFailed = "failed"
+)
+
+// Record is the value which is stored in the state database for each
+// feed item we've seen, in the bucket of the feed from which it came.
+type Record struct {
+
+	// Version is the version of the record format.
+	Version int `json:"v"`
+
+	// FirstSeen is the time at which the item was first seen.
+	//
+	// This is zero for items migrated from the legacy format.
+	FirstSeen time.Time `json:"first_seen,omitempty"`
+
+	// Status is the delivery status of the item.
+	Status string `json:"status"`
+
+	// Recipients holds the addresses to which the item was sent.
+	Recipients []string `json:"recipients,omitempty"`
+
+	// Failed holds the addresses to which delivery failed, the messages
+	// for which were saved in our outbox.  Recipients holds those to which
+	// delivery succeeded.
+	Failed []string `json:"failed,omitempty"`
+
+	// Title is the title of the item.
+	Title string `json:"title,omitempty"`
+
+	// Link is the link of the item.
+	Link string `json:"link,omitempty"`
+
+	// ExcludedBy holds the rule which excluded the item, if any.
+	ExcludedBy string `json:"excluded_by,omitempty"`
+
+	// MissingSince is the time at which the item was first found to be
+	// missing from its feed, it is zero if the item is present.
+	MissingSince time.Time `json:"missing_since,omitempty"`
+
+	// Misses is the number of consecutive fetches of the feed from which
+	// the item was missing.
+	Misses int `json:"misses,omitempty"`
+
+	// Hash is a hash of the text of the item, it is only recorded for
+	// feeds with the "notify-updates" option.
+	Hash string `json:"hash,omitempty"`
+
+	// Text is the text of the item, as it was when Hash was calculated,
+	// so that we can show what changed when the item is updated.
+	Text string `json:"text,omitempty"`
+
+	// Updates is the number of times the item was updated.
+	Updates int `json:"updates,omitempty"`
+
+	// Updated is the time at which the item was most recently updated.
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+// ParseRecord decodes a record which was read from the state database.
+//
+// Values which were written in the legacy format are converted.
+func ParseRecord(data []byte) (Record, error) {
+
+	var r Record
+
+	// Legacy values are not JSON.
+	if IsLegacyRecord(data) {
+		r.Version = RecordVersion
+		r.Status = StatusSeen
+		return r, nil
+	}
+
+	err := json.Unmarshal(data, &r)
+	if err != nil {
+		return r, fmt.Errorf("failed to decode record: %s", err)
+	}
+
+	if r.Version > RecordVersion {
+		return r, fmt.Errorf("unsupported record version %d", r.Version)
+	}
+
+	return r, nil
+}
+
+// IsLegacyRecord returns true if the given value was written in the
+// legacy format, and should be migrated.
+func IsLegacyRecord(data []byte) bool {
+	return !bytes.HasPrefix(data, []byte("{"))
+}
+
+// Marshal encodes the record, for storage in the state database.
+func (r Record) Marshal() ([]byte, error) {
+	r.Version = RecordVersion
+	return json.Marshal(r)
+}
+
+// SetDelivery updates the record to show that the item was sent to the
+// given recipients, delivery to those in failed having failed.
+func (r *Record) SetDelivery(recipients []string, failed []string) {
+
+	bad := make(map[string]bool)
+	for _, addr := range failed {
+		bad[addr] = true
+	}
+
+	r.Recipients = nil
+	for _, addr := range recipients {
+		if !bad[addr] {
+			r.Recipients = append(r.Recipients, addr)
+		}
+	}
+
+	r.Failed = failed
+	r.Status = StatusEmailed
+	if len(failed) > 0 {
+		r.Status = StatusFailed
+	}
+}
+
+// String returns a human-readable summary of the record.
+func (r Record) String() string {
+
+	var parts []string
+
+	switch r.Status {
+	case StatusEmailed:
+		parts = append(parts, "emailed to "+strings.Join(r.Recipients, ", "))
+	case StatusQueued:
+		parts = append(parts, "queued for "+strings.Join(r.Recipients, ", "))
+	case StatusExcluded:
+		parts = append(parts, "excluded by "+r.ExcludedBy)
+	case StatusFailed:
+		if len(r.Recipients) > 0 {
+			parts = append(parts, "emailed to "+strings.Join(r.Recipients, ", "))
+		}
+		parts = append(parts, "delivery to "+strings.Join(r.Failed, ", ")+" failed, saved to outbox")
+	default:
+		parts = append(parts, r.Status)
+	}
+
+	if !r.FirstSeen.IsZero() {
+		parts = append(parts, "first seen "+r.FirstSeen.Format("2006-01-02 15:04"))
+	}
+
+	if r.Updates > 0 {
+		parts = append(parts, fmt.Sprintf("updated %d times, most recently %s", r.Updates, r.Updated.Format("2006-01-02 15:04")))
+	}
+
+	if !r.MissingSince.IsZero() {
+		parts = append(parts, fmt.Sprintf("missing from feed since %s (%d fetches)", r.MissingSince.Format("2006-01-02 15:04"), r.Misses))
+	}
+
+	return strings.Join(parts, ", ")
+}
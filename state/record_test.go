@@ -0,0 +1,67 @@
+package state
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLegacyRecord ensures we can parse the legacy "seen" value.
+func TestLegacyRecord(t *testing.T) {
+
+	if !IsLegacyRecord([]byte("seen")) {
+		t.Fatalf("expected legacy record")
+	}
+
+	r, err := ParseRecord([]byte("seen"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if r.Status != StatusSeen || r.Version != RecordVersion {
+		t.Fatalf("unexpected record %v", r)
+	}
+}
+
+// TestRecordRoundTrip ensures records survive being stored.
+func TestRecordRoundTrip(t *testing.T) {
+
+	in := Record{
+		FirstSeen:  time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC),
+		Status:     StatusEmailed,
+		Recipients: []string{"bob@example.com"},
+		Title:      "Title",
+		Link:       "https://example.com/",
+	}
+
+	data, err := in.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if IsLegacyRecord(data) {
+		t.Fatalf("new record regarded as legacy")
+	}
+
+	out, err := ParseRecord(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.Version != RecordVersion || !out.FirstSeen.Equal(in.FirstSeen) || out.Title != in.Title || out.Recipients[0] != "bob@example.com" {
+		t.Fatalf("record changed: %v != %v", in, out)
+	}
+
+	if !strings.Contains(out.String(), "emailed to bob@example.com") {
+		t.Fatalf("unexpected summary %s", out.String())
+	}
+
+	// Future versions are rejected.
+	_, err = ParseRecord([]byte(`{"v":99}`))
+	if err == nil {
+		t.Fatalf("expected error parsing future version")
+	}
+
+	// As is bogus JSON.
+	_, err = ParseRecord([]byte(`{"v":`))
+	if err == nil {
+		t.Fatalf("expected error parsing bogus JSON")
+	}
+}
@@ -1,4 +1,4 @@
-// Package template just holds our email-template.
+// Package template just holds our email-templates.
 //
 // This is abstracted because we want to refer to it from our
 // processor-package, which is not in package-main, and also
@@ -12,7 +12,15 @@ import (
 //go:embed template.txt
 var message string
 
+//go:embed digest.txt
+var digest string
+
 // EmailTemplate returns the embedded email template.
 func EmailTemplate() []byte {
 	return []byte(message)
 }
+
+// DigestTemplate returns the embedded template used for digest emails.
+func DigestTemplate() []byte {
+	return []byte(digest)
+}
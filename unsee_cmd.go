@@ -33,6 +33,8 @@ commands run they'll trigger an email notification.
 
 You can see the URLs which we regard as having already seen
 via the 'seen' sub-command.
+
+Each item which is removed is shown, along with its history.
 `
 }
 
@@ -74,7 +76,9 @@ func (u *unseeCmd) Execute(args []string) int {
 	// Record each bucket
 	err = db.View(func(tx *bbolt.Tx) error {
 		return tx.ForEach(func(bucketName []byte, _ *bbolt.Bucket) error {
-			bucketNames = append(bucketNames, string(bucketName))
+			if !state.IsInternalBucket(string(bucketName)) {
+				bucketNames = append(bucketNames, string(bucketName))
+			}
 			return nil
 		})
 	})
@@ -92,6 +96,9 @@ func (u *unseeCmd) Execute(args []string) int {
 			// Items to remove
 			remove := []string{}
 
+			// The history of the items to remove
+			history := make(map[string]string)
+
 			// Select the bucket, which we know must exist
 			b := tx.Bucket([]byte(buck))
 
@@ -99,11 +106,19 @@ func (u *unseeCmd) Execute(args []string) int {
 			c := b.Cursor()
 
 			// Iterate over the key/value pairs.
-			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			for k, v := c.First(); k != nil; k, v = c.Next() {
 
 				// Convert the key to a string
 				key := string(k)
 
+				// Get the history of the item
+				rec, err := state.ParseRecord(v)
+				if err == nil {
+					history[key] = rec.String()
+				} else {
+					history[key] = err.Error()
+				}
+
 				// Is this something to remove?
 				for _, arg := range args {
 
@@ -130,8 +145,10 @@ func (u *unseeCmd) Execute(args []string) int {
 				err = b.Delete([]byte(key))
 				if err != nil {
 					logger.Debug("failed to remove item from history", slog.String("item", key), slog.String("database", dbPath), slog.String("bucket", buck), slog.String("error", err.Error()))
-
+					continue
 				}
+
+				fmt.Printf("%s\n\t%s\n", key, history[key])
 			}
 			return nil
 		})
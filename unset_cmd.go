@@ -0,0 +1,110 @@
+//
+// Remove options from the feeds in our feed-list.
+//
+
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"strings"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+// Structure for our options and state.
+type unsetCmd struct {
+
+	// Configuration file, used for testing
+	config *configfile.ConfigFile
+
+	// tag selects the feeds with the given tag, rather than an URL.
+	tag string
+}
+
+// Arguments handles argument-flags we might have.
+//
+// In our case we use this as a hook to setup our configuration-file,
+// which allows testing.
+func (u *unsetCmd) Arguments(flags *flag.FlagSet) {
+	u.config = configfile.New()
+
+	flags.StringVar(&u.tag, "tag", "", "Change the feeds with the given tag, rather than a single URL.")
+}
+
+// Info is part of the subcommand-API
+func (u *unsetCmd) Info() (string, string) {
+	return "unset", `Remove options from a feed in our feed-list.
+
+Remove one or more per-feed options from the feed with the given URL.
+Giving the name of an option removes all of its values, while giving
+a 'key:value' pair removes only the option with that value.
+
+Rather than naming an URL you may change all the feeds with a given
+tag via the '-tag' flag.
+
+Example:
+
+    $ rss2email unset https://blog.steve.fi/index.rss frequency
+    $ rss2email unset https://blog.steve.fi/index.rss exclude-title:(?i)cake
+    $ rss2email unset -tag news frequency
+`
+}
+
+// Execute is invoked if the user specifies `unset` as the subcommand.
+func (u *unsetCmd) Execute(args []string) int {
+
+	// Parse the existing file
+	entries, err := u.config.Parse()
+	if err != nil {
+		logger.Error("failed to parse configuration file",
+			slog.String("configfile", u.config.Path()),
+			slog.String("error", err.Error()))
+		return 1
+	}
+
+	urls, args, err := selectFeeds(entries, u.tag, args)
+	if err != nil {
+		logger.Error("failed to find the feeds to change", slog.String("error", err.Error()))
+		return 1
+	}
+
+	if len(args) == 0 {
+		logger.Error("no options were given")
+		return 1
+	}
+
+	// Validate the names before changing anything.
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, ":")
+		if !configfile.IsKnownOption(name) {
+			err = configfile.CheckOption(configfile.Option{Name: name})
+			logger.Error("invalid option, see 'rss2email help config' for the available options",
+				slog.String("error", err.Error()))
+			return 1
+		}
+	}
+
+	removed := 0
+	for _, url := range urls {
+		for _, arg := range args {
+			name, value, _ := strings.Cut(arg, ":")
+			removed += u.config.UnsetOption(url, strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	if removed == 0 {
+		logger.Warn("none of the options were set")
+		return 0
+	}
+
+	// Save the list.
+	err = u.config.Save()
+	if err != nil {
+		logger.Error("failed to save the updated feed list", slog.String("error", err.Error()))
+		return 1
+	}
+
+	// All done, with no errors.
+	return 0
+}
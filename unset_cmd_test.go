@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/skx/rss2email/configfile"
+)
+
+func TestUnset(t *testing.T) {
+
+	path := optionsHelper(t, `https://example.org/
+ - tag: news
+ - exclude: foo
+ - exclude: bar
+ - retry: 3
+https://example.net/
+ - tag: news
+ - retry: 3
+`)
+
+	run := func(args ...string) int {
+		unset := unsetCmd{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		unset.Arguments(flags)
+		unset.config = configfile.NewWithPath(path)
+
+		err := flags.Parse(args)
+		if err != nil {
+			t.Fatalf("Error parsing flags: %s", err)
+		}
+		return unset.Execute(flags.Args())
+	}
+
+	// Errors
+	for _, args := range [][]string{
+		{},
+		{"https://example.org/"},
+		{"https://example.org/", "bogus"},
+	} {
+		if run(args...) == 0 {
+			t.Fatalf("expected an error with %v", args)
+		}
+	}
+
+	if run("https://example.org/", "exclude:foo") != 0 {
+		t.Fatalf("failed to remove an option")
+	}
+	if run("-tag", "news", "retry") != 0 {
+		t.Fatalf("failed to remove options by tag")
+	}
+
+	entries, err := configfile.NewWithPath(path).Parse()
+	if err != nil {
+		t.Fatalf("Error parsing written file")
+	}
+
+	if len(entries[0].Options) != 2 || entries[0].Options[1].Value != "bar" {
+		t.Fatalf("unexpected options %v", entries[0].Options)
+	}
+	if len(entries[1].Options) != 1 || entries[1].Options[0].Name != "tag" {
+		t.Fatalf("unexpected options %v", entries[1].Options)
+	}
+}
@@ -23,6 +23,10 @@ func TestUsage(t *testing.T) {
 	config.Info()
 	config.Arguments(flag.NewFlagSet("test", flag.ContinueOnError))
 
+	convert := convertCmd{}
+	convert.Info()
+	convert.Arguments(flag.NewFlagSet("test", flag.ContinueOnError))
+
 	daemon := daemonCmd{}
 	daemon.Info()
 	daemon.Arguments(flag.NewFlagSet("test", flag.ContinueOnError))
@@ -47,6 +51,14 @@ func TestUsage(t *testing.T) {
 	ldt.Info()
 	ldt.Arguments(flag.NewFlagSet("test", flag.ContinueOnError))
 
+	outbox := outboxCmd{}
+	outbox.Info()
+	outbox.Arguments(flag.NewFlagSet("test", flag.ContinueOnError))
+
+	queue := queueCmd{}
+	queue.Info()
+	queue.Arguments(flag.NewFlagSet("test", flag.ContinueOnError))
+
 	seen := seenCmd{}
 	seen.Info()
 	seen.Arguments(flag.NewFlagSet("test", flag.ContinueOnError))
@@ -114,6 +126,13 @@ func TestBrokenConfig(t *testing.T) {
 		t.Fatalf("expected error with config file")
 	}
 
+	q := queueCmd{}
+	q.config = configfile.NewWithPath(tmpfile.Name())
+	res = q.Execute([]string{})
+	if res != 1 {
+		t.Fatalf("expected error with config file")
+	}
+
 	// TODO : error-match
 
 	os.Remove(tmpfile.Name())
@@ -0,0 +1,110 @@
+package withstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// The strategies which may be used to identify a feed item, and so to
+// decide whether we've seen it before.
+const (
+	// IdentityLink identifies items by their link, this is the default.
+	IdentityLink = "link"
+
+	// IdentityGUID identifies items by their GUID, falling back to the
+	// link for items which have none.
+	IdentityGUID = "guid"
+
+	// IdentityNormalizedLink identifies items by their link, after it has
+	// been canonicalized via CanonicalURL.
+	IdentityNormalizedLink = "normalized-link"
+
+	// IdentityHash identifies items by a hash of their title and content.
+	IdentityHash = "hash"
+)
+
+// Identities contains the names of all the valid identity strategies.
+var Identities = []string{IdentityLink, IdentityGUID, IdentityNormalizedLink, IdentityHash}
+
+// trackingParams holds the names of query parameters which are used for
+// tracking, and which don't change the resource an URL refers to.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+// CanonicalURL returns a canonical version of the given URL, so that links
+// which differ only in ways which don't matter compare as equal.
+//
+// The scheme is always https, the host is lower-cased and loses any "www."
+// prefix and default port, the fragment and tracking parameters (such as
+// "utm_source") are removed, the remaining query parameters are sorted and
+// any trailing slash is removed from the path.
+//
+// Values which can't be parsed as absolute URLs are returned unchanged.
+func CanonicalURL(link string) string {
+
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return link
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "http" {
+		scheme = "https"
+	}
+	u.Scheme = scheme
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	port := u.Port()
+	if port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	query := u.Query()
+	for name := range query {
+		if trackingParams[strings.ToLower(name)] || strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String()
+}
+
+// ID returns the identity of this item, using the given strategy.
+//
+// This is the key under which the state of the item is recorded.
+func (item *FeedItem) ID(strategy string) string {
+
+	switch strategy {
+	case IdentityGUID:
+		if item.Item.GUID != "" {
+			return item.Item.GUID
+		}
+	case IdentityNormalizedLink:
+		return CanonicalURL(item.Item.Link)
+	case IdentityHash:
+		sum := sha256.Sum256([]byte(item.Item.Title + "\n" + item.RawContent()))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	return item.Item.Link
+}
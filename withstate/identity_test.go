@@ -0,0 +1,73 @@
+package withstate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// TestCanonicalURL tests URL canonicalization.
+func TestCanonicalURL(t *testing.T) {
+
+	tests := map[string]string{
+		"https://example.com/post":                         "https://example.com/post",
+		"http://example.com/post":                          "https://example.com/post",
+		"https://WWW.Example.com/post/":                    "https://example.com/post",
+		"https://example.com:443/post":                     "https://example.com/post",
+		"https://example.com:8080/post":                    "https://example.com:8080/post",
+		"https://example.com/post#comments":                "https://example.com/post",
+		"https://example.com/post?utm_source=rss&b=2&a=1":  "https://example.com/post?a=1&b=2",
+		"https://example.com/post?fbclid=abc&UTM_MEDIUM=x": "https://example.com/post",
+		"https://example.com/":                             "https://example.com",
+		"not a url":                                        "not a url",
+	}
+
+	for input, expected := range tests {
+		out := CanonicalURL(input)
+		if out != expected {
+			t.Fatalf("canonicalized %s to %s, expected %s", input, out, expected)
+		}
+	}
+}
+
+// TestID tests the identity strategies.
+func TestID(t *testing.T) {
+
+	item := FeedItem{Item: &gofeed.Item{
+		Title:   "Title",
+		Link:    "http://example.com/post/",
+		GUID:    "guid-1",
+		Content: "content",
+	}}
+
+	if item.ID(IdentityLink) != "http://example.com/post/" {
+		t.Fatalf("wrong link identity %s", item.ID(IdentityLink))
+	}
+	if item.ID("") != item.ID(IdentityLink) {
+		t.Fatalf("the default identity should be the link")
+	}
+	if item.ID(IdentityGUID) != "guid-1" {
+		t.Fatalf("wrong guid identity %s", item.ID(IdentityGUID))
+	}
+	if item.ID(IdentityNormalizedLink) != "https://example.com/post" {
+		t.Fatalf("wrong normalized identity %s", item.ID(IdentityNormalizedLink))
+	}
+
+	hash := item.ID(IdentityHash)
+	if !strings.HasPrefix(hash, "sha256:") {
+		t.Fatalf("wrong hash identity %s", hash)
+	}
+
+	// The hash doesn't depend upon the link.
+	item.Item.Link = "https://example.com/moved"
+	if item.ID(IdentityHash) != hash {
+		t.Fatalf("hash changed with the link")
+	}
+
+	// Without a GUID we fall back to the link.
+	item.Item.GUID = ""
+	if item.ID(IdentityGUID) != "https://example.com/moved" {
+		t.Fatalf("wrong fallback identity %s", item.ID(IdentityGUID))
+	}
+}
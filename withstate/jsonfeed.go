@@ -0,0 +1,95 @@
+package withstate
+
+import (
+	"strconv"
+
+	"github.com/skx/rss2email/jsonfeed"
+)
+
+// The methods here give access to the fields of items which came from a
+// JSON Feed, and which have no place in a gofeed.Item.  Where it makes
+// sense they fall back to the equivalent fields of RSS and Atom items.
+//
+// They use value receivers so they may be used within email templates,
+// for example {{range .RSSItem.Attachments}}.
+
+// JSONFeed returns the JSON Feed item from which this item came, or nil
+// if it came from an RSS or Atom feed.
+func (item FeedItem) JSONFeed() *jsonfeed.Item {
+	return jsonfeed.ItemOf(item.Item)
+}
+
+// ContentHTML returns the HTML content of the item.
+//
+// For JSON Feed items this is the "content_html" field, which might be
+// empty if the item only has plain-text content.
+func (item FeedItem) ContentHTML() string {
+	if j := item.JSONFeed(); j != nil {
+		return j.ContentHTML
+	}
+	return item.Item.Content
+}
+
+// ContentText returns the plain-text content of the item, which is only
+// available for JSON Feed items.
+func (item FeedItem) ContentText() string {
+	if j := item.JSONFeed(); j != nil {
+		return j.ContentText
+	}
+	return ""
+}
+
+// Summary returns the summary of the item.
+func (item FeedItem) Summary() string {
+	if j := item.JSONFeed(); j != nil {
+		return j.Summary
+	}
+	return item.Item.Description
+}
+
+// ImageURL returns the URL of the main image of the item, if any.
+func (item FeedItem) ImageURL() string {
+	if j := item.JSONFeed(); j != nil && j.Image != "" {
+		return j.Image
+	}
+	if item.Item.Image != nil {
+		return item.Item.Image.URL
+	}
+	return ""
+}
+
+// BannerImage returns the URL of the banner image of the item, which is
+// only available for JSON Feed items.
+func (item FeedItem) BannerImage() string {
+	if j := item.JSONFeed(); j != nil {
+		return j.BannerImage
+	}
+	return ""
+}
+
+// Attachments returns the attachments of the item.
+//
+// For RSS and Atom items these are built from the enclosures.
+func (item FeedItem) Attachments() []jsonfeed.Attachment {
+
+	if j := item.JSONFeed(); j != nil {
+		return j.Attachments
+	}
+
+	var out []jsonfeed.Attachment
+	for _, enc := range item.Item.Enclosures {
+		a := jsonfeed.Attachment{URL: enc.URL, MimeType: enc.Type}
+		a.SizeInBytes, _ = strconv.ParseInt(enc.Length, 10, 64)
+		out = append(out, a)
+	}
+	return out
+}
+
+// JSONExtension returns the JSON encoding of the named extension of the
+// item, such as "_example", or the empty string if there is none.
+func (item FeedItem) JSONExtension(name string) string {
+	if j := item.JSONFeed(); j != nil {
+		return string(j.Extensions[name])
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package withstate
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/skx/rss2email/jsonfeed"
+)
+
+// TestJSONFeedItem tests the fields of JSON Feed items are available.
+func TestJSONFeedItem(t *testing.T) {
+
+	for _, name := range []string{"feed-1.0.json", "feed-1.1.json"} {
+
+		data, err := os.ReadFile("../jsonfeed/testdata/" + name)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", name, err)
+		}
+
+		feed, err := jsonfeed.Parse(data)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", name, err)
+		}
+
+		item := FeedItem{Item: feed.Translate().Items[0]}
+
+		if item.JSONFeed() == nil {
+			t.Fatalf("%s: item is not from a JSON Feed", name)
+		}
+		if item.Summary() == "" || len(item.Attachments()) != 1 || item.ImageURL() == "" {
+			t.Fatalf("%s: missing fields %v", name, item.JSONFeed())
+		}
+
+		switch name {
+		case "feed-1.0.json":
+			if item.ContentHTML() != "" || item.ContentText() == "" || item.JSONExtension("_itunes") != `{"episode":2}` {
+				t.Fatalf("%s: unexpected content", name)
+			}
+		case "feed-1.1.json":
+			if item.ContentHTML() != "<p>Please upgrade.</p>" || item.BannerImage() == "" || item.JSONExtension("_example") == "" {
+				t.Fatalf("%s: unexpected content", name)
+			}
+		}
+	}
+}
+
+// TestRSSItem tests the JSON Feed accessors fall back for other items.
+func TestRSSItem(t *testing.T) {
+
+	item := FeedItem{Item: &gofeed.Item{
+		Description: "summary",
+		Content:     "<p>content</p>",
+		Image:       &gofeed.Image{URL: "https://example.com/image.png"},
+		Enclosures:  []*gofeed.Enclosure{{URL: "https://example.com/a.mp3", Type: "audio/mpeg", Length: "100"}},
+	}}
+
+	if item.JSONFeed() != nil || item.ContentText() != "" || item.BannerImage() != "" || item.JSONExtension("_x") != "" {
+		t.Fatalf("unexpected JSON Feed fields")
+	}
+	if item.Summary() != "summary" || item.ContentHTML() != "<p>content</p>" || item.ImageURL() != "https://example.com/image.png" {
+		t.Fatalf("unexpected fields")
+	}
+	attachments := item.Attachments()
+	if len(attachments) != 1 || attachments[0].SizeInBytes != 100 || attachments[0].MimeType != "audio/mpeg" {
+		t.Fatalf("unexpected attachments %v", attachments)
+	}
+}